@@ -11,7 +11,8 @@ var ErrUnknownActionString = errors.New("unknown action string")
 
 const (
 	// ordered, order is required for list.GetAction
-	Reject Action = iota
+	Reject  Action = iota
+	Discard        // accept and drop silently, so spammers don't get a bounce
 	Mod
 	Pass
 )
@@ -27,10 +28,23 @@ func (a Action) Value() (driver.Value, error) {
 	return a.String(), nil
 }
 
+// implement encoding.TextMarshaler, used in list templates
+func (a Action) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// implement encoding.TextUnmarshaler
+func (a *Action) UnmarshalText(text []byte) (err error) {
+	*a, err = ParseAction(string(text))
+	return
+}
+
 func ParseAction(s string) (Action, error) {
 	switch s {
 	case Reject.String():
 		return Reject, nil
+	case Discard.String():
+		return Discard, nil
 	case Mod.String():
 		return Mod, nil
 	case Pass.String():
@@ -44,6 +58,8 @@ func (a Action) String() string {
 	switch a {
 	case Reject:
 		return "reject"
+	case Discard:
+		return "discard"
 	case Mod:
 		return "mod"
 	case Pass:
@@ -55,6 +71,10 @@ func (a Action) String() string {
 
 // helpers for templates
 
+func (a Action) EqualsDiscard() bool {
+	return a == Discard
+}
+
 func (a Action) EqualsMod() bool {
 	return a == Mod
 }
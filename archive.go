@@ -0,0 +1,215 @@
+package ulist
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/wansing/ulist/mailutil"
+)
+
+// header fields which are kept in the archive, everything else could leak information which the members don't see or which HideFrom should hide
+var archivedHeaderKeys = []string{
+	"Content-Transfer-Encoding",
+	"Content-Type",
+	"Date",
+	"From",
+	"In-Reply-To",
+	"List-Id",
+	"Message-Id",
+	"Mime-Version",
+	"References",
+	"Subject",
+}
+
+type ArchiveRepo interface {
+	AddArchived(list *List, message *ArchivedMessage, references []string) error // sets ID and Thread, references are the msg-ids of the parent messages, nearest first
+	Archived(list *List, id int) (*ArchivedMessage, error)                       // nil if not found
+	ArchivedBetween(list *List, from, to time.Time) ([]ArchivedMessage, error)   // oldest first, without Raw
+	ArchivedMonths(list *List) ([]ArchiveMonth, error)                           // newest first
+	ArchivedThread(list *List, thread int) ([]ArchivedMessage, error)            // oldest first
+	DeleteArchive(list *List) error
+	ExportArchived(list *List, from, to time.Time, f func(*ArchivedMessage) error) error // oldest first, with Raw, zero times mean no limit
+	IsArchived(list *List, messageID string) (bool, error)
+	Search(lists []ListInfo, query string, from, to time.Time, limit int) ([]ArchiveSearchResult, error) // searches subject, sender and text, zero times mean no limit
+}
+
+// ArchivedMessage is a message in the archive of a list.
+type ArchivedMessage struct {
+	ID        int
+	Thread    int // ID of the first archived message of the thread
+	MessageID string
+	Time      time.Time
+	From      string // decoded
+	Subject   string // decoded
+	Raw       []byte // header and body
+	Text      string // decoded text body, for the search index
+}
+
+// ArchiveSearchResult is an archived message which matches a search query. Raw and Text are not set.
+type ArchiveSearchResult struct {
+	ArchivedMessage
+	ListID  int
+	Snippet []SnippetFragment
+}
+
+// SnippetFragment is a part of the text around a search match. Fragments with Match set should be highlighted.
+type SnippetFragment struct {
+	Text  string
+	Match bool
+}
+
+// ArchiveMonth is a month with archived messages. Months are in UTC.
+type ArchiveMonth struct {
+	Year  int
+	Month time.Month
+	Count int
+}
+
+// String returns the month in the format "2006-01", which is used in urls.
+func (m ArchiveMonth) String() string {
+	return fmt.Sprintf("%04d-%02d", m.Year, m.Month)
+}
+
+// ParseArchiveMonth parses the output of ArchiveMonth.String.
+func ParseArchiveMonth(s string) (ArchiveMonth, error) {
+	t, err := time.Parse("2006-01", s)
+	if err != nil {
+		return ArchiveMonth{}, err
+	}
+	return ArchiveMonth{
+		Year:  t.Year(),
+		Month: t.Month(),
+	}, nil
+}
+
+// Start returns the first moment of the month.
+func (m ArchiveMonth) Start() time.Time {
+	return time.Date(m.Year, m.Month, 1, 0, 0, 0, 0, time.UTC)
+}
+
+// archive stores a message in the archive of the list and returns its ID. The header should be the rewritten one, so the "From" field respects HideFrom.
+func (u *Ulist) archive(list *List, header mail.Header, body []byte, t time.Time) (int, error) {
+
+	var archivedHeader = make(mail.Header)
+	for _, key := range archivedHeaderKeys {
+		if values := header[key]; len(values) > 0 {
+			archivedHeader[key] = values
+		}
+	}
+
+	// parent messages, nearest first
+
+	var references = mailutil.MessageIDs(header.Get("In-Reply-To"))
+	var ancestors = mailutil.MessageIDs(header.Get("References"))
+	for i := len(ancestors) - 1; i >= 0; i-- {
+		references = append(references, ancestors[i])
+	}
+
+	var raw bytes.Buffer
+	if err := mailutil.WriteHeader(&raw, archivedHeader); err != nil {
+		return 0, err
+	}
+	raw.Write(body)
+
+	var text string
+	if root, err := (&mailutil.Message{Header: archivedHeader, Body: body}).ParseParts(); err == nil {
+		text = searchText(root)
+	}
+
+	var archived = &ArchivedMessage{
+		MessageID: strings.TrimSpace(header.Get("Message-Id")),
+		Time:      t,
+		From:      mailutil.RobustWordDecode(header.Get("From")),
+		Subject:   mailutil.RobustWordDecode(header.Get("Subject")),
+		Raw:       raw.Bytes(),
+		Text:      text,
+	}
+	if err := u.Archive.AddArchived(list, archived, references); err != nil {
+		return 0, err
+	}
+	return archived.ID, nil
+}
+
+// searchText returns the first text/plain part or, if there is none, the text content of the first text/html part.
+func searchText(root *mailutil.Part) string {
+	var htmlBody string
+	for _, leaf := range root.Leaves() {
+		if leaf.IsAttachment() {
+			continue
+		}
+		switch leaf.MediaType {
+		case "text/plain":
+			return leaf.Text()
+		case "text/html":
+			if htmlBody == "" {
+				htmlBody = leaf.Text()
+			}
+		}
+	}
+	return mailutil.HTMLText(htmlBody)
+}
+
+// ExportArchive writes the archived messages of the list to w in the mboxrd format, oldest first. Zero times mean no limit.
+func (u *Ulist) ExportArchive(w io.Writer, list *List, from, to time.Time) error {
+	mw := mailutil.NewMboxWriter(w)
+	err := u.Archive.ExportArchived(list, from, to, func(message *ArchivedMessage) error {
+		return mw.Write(list.BounceAddress(), message.Time, message.Raw)
+	})
+	if err != nil {
+		return err
+	}
+	return mw.Flush()
+}
+
+// ImportArchive adds the messages of an mbox file to the archive of the list, regardless of the archive setting of the list. Nothing is forwarded. Messages whose Message-Id is in the archive already are skipped, so an import can be repeated. Messages without a Message-Id can't be deduplicated.
+func (u *Ulist) ImportArchive(list *List, r io.Reader) (imported, skipped int, err error) {
+
+	mr := mailutil.NewMboxReader(r)
+	for {
+		raw, fromLineTime, err := mr.Next()
+		if err == io.EOF {
+			return imported, skipped, nil
+		}
+		if err != nil {
+			return imported, skipped, err
+		}
+
+		msg, err := mailutil.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			return imported, skipped, fmt.Errorf("message %d: %w", imported+skipped+1, err)
+		}
+
+		if messageID := strings.TrimSpace(msg.Header.Get("Message-Id")); messageID != "" {
+			isArchived, err := u.Archive.IsArchived(list, messageID)
+			if err != nil {
+				return imported, skipped, err
+			}
+			if isArchived {
+				skipped++
+				continue
+			}
+		}
+
+		// prefer the Date header, the "From " line might contain the time of the export
+		var t = fromLineTime
+		if date, err := msg.Header.Date(); err == nil {
+			t = date
+		}
+		if t.IsZero() {
+			t = time.Now()
+		}
+
+		if list.HideFrom {
+			msg.Header["From"] = []string{list.RFC5322NameAddr()}
+		}
+
+		if _, err := u.archive(list, msg.Header, msg.Body, t); err != nil {
+			return imported, skipped, err
+		}
+		imported++
+	}
+}
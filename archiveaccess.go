@@ -0,0 +1,79 @@
+package ulist
+
+import (
+	"database/sql/driver"
+	"errors"
+)
+
+// ArchiveAccess determines whether a list is archived and who can read the archive.
+type ArchiveAccess int
+
+var ErrUnknownArchiveAccessString = errors.New("unknown archive access string")
+
+const (
+	ArchiveOff        ArchiveAccess = iota // no archive, zero value
+	ArchivePublic                          // everyone, including visitors who are not logged in
+	ArchiveMembers                         // members, moderators and admins
+	ArchiveModerators                      // moderators and admins
+)
+
+// ArchiveAccesses are all archive access values, for templates.
+var ArchiveAccesses = []ArchiveAccess{ArchiveOff, ArchivePublic, ArchiveMembers, ArchiveModerators}
+
+// implement sql.Scanner
+func (a *ArchiveAccess) Scan(value interface{}) (err error) {
+	*a, err = ParseArchiveAccess(value.(string))
+	return
+}
+
+// implement sql/driver.Valuer
+func (a ArchiveAccess) Value() (driver.Value, error) {
+	return a.String(), nil
+}
+
+// implement encoding.TextMarshaler, used in list templates
+func (a ArchiveAccess) MarshalText() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+// implement encoding.TextUnmarshaler
+func (a *ArchiveAccess) UnmarshalText(text []byte) (err error) {
+	*a, err = ParseArchiveAccess(string(text))
+	return
+}
+
+func ParseArchiveAccess(s string) (ArchiveAccess, error) {
+	switch s {
+	case ArchiveOff.String():
+		return ArchiveOff, nil
+	case ArchivePublic.String():
+		return ArchivePublic, nil
+	case ArchiveMembers.String():
+		return ArchiveMembers, nil
+	case ArchiveModerators.String():
+		return ArchiveModerators, nil
+	default:
+		return ArchiveOff, ErrUnknownArchiveAccessString
+	}
+}
+
+func (a ArchiveAccess) String() string {
+	switch a {
+	case ArchiveOff:
+		return "off"
+	case ArchivePublic:
+		return "public"
+	case ArchiveMembers:
+		return "members"
+	case ArchiveModerators:
+		return "moderators"
+	default:
+		return "<unknown>"
+	}
+}
+
+// helper for templates
+
+func (a ArchiveAccess) EqualsPublic() bool {
+	return a == ArchivePublic
+}
@@ -0,0 +1,51 @@
+package ulist
+
+import (
+	"log"
+	"net/mail"
+	"time"
+
+	"github.com/wansing/ulist/mailutil"
+)
+
+// Decision is a moderation decision which is recorded in the audit trail.
+type Decision string
+
+const (
+	DecisionAddKnown Decision = "add-known"
+	DecisionBlock    Decision = "block"
+	DecisionDelete   Decision = "delete"
+	DecisionEdit     Decision = "edit"
+	DecisionExpire   Decision = "expire"
+	DecisionPass     Decision = "pass"
+	DecisionReject   Decision = "reject"
+)
+
+type AuditEntry struct {
+	Time      time.Time
+	Moderator string // RFC5322 AddrSpec, empty for automatic decisions
+	Decision  Decision
+	Subject   string // decoded
+	Sender    string // raw "From" header
+	MessageID string // original Message-Id
+}
+
+// Audit records a moderation decision about a message. moderator is nil for automatic decisions. Errors are logged only, because the decision has been made anyway.
+func (u *Ulist) Audit(list *List, moderator *Addr, decision Decision, header mail.Header) {
+
+	entry := AuditEntry{
+		Time:      time.Now(),
+		Decision:  decision,
+		Subject:   mailutil.RobustWordDecode(header.Get("Subject")),
+		Sender:    header.Get("From"),
+		MessageID: header.Get("Message-Id"),
+	}
+
+	if moderator != nil {
+		entry.Moderator = moderator.RFC5322AddrSpec()
+	}
+
+	if err := u.Lists.AddAuditEntry(list, entry); err != nil {
+		log.Printf("error writing audit entry: %v", err)
+	}
+}
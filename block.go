@@ -0,0 +1,47 @@
+package ulist
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/wansing/ulist/mailutil"
+)
+
+var ErrBlocked = errors.New("the address is blocked")
+
+// ParseBlockPattern normalizes a blocklist entry. An entry is either an address like "alice@example.com" or a domain like "example.com", which blocks all addresses of that domain. A leading "@" is removed from domains.
+func ParseBlockPattern(s string) (string, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	s = strings.TrimPrefix(s, "@")
+	if strings.Contains(s, "@") {
+		addr, err := mailutil.ParseAddress(s)
+		if err != nil {
+			return "", err
+		}
+		return addr.RFC5322AddrSpec(), nil
+	}
+	if s == "" || strings.ContainsAny(s, " \t<>,;") || !strings.Contains(s, ".") {
+		return "", fmt.Errorf("invalid domain: %s", s)
+	}
+	return s, nil
+}
+
+// ParseBlockPatterns parses whitespace- or comma-separated blocklist entries. It returns the valid entries and an error for each invalid one.
+func ParseBlockPatterns(s string, limit int) ([]string, []error) {
+	var patterns []string
+	var errs []error
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ';' || r == ' ' || r == '\t' || r == '\r' || r == '\n' }) {
+		if len(patterns) >= limit {
+			errs = append(errs, fmt.Errorf("limit of %d entries exceeded", limit))
+			break
+		}
+		pattern, err := ParseBlockPattern(field)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		patterns = append(patterns, pattern)
+	}
+	return patterns, errs
+}
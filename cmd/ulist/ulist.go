@@ -1,11 +1,14 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"path/filepath"
 	"strconv"
+	"time"
 
 	"github.com/wansing/ulist"
 	"github.com/wansing/ulist/filelog"
@@ -44,6 +47,14 @@ func main() {
 	flag.StringVar(&superadmin, "superadmin", superadmin, "allow the user with this `email` address to create, delete and modify every list through the web interface")
 	flag.StringVar(&webListen, "http", webListen, "make the web interface available at this ip:port or socket path")
 	flag.StringVar(&webURL, "weburl", webURL, "use this `url` in links to the web interface")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage:\n")
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s [flags]                                       run the server\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s [flags] export list@example.com [from [to]]   write the archive of the list in mbox format to stdout, dates are inclusive and formatted like 2006-01-02\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "  %s [flags] import list@example.com file.mbox     add the messages of an mbox file to the archive of the list, skipping known Message-Ids\n", os.Args[0])
+		fmt.Fprintf(flag.CommandLine.Output(), "Flags:\n")
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
 	if dummyMode {
@@ -97,6 +108,19 @@ func main() {
 	}
 	defer listDB.Close()
 
+	archiveDB, err := sqlite.OpenArchiveDB(filepath.Join(stateDir, "archive.sqlite3?_busy_timeout=10000&_journal=WAL&_sync=NORMAL&cache=shared"))
+	if err != nil {
+		log.Printf("error opening archive db: %v", err)
+		return
+	}
+	defer archiveDB.Close()
+
+	if archiveDB.FullTextSearch() {
+		log.Println("archive search uses the SQLite FTS5 index")
+	} else {
+		log.Println("archive search uses substring matching, build with -tags sqlite_fts5 for full-text search")
+	}
+
 	userDB, err := sqlite.OpenUserDB(filepath.Join(stateDir, "users.sqlite3?_busy_timeout=10000&_journal=WAL&_sync=NORMAL&cache=shared"))
 	if err != nil {
 		log.Printf("error opening user db: %v", err)
@@ -107,6 +131,7 @@ func main() {
 	// create Ulist
 
 	ul := &ulist.Ulist{
+		Archive:       archiveDB,
 		DummyMode:     dummyMode,
 		GDPRLogger:    gdprLogger,
 		Lists:         listDB,
@@ -136,7 +161,92 @@ func main() {
 		ul.MTA = mailutil.DummyMTA{}
 	}
 
+	switch flag.Arg(0) {
+	case "":
+	case "export":
+		if err := exportArchive(ul, flag.Args()[1:]); err != nil {
+			log.Printf("error exporting archive: %v", err)
+		}
+		return
+	case "import":
+		if err := importArchive(ul, flag.Args()[1:]); err != nil {
+			log.Printf("error importing archive: %v", err)
+		}
+		return
+	default:
+		flag.Usage()
+		return
+	}
+
 	if err := ul.ListenAndServe(); err != nil {
 		log.Printf("error: %v", err)
 	}
 }
+
+func getList(ul *ulist.Ulist, rawAddress string) (*ulist.List, error) {
+	listAddr, err := mailutil.ParseAddress(rawAddress)
+	if err != nil {
+		return nil, err
+	}
+	list, err := ul.Lists.GetList(listAddr)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return nil, fmt.Errorf("list %s not found", listAddr)
+	}
+	return list, nil
+}
+
+// args: list [from [to]]
+func exportArchive(ul *ulist.Ulist, args []string) error {
+
+	if len(args) < 1 || len(args) > 3 {
+		return errors.New("usage: export list@example.com [from [to]]")
+	}
+
+	list, err := getList(ul, args[0])
+	if err != nil {
+		return err
+	}
+
+	var from, to time.Time
+	if len(args) > 1 {
+		from, err = time.ParseInLocation("2006-01-02", args[1], time.Local)
+		if err != nil {
+			return err
+		}
+	}
+	if len(args) > 2 {
+		to, err = time.ParseInLocation("2006-01-02", args[2], time.Local)
+		if err != nil {
+			return err
+		}
+		to = to.AddDate(0, 0, 1) // inclusive
+	}
+
+	return ul.ExportArchive(os.Stdout, list, from, to)
+}
+
+// args: list file
+func importArchive(ul *ulist.Ulist, args []string) error {
+
+	if len(args) != 2 {
+		return errors.New("usage: import list@example.com file.mbox")
+	}
+
+	list, err := getList(ul, args[0])
+	if err != nil {
+		return err
+	}
+
+	file, err := os.Open(args[1])
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	imported, skipped, err := ul.ImportArchive(list, file)
+	log.Printf("imported %d messages, skipped %d messages which were in the archive already", imported, skipped)
+	return err
+}
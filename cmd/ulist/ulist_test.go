@@ -1,13 +1,20 @@
 package main
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"os"
+	"path/filepath"
 	"regexp"
+	"slices"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -19,6 +26,7 @@ import (
 	"github.com/wansing/ulist/web"
 )
 
+const testArchiveDbPath = "/tmp/ulist-test-archive.sqlite3"
 const testDbPath = "/tmp/ulist-test.sqlite3"
 
 var ul *ulist.Ulist
@@ -40,7 +48,15 @@ func init() {
 		log.Fatalf("error creating database: %v", err)
 	}
 
+	_ = os.Remove(testArchiveDbPath)
+
+	archiveDB, err := sqlite.OpenArchiveDB(testArchiveDbPath)
+	if err != nil {
+		log.Fatalf("error creating archive database: %v", err)
+	}
+
 	ul = &ulist.Ulist{
+		Archive:    archiveDB,
 		DummyMode:  true,
 		GDPRLogger: filelog.ChanLogger(gdprChannel),
 		Lists:      listDB,
@@ -173,6 +189,15 @@ func wantChansEmpty(t *testing.T) {
 	}
 }
 
+// lastArchived returns the ID of the most recently archived message of the list.
+func lastArchived(t *testing.T, list *ulist.List) string {
+	archived, err := ul.Archive.ArchivedBetween(list, time.Time{}, time.Now().Add(time.Minute))
+	if err != nil || len(archived) == 0 {
+		t.Fatalf("no archived message: %v", err)
+	}
+	return strconv.Itoa(archived[len(archived)-1].ID)
+}
+
 func mustTransactOne(envelopeFrom string, envelopeTo []string, data string) {
 	if err := transactOne(envelopeFrom, envelopeTo, data); err != nil {
 		panic(err)
@@ -288,16 +313,62 @@ func TestDeleteList(t *testing.T) {
 
 	list, _ := ul.Lists.GetList(mustParse("delete-list@example.com"))
 
-	err := ul.Lists.Delete(list)
+	// state which is kept outside the list table
+
+	m, err := list.Compose(mustParse("alice@example.com"), "Hi", "Hello", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.Save(list, m); err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.Schedule(list, m, time.Now().Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(ul.DigestFolder(list.ListInfo), 0700); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(ul.DigestFolder(list.ListInfo), fmt.Sprintf("%010d-1.eml", time.Now().Unix())), []byte("Subject: Hi\r\n\r\nHello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.Archive.AddArchived(list, &ulist.ArchivedMessage{MessageID: "<deleted@example.com>", Time: time.Now(), Subject: "Hi", Raw: []byte("Subject: Hi\r\n\r\nHello")}, nil); err != nil {
+		t.Fatal(err)
+	}
+	digestJob := fmt.Sprintf("digest-daily-%d", list.ID)
+	modDigestJob := fmt.Sprintf("mod-digest-hourly-%d", list.ID)
+	for _, job := range []string{digestJob, modDigestJob} {
+		if err := ul.Lists.SetLastRun(job, time.Now()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = ul.DeleteList(list)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	deleted := list
 	list, err = ul.Lists.GetList(mustParse("delete-list@example.com"))
 	if list != nil || err != nil {
 		t.Fatalf("got %v, %v, want nil, nil", list, err)
 	}
 
+	// the ID of the deleted list can be reused, so nothing must be left behind
+
+	for _, folder := range []string{ul.StorageFolder(deleted.ListInfo), ul.DigestFolder(deleted.ListInfo), ul.ScheduledFolder(deleted.ListInfo)} {
+		if _, err := os.Stat(folder); !os.IsNotExist(err) {
+			t.Errorf("folder %s has not been deleted: %v", folder, err)
+		}
+	}
+	if archived, err := ul.Archive.ArchivedBetween(deleted, time.Time{}, time.Now().Add(time.Minute)); len(archived) > 0 || err != nil {
+		t.Errorf("got %d archived messages, %v, want none", len(archived), err)
+	}
+	for _, job := range []string{digestJob, modDigestJob} {
+		if last, err := ul.Lists.LastRun(job); !last.IsZero() || err != nil {
+			t.Errorf("got last run %v, %v of job %s, want zero time", last, err, job)
+		}
+	}
+
 	wantChansEmpty(t)
 }
 
@@ -356,10 +427,14 @@ Subject: Hi
 Hello World`)
 
 	wantMessage(t, "createlist+bounces@example.com", []string{"alice@example.com", "bob@example.net", "carol@example.org"}, `From: "bob via Created List" <createlist@example.com>
-List-Id: "Created List" <createlist@example.com>
+List-Help: <https://lists.example.com/list/createlist@example.com>
+List-Id: "Created List" <createlist.example.com>
+List-Owner: <mailto:createlist+owner@example.com>
 List-Post: <mailto:createlist@example.com>
-List-Unsubscribe: <mailto:createlist@example.com?subject=leave>
+List-Unsubscribe: <mailto:createlist@example.com?subject=leave>,
+ <https://lists.example.com/leave/createlist@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <bob@example.net>
 Subject: [Created List] Hi
 To: createlist@example.com
@@ -393,10 +468,14 @@ Subject: Hi
 Hello World`)
 
 	wantMessage(t, "multiple-a+bounces@example.com", []string{"alice@example.com"}, `From: "alice via A" <multiple-a@example.com>
-List-Id: "A" <multiple-a@example.com>
+List-Help: <https://lists.example.com/list/multiple-a@example.com>
+List-Id: "A" <multiple-a.example.com>
+List-Owner: <mailto:multiple-a+owner@example.com>
 List-Post: <mailto:multiple-a@example.com>
-List-Unsubscribe: <mailto:multiple-a@example.com?subject=leave>
+List-Unsubscribe: <mailto:multiple-a@example.com?subject=leave>,
+ <https://lists.example.com/leave/multiple-a@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <alice@example.com>
 Subject: [A] Hi
 To: multiple-a@example.com, multiple-b@example.net
@@ -407,10 +486,14 @@ Hello World
 You can leave the mailing list "A" here: https://lists.example.com/leave/multiple-a@example.com`)
 
 	wantMessage(t, "multiple-b+bounces@example.net", []string{"alice@example.com"}, `From: "alice via B" <multiple-b@example.net>
-List-Id: "B" <multiple-b@example.net>
+List-Help: <https://lists.example.com/list/multiple-b@example.net>
+List-Id: "B" <multiple-b.example.net>
+List-Owner: <mailto:multiple-b+owner@example.net>
 List-Post: <mailto:multiple-b@example.net>
-List-Unsubscribe: <mailto:multiple-b@example.net?subject=leave>
+List-Unsubscribe: <mailto:multiple-b@example.net?subject=leave>,
+ <https://lists.example.com/leave/multiple-b@example.net>
 Message-Id: <message-id@example.net>
+Precedence: list
 Reply-To: <alice@example.com>
 Subject: [B] Hi
 To: multiple-a@example.com, multiple-b@example.net
@@ -442,10 +525,14 @@ Hello`},
 	)
 
 	wantMessage(t, "multiple-a+bounces@example.com", []string{"alice@example.com"}, `From: "alice via A" <multiple-a@example.com>
-List-Id: "A" <multiple-a@example.com>
+List-Help: <https://lists.example.com/list/multiple-a@example.com>
+List-Id: "A" <multiple-a.example.com>
+List-Owner: <mailto:multiple-a+owner@example.com>
 List-Post: <mailto:multiple-a@example.com>
-List-Unsubscribe: <mailto:multiple-a@example.com?subject=leave>
+List-Unsubscribe: <mailto:multiple-a@example.com?subject=leave>,
+ <https://lists.example.com/leave/multiple-a@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <alice@example.com>
 Subject: [A] Hi
 To: multiple-a@example.com
@@ -456,10 +543,14 @@ Hello
 You can leave the mailing list "A" here: https://lists.example.com/leave/multiple-a@example.com`)
 
 	wantMessage(t, "multiple-b+bounces@example.net", []string{"alice@example.com"}, `From: "alice via B" <multiple-b@example.net>
-List-Id: "B" <multiple-b@example.net>
+List-Help: <https://lists.example.com/list/multiple-b@example.net>
+List-Id: "B" <multiple-b.example.net>
+List-Owner: <mailto:multiple-b+owner@example.net>
 List-Post: <mailto:multiple-b@example.net>
-List-Unsubscribe: <mailto:multiple-b@example.net?subject=leave>
+List-Unsubscribe: <mailto:multiple-b@example.net?subject=leave>,
+ <https://lists.example.com/leave/multiple-b@example.net>
 Message-Id: <message-id@example.net>
+Precedence: list
 Reply-To: <alice@example.com>
 Subject: [B] Hi
 To: multiple-b@example.net
@@ -478,7 +569,7 @@ func TestPublicList(t *testing.T) {
 
 	list, _ := ul.Lists.GetList(mustParse("public@example.com"))
 
-	if err := ul.Lists.Update(list, "Public", true, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Mod); err != nil {
+	if err := ul.Lists.Update(list, "Public", true, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Mod, ulist.Reject); err != nil {
 		t.Fatal(err)
 	}
 
@@ -607,7 +698,7 @@ func TestRejectAll(t *testing.T) {
 
 	ul.CreateList("reject-all@example.com", "List name", "", "testing")
 	list, _ := ul.Lists.GetList(mustParse("reject-all@example.com"))
-	ul.Lists.Update(list, "List name", false, false, ulist.Reject, ulist.Reject, ulist.Reject, ulist.Reject)
+	ul.Lists.Update(list, "List name", false, false, ulist.Reject, ulist.Reject, ulist.Reject, ulist.Reject, ulist.Reject)
 
 	ul.Lists.AddKnowns(list, []*ulist.Addr{mustParse("known@example.com")})
 	ul.AddMembers(list, true, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
@@ -861,10 +952,14 @@ Hello`)
 	wantMessage(t, "cc-bcc+bounces@example.com", []string{"alice@example.com"},
 		`Cc: bar@example.com, cc-bcc@example.com
 From: "alice via List" <cc-bcc@example.com>
-List-Id: "List" <cc-bcc@example.com>
+List-Help: <https://lists.example.com/list/cc-bcc@example.com>
+List-Id: "List" <cc-bcc.example.com>
+List-Owner: <mailto:cc-bcc+owner@example.com>
 List-Post: <mailto:cc-bcc@example.com>
-List-Unsubscribe: <mailto:cc-bcc@example.com?subject=leave>
+List-Unsubscribe: <mailto:cc-bcc@example.com?subject=leave>,
+ <https://lists.example.com/leave/cc-bcc@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <alice@example.com>
 Subject: [List] Hi
 To: foo@example.com
@@ -893,10 +988,14 @@ Hi`) // note that the "To" header is not encoded properly
 
 	wantMessage(t, "list_ue+bounces@example.com", []string{"user_ue@example.com"},
 		`From: =?utf-8?q?User_=C3=9C_via_List_=C3=9C?= <list_ue@example.com>
-List-Id: =?utf-8?q?List_=C3=9C?= <list_ue@example.com>
+List-Help: <https://lists.example.com/list/list_ue@example.com>
+List-Id: =?utf-8?q?List_=C3=9C?= <list_ue.example.com>
+List-Owner: <mailto:list_ue+owner@example.com>
 List-Post: <mailto:list_ue@example.com>
-List-Unsubscribe: <mailto:list_ue@example.com?subject=leave>
+List-Unsubscribe: <mailto:list_ue@example.com?subject=leave>,
+ <https://lists.example.com/leave/list_ue@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: =?utf-8?q?User_=C3=9C?= <user_ue@example.com>
 Subject: =?utf-8?q?[List_=C3=9C]_Hell=C3=B6?=
 To: "List Ü" <list_ue@example.com>
@@ -943,10 +1042,14 @@ Content-Disposition: inline
 		`Content-Type: multipart/mixed;
  boundary=boundary-0
 From: "alice via List" <multipart-alternative-message@example.com>
-List-Id: "List" <multipart-alternative-message@example.com>
+List-Help: <https://lists.example.com/list/multipart-alternative-message@example.com>
+List-Id: "List" <multipart-alternative-message.example.com>
+List-Owner: <mailto:multipart-alternative-message+owner@example.com>
 List-Post: <mailto:multipart-alternative-message@example.com>
-List-Unsubscribe: <mailto:multipart-alternative-message@example.com?subject=leave>
+List-Unsubscribe: <mailto:multipart-alternative-message@example.com?subject=leave>,
+ <https://lists.example.com/leave/multipart-alternative-message@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <alice@example.com>
 Subject: [List] Hi
 To: multipart-alternative-message@example.com
@@ -1025,10 +1128,14 @@ Content-Disposition: attachment; filename=hello.html
 	wantMessage(t, "multipart-mixed-message+bounces@example.com", []string{"alice@example.com"},
 		`Content-Type: multipart/mixed; boundary="original-boundary"
 From: "alice via List" <multipart-mixed-message@example.com>
-List-Id: "List" <multipart-mixed-message@example.com>
+List-Help: <https://lists.example.com/list/multipart-mixed-message@example.com>
+List-Id: "List" <multipart-mixed-message.example.com>
+List-Owner: <mailto:multipart-mixed-message+owner@example.com>
 List-Post: <mailto:multipart-mixed-message@example.com>
-List-Unsubscribe: <mailto:multipart-mixed-message@example.com?subject=leave>
+List-Unsubscribe: <mailto:multipart-mixed-message@example.com?subject=leave>,
+ <https://lists.example.com/leave/multipart-mixed-message@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <alice@example.com>
 Subject: [List] Hi
 To: multipart-mixed-message@example.com
@@ -1086,10 +1193,14 @@ Hello`)
 
 	wantMessage(t, "knowns+bounces@example.com", []string{"alice@example.com"},
 		`From: "known via List" <knowns@example.com>
-List-Id: "List" <knowns@example.com>
+List-Help: <https://lists.example.com/list/knowns@example.com>
+List-Id: "List" <knowns.example.com>
+List-Owner: <mailto:knowns+owner@example.com>
 List-Post: <mailto:knowns@example.com>
-List-Unsubscribe: <mailto:knowns@example.com?subject=leave>
+List-Unsubscribe: <mailto:knowns@example.com?subject=leave>,
+ <https://lists.example.com/leave/knowns@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <known@example.com>
 Subject: [List] Hi
 To: knowns@example.com
@@ -1131,7 +1242,7 @@ func TestMembers(t *testing.T) {
 	<-gdprChannel    // welcome alice
 
 	list, _ := ul.Lists.GetList(mustParse("members@example.com"))
-	ul.Lists.Update(list, "List", false, false, ulist.Reject, ulist.Pass, ulist.Reject, ulist.Reject) // members only
+	ul.Lists.Update(list, "List", false, false, ulist.Reject, ulist.Pass, ulist.Reject, ulist.Reject, ulist.Reject) // members only
 	ul.AddMembers(
 		list,
 		false, // sendWelcome
@@ -1157,10 +1268,14 @@ Hello`)
 
 	wantMessage(t, "members+bounces@example.com", []string{"alice@example.com"},
 		`From: "dave via List" <members@example.com>
-List-Id: "List" <members@example.com>
+List-Help: <https://lists.example.com/list/members@example.com>
+List-Id: "List" <members.example.com>
+List-Owner: <mailto:members+owner@example.com>
 List-Post: <mailto:members@example.com>
-List-Unsubscribe: <mailto:members@example.com?subject=leave>
+List-Unsubscribe: <mailto:members@example.com?subject=leave>,
+ <https://lists.example.com/leave/members@example.com>
 Message-Id: <message-id@example.com>
+Precedence: list
 Reply-To: <dave@example.com>
 Subject: [List] Hi
 To: members@example.com
@@ -1235,3 +1350,1944 @@ You can leave the mailing list "List" here: https://lists.example.com/leave/memb
 
 	wantChansEmpty(t)
 }
+
+func TestHeldNotice(t *testing.T) {
+
+	ul.CreateList("held-notice@example.com", "List", "alice@example.com", "testing")
+
+	<-messageChannel // welcome alice
+	<-gdprChannel    // alice
+
+	list, _ := ul.Lists.GetList(mustParse("held-notice@example.com"))
+	if err := ul.Lists.UpdateModeration(list, true, 0, false, false); err != nil {
+		t.Fatal(err)
+	}
+
+	const notifyMods = `Content-Type: text/plain; charset=utf-8
+From: "List" <held-notice@example.com>
+Message-Id: <message-id@example.com>
+Subject: [List] A message needs moderation
+To: alice@example.com
+
+A message at "List" <held-notice@example.com> is waiting for moderation.
+
+You can moderate it here: https://lists.example.com/mod/held-notice@example.com
+
+----
+You can leave the mailing list "List" here: https://lists.example.com/leave/held-notice@example.com`
+
+	// first message: sender gets a notice
+
+	mustTransactOne("unknown@example.com", []string{"held-notice@example.com"},
+		`From: unknown@example.com
+To: held-notice@example.com
+Message-Id: <first@example.com>
+Subject: Hi
+
+Hello`)
+
+	wantMessage(t, "held-notice+bounces@example.com", []string{"alice@example.com"}, notifyMods)
+
+	wantMessage(t, "", []string{"unknown@example.com"}, `Auto-Submitted: auto-replied
+Content-Type: text/plain; charset=utf-8
+From: "List" <held-notice@example.com>
+In-Reply-To: <first@example.com>
+Message-Id: <message-id@example.com>
+References: <first@example.com>
+Subject: [List] Your message is waiting for moderation
+To: unknown@example.com
+
+Your message to the mailing list held-notice@example.com with the subject "Hi" is waiting for moderation. A moderator will decide on it soon, so there is no need to send it again.
+
+You won't get this notice again for further messages to the list during the next 24 hours.
+
+This is an automatic reply.`)
+
+	// second message: rate limited
+
+	mustTransactOne("unknown@example.com", []string{"held-notice@example.com"},
+		`From: unknown@example.com
+To: held-notice@example.com
+Subject: Hi again
+
+Hello`)
+
+	wantMessage(t, "held-notice+bounces@example.com", []string{"alice@example.com"}, notifyMods)
+
+	// automatic reply and spam: no notice
+
+	mustTransactOne("other@example.com", []string{"held-notice@example.com"},
+		`From: other@example.com
+To: held-notice@example.com
+Auto-Submitted: auto-replied
+Subject: Out of office
+
+I'm away`)
+
+	wantMessage(t, "held-notice+bounces@example.com", []string{"alice@example.com"}, notifyMods)
+
+	mustTransactOne("spammer@example.com", []string{"held-notice@example.com"},
+		`From: spammer@example.com
+To: held-notice@example.com
+X-Spam: yes
+Subject: Buy now
+
+Cheap`)
+
+	wantMessage(t, "held-notice+bounces@example.com", []string{"alice@example.com"}, notifyMods)
+
+	// the automatic reply didn't use up the notice of the sender
+
+	mustTransactOne("other@example.com", []string{"held-notice@example.com"},
+		`From: other@example.com
+To: held-notice@example.com
+Message-Id: <other@example.com>
+Subject: Back
+
+I'm back`)
+
+	wantMessage(t, "held-notice+bounces@example.com", []string{"alice@example.com"}, notifyMods)
+
+	wantMessage(t, "", []string{"other@example.com"}, `Auto-Submitted: auto-replied
+Content-Type: text/plain; charset=utf-8
+From: "List" <held-notice@example.com>
+In-Reply-To: <other@example.com>
+Message-Id: <message-id@example.com>
+References: <other@example.com>
+Subject: [List] Your message is waiting for moderation
+To: other@example.com
+
+Your message to the mailing list held-notice@example.com with the subject "Back" is waiting for moderation. A moderator will decide on it soon, so there is no need to send it again.
+
+You won't get this notice again for further messages to the list during the next 24 hours.
+
+This is an automatic reply.`)
+
+	wantChansEmpty(t)
+}
+
+func TestExpireModeratedMails(t *testing.T) {
+
+	ul.CreateList("expire@example.com", "List", "alice@example.com", "testing")
+
+	<-messageChannel // welcome alice
+	<-gdprChannel    // alice
+
+	list, _ := ul.Lists.GetList(mustParse("expire@example.com"))
+	if err := ul.Lists.UpdateModeration(list, false, 7, true, true); err != nil {
+		t.Fatal(err)
+	}
+
+	_ = os.RemoveAll(ul.StorageFolder(list.ListInfo)) // from previous test runs
+	if err := os.MkdirAll(ul.StorageFolder(list.ListInfo), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	var old = fmt.Sprintf("%010d-old.eml", time.Now().AddDate(0, 0, -8).Unix())
+	var recent = fmt.Sprintf("%010d-recent.eml", time.Now().AddDate(0, 0, -6).Unix())
+
+	for _, filename := range []string{old, recent} {
+		err := os.WriteFile(filepath.Join(ul.StorageFolder(list.ListInfo), filename), []byte("From: bob@example.com\r\nTo: expire@example.com\r\nSubject: Hi\r\n\r\nHello"), 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	expired, err := ul.ExpireModeratedMails(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expired != 1 {
+		t.Fatalf("got %d expired messages, want 1", expired)
+	}
+
+	filenames, _ := ul.StoredFilenames(list, -1)
+	if len(filenames) != 1 || filenames[0] != recent {
+		t.Fatalf("got %v, want [%s]", filenames, recent)
+	}
+
+	wantMessage(t, "", []string{"bob@example.com"}, `Auto-Submitted: auto-replied
+Content-Type: text/plain; charset=utf-8
+From: "List" <expire@example.com>
+Message-Id: <message-id@example.com>
+Subject: [List] Your message has not been moderated
+To: bob@example.com
+
+Your message to the mailing list expire@example.com with the subject "Hi" has not been moderated within 7 days. It has been discarded.
+
+This is an automatic reply.`)
+
+	wantMessage(t, "expire+bounces@example.com", []string{"alice@example.com"}, `Content-Type: text/plain; charset=utf-8
+From: "List" <expire@example.com>
+Message-Id: <message-id@example.com>
+Subject: [List] Unmoderated messages have been deleted
+To: alice@example.com
+
+1 messages at "List" <expire@example.com> have not been moderated within 7 days. They have been deleted.
+
+You can change the retention period here: https://lists.example.com/settings/expire@example.com
+
+----
+You can leave the mailing list "List" here: https://lists.example.com/leave/expire@example.com`)
+
+	wantChansEmpty(t)
+}
+
+func TestBlocked(t *testing.T) {
+
+	ul.CreateList("blocked@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("blocked@example.com"))
+	ul.Lists.Update(list, "List", true, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+
+	ul.Lists.AddBlocked(list, []string{"eve@example.com"})
+	ul.Lists.AddBlocked(nil, []string{"spam.example.net"})
+
+	for _, from := range []string{"eve@example.com", "anyone@spam.example.net"} {
+		err := transactOne("some_envelope@example.com", []string{"blocked@example.com"},
+			`From: `+from+`
+To: blocked@example.com
+Subject: Hi
+
+Hello`)
+		wantErr(t, err, "SMTP error 550: user not found")
+
+		err = transactOne("some_envelope@example.com", []string{"blocked@example.com"},
+			`From: `+from+`
+To: blocked@example.com
+Subject: join
+
+`)
+		wantErr(t, err, "SMTP error 550: "+from+" is blocked")
+	}
+
+	// other lists are not affected by the blocklist of the list
+
+	if blocked, err := ul.Lists.IsBlocked(nil, mustParse("eve@example.com")); blocked || err != nil {
+		t.Fatalf("got %v, %v, want false, nil", blocked, err)
+	}
+
+	ul.Lists.RemoveBlocked(nil, []string{"spam.example.net"})
+
+	if blocked, err := ul.Lists.IsBlocked(list, mustParse("anyone@spam.example.net")); blocked || err != nil {
+		t.Fatalf("got %v, %v, want false, nil", blocked, err)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestAudit(t *testing.T) {
+
+	ul.CreateList("audit@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("audit@example.com"))
+
+	header := mail.Header{
+		"From":       []string{"bob@example.com"},
+		"Message-Id": []string{"<original@example.com>"},
+		"Subject":    []string{"=?utf-8?q?Gr=C3=BC=C3=9Fe?="},
+	}
+
+	ul.Audit(list, mustParse("mod@example.com"), ulist.DecisionPass, header)
+	ul.Audit(list, nil, ulist.DecisionExpire, header)
+	ul.Audit(list, mustParse("mod@example.com"), ulist.DecisionDelete, nil) // unreadable message
+
+	if count, err := ul.Lists.CountAuditEntries(list); count != 3 || err != nil {
+		t.Fatalf("got %d, %v, want 3, nil", count, err)
+	}
+
+	entries, err := ul.Lists.AuditEntries(list, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+
+	// newest first, offset 1 skips the delete entry
+	got := entries[0]
+	want := ulist.AuditEntry{
+		Time:      got.Time,
+		Moderator: "",
+		Decision:  ulist.DecisionExpire,
+		Subject:   "Grüße",
+		Sender:    "bob@example.com",
+		MessageID: "<original@example.com>",
+	}
+	if got != want {
+		t.Fatalf("got %v, want %v", got, want)
+	}
+	if entries[1].Moderator != "mod@example.com" || entries[1].Decision != ulist.DecisionPass {
+		t.Fatalf("got %v", entries[1])
+	}
+
+	// messages which are rejected by the posting rules are recorded as automatic decisions
+
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject, ulist.Reject)
+	err = transactOne("unknown@example.com", []string{"audit@example.com"},
+		`From: unknown@example.com
+To: audit@example.com
+Message-Id: <rejected@example.com>
+Subject: Hi
+
+Hello`)
+	wantErr(t, err, "SMTP error 550: user not found")
+
+	entries, err = ul.Lists.AuditEntries(list, 0, 1)
+	if err != nil || len(entries) != 1 {
+		t.Fatalf("got %v, %v", entries, err)
+	}
+	if got := entries[0]; got.Moderator != "" || got.Decision != ulist.DecisionReject || got.Sender != "unknown@example.com" || got.MessageID != "<rejected@example.com>" {
+		t.Fatalf("got %v", got)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestModDigest(t *testing.T) {
+
+	ul.CreateList("mod-digest@example.com", "List", "alice@example.com", "testing")
+
+	<-messageChannel // welcome alice
+	<-gdprChannel    // alice
+
+	list, _ := ul.Lists.GetList(mustParse("mod-digest@example.com"))
+	_ = os.RemoveAll(ul.StorageFolder(list.ListInfo)) // from previous test runs
+
+	if err := ul.Lists.UpdateNotifyMode(list, "alice@example.com", ulist.NotifyHourly); err != nil {
+		t.Fatal(err)
+	}
+
+	// no immediate notification
+
+	mustTransactOne("unknown@example.com", []string{"mod-digest@example.com"},
+		`From: unknown@example.com
+To: mod-digest@example.com
+Subject: Hi
+X-Spam-Status: Yes
+
+Hello`)
+
+	wantChansEmpty(t)
+
+	now := time.Now().Add(time.Second) // messages are stored with a resolution of seconds
+
+	if err := ul.SendModDigest(list, ulist.NotifyHourly, now); err != nil {
+		t.Fatal(err)
+	}
+
+	wantMessage(t, "mod-digest+bounces@example.com", []string{"alice@example.com"}, `Content-Type: text/plain; charset=utf-8
+From: "List" <mod-digest@example.com>
+Message-Id: <message-id@example.com>
+Subject: [List] 1 messages need moderation
+To: alice@example.com
+
+1 new messages at "List" <mod-digest@example.com> are waiting for moderation:
+
+* Hi
+  From: unknown@example.com
+  Spam: X-Spam-Status is "yes"
+
+You can moderate them here: https://lists.example.com/mod/mod-digest@example.com
+
+----
+You can leave the mailing list "List" here: https://lists.example.com/leave/mod-digest@example.com`)
+
+	// the interval has not passed yet
+
+	if err := ul.SendModDigest(list, ulist.NotifyHourly, now.Add(30*time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+
+	// no new messages
+
+	if err := ul.SendModDigest(list, ulist.NotifyHourly, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+
+	// daily members get nothing because there are none
+
+	if err := ul.SendModDigest(list, ulist.NotifyDaily, now); err != nil {
+		t.Fatal(err)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestDiscard(t *testing.T) {
+
+	ul.CreateList("discard@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("discard@example.com"))
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Discard, ulist.Discard)
+	ul.Lists.AddKnowns(list, []*ulist.Addr{mustParse("known@example.com"), mustParse("eve@example.com")})
+	ul.Lists.AddBlocked(list, []string{"eve@example.com"})
+
+	// unknown and blocked senders are accepted and dropped
+
+	for _, from := range []string{"unknown@example.com", "eve@example.com"} {
+		mustTransactOne("some_envelope@example.com", []string{"discard@example.com"},
+			`From: `+from+`
+To: discard@example.com
+Subject: Hi
+
+Hello`)
+	}
+
+	wantChansEmpty(t)
+
+	// the maximum action wins: one known sender lets the message pass
+
+	if action, _, err := ul.GetAction(list, nil, []*ulist.Addr{mustParse("unknown@example.com"), mustParse("known@example.com")}); action != ulist.Pass || err != nil {
+		t.Fatalf("got %v, %v, want pass, nil", action, err)
+	}
+
+	// blocked wins over any role
+
+	if action, _, err := ul.GetAction(list, nil, []*ulist.Addr{mustParse("known@example.com"), mustParse("eve@example.com")}); action != ulist.Discard || err != nil {
+		t.Fatalf("got %v, %v, want discard, nil", action, err)
+	}
+
+	if err := ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Discard, ulist.Mod); err == nil {
+		t.Fatal("blocked senders must not be moderated")
+	}
+}
+
+func TestDigest(t *testing.T) {
+
+	ul.CreateList("digest@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("digest@example.com"))
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+	_ = os.RemoveAll(ul.DigestFolder(list.ListInfo)) // from previous test runs
+
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("immediate@example.com"), mustParse("daily@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "immediate@example.com joined the list digest@example.com, reason: testing\n\tdaily@example.com joined the list digest@example.com, reason: testing")
+
+	if err := ul.Lists.UpdateDelivery(list, "daily@example.com", ulist.DeliveryDaily); err != nil {
+		t.Fatal(err)
+	}
+
+	// digest members don't get the message immediately
+
+	mustTransactOne("some_envelope@example.com", []string{"digest@example.com"},
+		`From: immediate@example.com
+To: digest@example.com
+Subject: Hi
+
+Hello`)
+
+	wantMessage(t, "digest+bounces@example.com", []string{"immediate@example.com"}, `From: "immediate via List" <digest@example.com>
+List-Help: <https://lists.example.com/list/digest@example.com>
+List-Id: "List" <digest.example.com>
+List-Owner: <mailto:digest+owner@example.com>
+List-Post: <mailto:digest@example.com>
+List-Unsubscribe: <mailto:digest@example.com?subject=leave>,
+ <https://lists.example.com/leave/digest@example.com>
+Message-Id: <message-id@example.com>
+Precedence: list
+Reply-To: <immediate@example.com>
+Subject: [List] Hi
+To: digest@example.com
+
+Hello
+
+----
+You can leave the mailing list "List" here: https://lists.example.com/leave/digest@example.com`)
+
+	now := time.Now().Add(time.Second) // messages are stored with a resolution of seconds
+
+	if err := ul.SendDigest(list, ulist.DeliveryDaily, now); err != nil {
+		t.Fatal(err)
+	}
+
+	wantMessage(t, "digest+bounces@example.com", []string{"daily@example.com"}, `Content-Type: multipart/mixed;
+ boundary=boundary-0
+From: "List" <digest@example.com>
+List-Help: <https://lists.example.com/list/digest@example.com>
+List-Id: "List" <digest.example.com>
+List-Owner: <mailto:digest+owner@example.com>
+List-Post: <mailto:digest@example.com>
+List-Unsubscribe: <mailto:digest@example.com?subject=leave>,
+ <https://lists.example.com/leave/digest@example.com>
+Message-Id: <message-id@example.com>
+MIME-Version: 1.0
+Precedence: list
+Subject: [List] daily digest, 1 messages
+To: digest@example.com
+
+--boundary-0
+Content-Type: text/plain; charset=utf-8
+
+"List" <digest@example.com>, daily digest
+
+Topics:
+
+1. [List] Hi
+   From: "immediate via List" <digest@example.com>
+
+The messages follow as attachments.
+
+----
+You can leave the mailing list "List" here: https://lists.example.com/leave/digest@example.com
+--boundary-0
+Content-Type: multipart/digest; boundary=boundary-1
+
+--boundary-1
+Content-Type: message/rfc822
+
+From: "immediate via List" <digest@example.com>
+List-Help: <https://lists.example.com/list/digest@example.com>
+List-Id: "List" <digest.example.com>
+List-Owner: <mailto:digest+owner@example.com>
+List-Post: <mailto:digest@example.com>
+List-Unsubscribe: <mailto:digest@example.com?subject=leave>,
+ <https://lists.example.com/leave/digest@example.com>
+Message-Id: <message-id@example.com>
+Precedence: list
+Reply-To: <immediate@example.com>
+Subject: [List] Hi
+To: digest@example.com
+
+Hello
+--boundary-1--
+
+--boundary-0--
+`)
+
+	// the interval has not passed yet, weekly members get nothing because there are none
+
+	if err := ul.SendDigest(list, ulist.DeliveryDaily, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.SendDigest(list, ulist.DeliveryWeekly, now); err != nil {
+		t.Fatal(err)
+	}
+
+	// a message which can't be sent is not stored for the digest, because the MTA will retry it
+
+	storedCount := func() int {
+		entries, err := os.ReadDir(ul.DigestFolder(list.ListInfo))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(entries)
+	}
+	stored := storedCount()
+
+	ul.MTA = failingMTA{}
+	if err := transactOne("some_envelope@example.com", []string{"digest@example.com"},
+		`From: immediate@example.com
+To: digest@example.com
+Subject: Failed
+
+Hello`); err == nil {
+		t.Fatalf("failing MTA has sent the message")
+	}
+	ul.MTA = mailutil.ChanMTA(messageChannel)
+
+	if got := storedCount(); got != stored {
+		t.Fatalf("got %d stored messages, want %d", got, stored)
+	}
+
+	// if all members receive digests, the message is stored but not sent
+
+	if err := ul.Lists.UpdateDelivery(list, "immediate@example.com", ulist.DeliveryDaily); err != nil {
+		t.Fatal(err)
+	}
+
+	mustTransactOne("some_envelope@example.com", []string{"digest@example.com"},
+		`From: immediate@example.com
+To: digest@example.com
+Subject: Stored
+
+Hello`)
+
+	if got := storedCount(); got != stored+1 {
+		t.Fatalf("got %d stored messages, want %d", got, stored+1)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestArchive(t *testing.T) {
+
+	ul.CreateList("archive@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("archive@example.com"))
+	ul.Lists.Update(list, "List", false, true, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject) // hide from
+	ul.Lists.UpdateArchive(list, ulist.ArchivePublic)
+
+	mustTransactOne("some_envelope@example.com", []string{"archive@example.com"},
+		`From: alice@example.com
+To: archive@example.com
+Delivered-To: alice@example.net
+Subject: Hi
+
+Hello`)
+
+	first, err := ul.Archive.ArchivedBetween(list, time.Now().Add(-time.Minute), time.Now().Add(time.Minute))
+	if err != nil || len(first) != 1 {
+		t.Fatalf("got %d archived messages and error %v, want 1", len(first), err)
+	}
+
+	// reply with the Message-Id which the members have received
+
+	mustTransactOne("some_envelope@example.com", []string{"archive@example.com"},
+		`From: bob@example.com
+To: archive@example.com
+Subject: Re: Hi
+In-Reply-To: `+first[0].MessageID+`
+
+Hello back`)
+
+	months, err := ul.Archive.ArchivedMonths(list)
+	if err != nil || len(months) != 1 || months[0].Count != 2 {
+		t.Fatalf("got months %v and error %v, want one month with 2 messages", months, err)
+	}
+
+	thread, err := ul.Archive.ArchivedThread(list, first[0].Thread)
+	if err != nil || len(thread) != 2 {
+		t.Fatalf("got %d messages in thread and error %v, want 2", len(thread), err)
+	}
+
+	// sender addresses are hidden in the archive and in the web interface
+
+	for _, test := range []struct {
+		path string
+		want string
+	}{
+		{"/archive/archive@example.com", "/archive/archive@example.com/" + months[0].String()},
+		{"/archive/archive@example.com/" + months[0].String(), "Re: [List] Hi"},
+		{fmt.Sprintf("/message/archive@example.com/%d", first[0].ID), "Hello"},
+	} {
+		resp, err := http.Get("http://127.0.0.1:65535" + test.path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		page, _ := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if !strings.Contains(string(page), test.want) {
+			t.Fatalf("%s does not contain %s", test.path, test.want)
+		}
+	}
+
+	resp, err := http.Get(fmt.Sprintf("http://127.0.0.1:65535/thread/archive@example.com/%d", first[0].Thread))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(page), "Hello back") {
+		t.Fatalf("thread page does not contain the reply")
+	}
+
+	for _, archived := range thread {
+		for _, leak := range []string{"alice", "bob"} {
+			if strings.Contains(string(archived.Raw), leak) || strings.Contains(archived.From, leak) {
+				t.Fatalf("archived message leaks %s: %s", leak, archived.Raw)
+			}
+		}
+	}
+	if strings.Contains(string(page), "alice") || strings.Contains(string(page), "bob") {
+		t.Fatalf("thread page leaks a sender")
+	}
+
+	// a message which the MTA delivers again after a failure is archived once
+
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "member@example.com joined the list archive@example.com, reason: testing")
+
+	retry := `From: carol@example.com
+To: archive@example.com
+Message-Id: <retry@example.net>
+Subject: Retry
+
+Hello again`
+
+	ul.MTA = failingMTA{}
+	if err := transactOne("some_envelope@example.com", []string{"archive@example.com"}, retry); err == nil {
+		t.Fatalf("failing MTA has sent the message")
+	}
+	ul.MTA = mailutil.ChanMTA(messageChannel)
+
+	mustTransactOne("some_envelope@example.com", []string{"archive@example.com"}, retry)
+	<-messageChannel
+
+	months, err = ul.Archive.ArchivedMonths(list)
+	if err != nil || len(months) != 1 || months[0].Count != 3 {
+		t.Fatalf("got months %v and error %v, want one month with 3 messages", months, err)
+	}
+
+	// members-only archives are not public
+
+	ul.Lists.UpdateArchive(list, ulist.ArchiveMembers)
+
+	resp, err = http.Get(fmt.Sprintf("http://127.0.0.1:65535/thread/archive@example.com/%d", first[0].Thread))
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if strings.Contains(string(page), "Hello back") {
+		t.Fatalf("members-only archive is public")
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestSearch(t *testing.T) {
+
+	ul.CreateList("search@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("search@example.com"))
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+	ul.Lists.UpdateArchive(list, ulist.ArchiveMembers)
+
+	for _, test := range []struct {
+		contentType string
+		body        string
+	}{
+		{"text/plain", "Let's meet for a picnic in the park."},
+		{"text/html", "<p>The <b>picnic</b> is cancelled.</p><style>.picnic {}</style>"},
+		{"text/plain", "Nothing to see here."},
+	} {
+		mustTransactOne("some_envelope@example.com", []string{"search@example.com"},
+			`From: alice@example.com
+To: search@example.com
+Subject: Hi
+Content-Type: `+test.contentType+`
+
+`+test.body)
+	}
+
+	results, err := ul.Archive.Search([]ulist.ListInfo{list.ListInfo}, "PICNIC", time.Time{}, time.Time{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+	for _, result := range results {
+		var highlighted bool
+		for _, fragment := range result.Snippet {
+			if fragment.Match && strings.EqualFold(fragment.Text, "picnic") {
+				highlighted = true
+			}
+		}
+		if !highlighted {
+			t.Fatalf("got snippet %v, want highlighted term", result.Snippet)
+		}
+	}
+
+	// all words must match, dates limit the results
+
+	if results, _ := ul.Archive.Search([]ulist.ListInfo{list.ListInfo}, "picnic park", time.Time{}, time.Time{}, 10); len(results) != 1 {
+		t.Fatalf("got %d results, want 1", len(results))
+	}
+	if results, _ := ul.Archive.Search([]ulist.ListInfo{list.ListInfo}, "picnic", time.Now().Add(time.Hour), time.Time{}, 10); len(results) != 0 {
+		t.Fatalf("got %d results, want 0", len(results))
+	}
+
+	// members-only archives can't be searched anonymously
+
+	resp, err := http.Get("http://127.0.0.1:65535/search?q=picnic&list=search@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if strings.Contains(string(page), "cancelled") {
+		t.Fatalf("members-only archive can be searched anonymously")
+	}
+
+	ul.Lists.UpdateArchive(list, ulist.ArchivePublic)
+
+	resp, err = http.Get("http://127.0.0.1:65535/search?q=picnic&list=search@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ = ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if !strings.Contains(string(page), "<mark>") {
+		t.Fatalf("public archive search has no highlighted results")
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestArchiveImportExport(t *testing.T) {
+
+	ul.CreateList("mbox@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("mbox@example.com"))
+
+	// the second message is a duplicate, the third one replies to the first one
+
+	mbox := `From alice@example.com Sat Jan  1 10:00:00 2022
+From: alice@example.com
+Subject: Old times
+Date: Sat, 01 Jan 2022 10:00:00 +0000
+Message-Id: <old-1@example.com>
+
+>From the archive
+
+From alice@example.com Sat Jan  1 10:00:00 2022
+From: alice@example.com
+Subject: Old times
+Date: Sat, 01 Jan 2022 10:00:00 +0000
+Message-Id: <old-1@example.com>
+
+>From the archive
+
+From bob@example.com Sun Jan  2 10:00:00 2022
+From: bob@example.com
+Subject: Re: Old times
+Date: Sun, 02 Jan 2022 10:00:00 +0000
+Message-Id: <old-2@example.com>
+In-Reply-To: <old-1@example.com>
+
+Indeed
+`
+
+	imported, skipped, err := ul.ImportArchive(list, strings.NewReader(mbox))
+	if err != nil || imported != 2 || skipped != 1 {
+		t.Fatalf("got %d imported, %d skipped and error %v, want 2, 1 and nil", imported, skipped, err)
+	}
+
+	// nothing has been forwarded
+	wantChansEmpty(t)
+
+	messages, err := ul.Archive.ArchivedBetween(list, time.Date(2022, 1, 1, 0, 0, 0, 0, time.UTC), time.Date(2022, 2, 1, 0, 0, 0, 0, time.UTC))
+	if err != nil || len(messages) != 2 {
+		t.Fatalf("got %d archived messages and error %v, want 2", len(messages), err)
+	}
+	if messages[0].Thread != messages[1].Thread {
+		t.Fatalf("reply is not in the thread of the first message")
+	}
+
+	// export and import again
+
+	var exported bytes.Buffer
+	if err := ul.ExportArchive(&exported, list, time.Time{}, time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(exported.String(), "\n>From the archive\n") || strings.Count(exported.String(), "\nFrom ") != 1 {
+		t.Fatalf("got export %q, want two messages with quoted \"From \" line", exported.String())
+	}
+
+	imported, skipped, err = ul.ImportArchive(list, &exported)
+	if err != nil || imported != 0 || skipped != 2 {
+		t.Fatalf("got %d imported, %d skipped and error %v, want 0, 2 and nil", imported, skipped, err)
+	}
+
+	// date range
+
+	exported.Reset()
+	if err := ul.ExportArchive(&exported, list, time.Date(2022, 1, 2, 0, 0, 0, 0, time.UTC), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	if strings.Contains(exported.String(), "From the archive") || !strings.Contains(exported.String(), "Indeed") {
+		t.Fatalf("got export %q, want the second message only", exported.String())
+	}
+
+	// web export is for admins only
+
+	noRedirect := &http.Client{
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	resp, err := noRedirect.Get("http://127.0.0.1:65535/export/mbox@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	page, _ := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+
+	if strings.Contains(string(page), "Indeed") {
+		t.Fatalf("archive can be exported anonymously")
+	}
+}
+
+func TestReplyTo(t *testing.T) {
+
+	ul.CreateList("replyto@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("replyto@example.com"))
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "member@example.com joined the list replyto@example.com, reason: testing")
+
+	for _, test := range []struct {
+		replyTo  ulist.ReplyTo
+		address  string
+		keep     bool
+		hideFrom bool
+		want     string
+	}{
+		{ulist.ReplyToSender, "", false, false, "<alice@example.com>"},
+		{ulist.ReplyToSender, "", true, false, "<alice@example.com>, <alice@example.net>"},
+		{ulist.ReplyToSender, "", true, true, ""},
+		{ulist.ReplyToList, "", false, false, `"List" <replyto@example.com>`},
+		{ulist.ReplyToList, "", true, false, `"List" <replyto@example.com>, <alice@example.net>`},
+		{ulist.ReplyToFixed, "Replies <replies@example.com>", false, false, `"Replies" <replies@example.com>`},
+		{ulist.ReplyToFixed, "Replies <replies@example.com>", true, true, `"Replies" <replies@example.com>`},
+	} {
+		ul.Lists.Update(list, "List", false, test.hideFrom, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+		if err := ul.Lists.UpdateReplyTo(list, test.replyTo, test.address, test.keep); err != nil {
+			t.Fatal(err)
+		}
+
+		mustTransactOne("some_envelope@example.com", []string{"replyto@example.com"},
+			`From: alice@example.com
+To: replyto@example.com
+Reply-To: alice@example.net
+Subject: Hi
+
+Hello`)
+
+		got, err := mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if replyTo := got.Header.Get("Reply-To"); replyTo != test.want {
+			t.Fatalf("%v (keep: %t, hide from: %t): got Reply-To %q, want %q", test.replyTo, test.keep, test.hideFrom, replyTo, test.want)
+		}
+	}
+
+	if err := ul.Lists.UpdateReplyTo(list, ulist.ReplyToFixed, "", false); err == nil {
+		t.Fatalf("fixed Reply-To without address has been accepted")
+	}
+
+	// announce-only
+
+	ul.AddMembers(list, true, []*ulist.Addr{mustParse("mod@example.com")}, false, true, false, false, false, "testing")
+	wantGDPREvent(t, "mod@example.com joined the list replyto@example.com, reason: testing")
+	<-messageChannel // welcome
+
+	if err := ul.SetAnnounceOnly(list, "office@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	err := transactOne("some_envelope@example.com", []string{"replyto@example.com"},
+		`From: alice@example.com
+To: replyto@example.com
+
+`)
+	wantErr(t, err, "SMTP error 550: user not found")
+
+	mustTransactOne("some_envelope@example.com", []string{"replyto@example.com"},
+		`From: mod@example.com
+To: replyto@example.com
+Subject: News
+
+Hello`)
+
+	got, err := mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if replyTo := got.Header.Get("Reply-To"); replyTo != "<office@example.com>" {
+		t.Fatalf("got Reply-To %q, want <office@example.com>", replyTo)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestPostNumbers(t *testing.T) {
+
+	ul.CreateList("numbers@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("numbers@example.com"))
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "member@example.com joined the list numbers@example.com, reason: testing")
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+	if err := ul.Lists.UpdatePrefix(list, "team", false, true); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, test := range []struct {
+		subject string
+		want    string
+	}{
+		{"Hello", "[team 1] Hello"},
+		{"Re: [team 1] Hello", "Re: [team 2] Hello"},
+		{"AW: Re: [team 2] Hello", "Re: [team 3] Hello"},
+	} {
+		mustTransactOne("some_envelope@example.com", []string{"numbers@example.com"},
+			`From: alice@example.com
+To: numbers@example.com
+Subject: `+test.subject+`
+
+Hello`)
+
+		got, err := mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if subject := mailutil.RobustWordDecode(got.Header.Get("Subject")); subject != test.want {
+			t.Fatalf("got subject %q, want %q", subject, test.want)
+		}
+	}
+
+	// a message which the MTA delivers again after failures keeps its number
+
+	retry := `From: alice@example.com
+To: numbers@example.com
+Message-Id: <retry@example.net>
+Subject: Retry
+
+Hello`
+
+	ul.MTA = failingMTA{}
+	for i := 0; i < 2; i++ {
+		if err := transactOne("some_envelope@example.com", []string{"numbers@example.com"}, retry); err == nil {
+			t.Fatalf("failing MTA has sent the message")
+		}
+	}
+	ul.MTA = mailutil.ChanMTA(messageChannel)
+
+	mustTransactOne("some_envelope@example.com", []string{"numbers@example.com"}, retry)
+
+	got, err := mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject := mailutil.RobustWordDecode(got.Header.Get("Subject")); subject != "[team 4] Retry" {
+		t.Fatalf("got subject %q, want %q", subject, "[team 4] Retry")
+	}
+
+	if err := ul.Lists.UpdatePrefix(list, "[team]", false, true); err == nil {
+		t.Fatalf("prefix with square brackets has been accepted")
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestFooterTemplates(t *testing.T) {
+
+	ul.CreateList("footer@example.com", "Team", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("footer@example.com"))
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "member@example.com joined the list footer@example.com, reason: testing")
+	ul.Lists.Update(list, "Team", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+	ul.Lists.UpdateArchive(list, ulist.ArchivePublic)
+	ul.Lists.UpdateFooter(list, "{{ .ListName }} <{{ .ListAddress }}>, archive: {{ .ArchiveURL }}, leave: {{ .LeaveURL }}, contact: {{ .AdminContact }}", "")
+
+	mustTransactOne("some_envelope@example.com", []string{"footer@example.com"},
+		`From: alice@example.com
+To: footer@example.com
+Subject: Hi
+
+Hello`)
+
+	wantMessage(t, "footer+bounces@example.com", []string{"member@example.com"}, `Archived-At: <https://lists.example.com/message/footer@example.com/`+lastArchived(t, list)+`>
+From: "alice via Team" <footer@example.com>
+List-Archive: <https://lists.example.com/archive/footer@example.com>
+List-Help: <https://lists.example.com/list/footer@example.com>
+List-Id: "Team" <footer.example.com>
+List-Owner: <mailto:footer+owner@example.com>
+List-Post: <mailto:footer@example.com>
+List-Unsubscribe: <mailto:footer@example.com?subject=leave>,
+ <https://lists.example.com/leave/footer@example.com>
+Message-Id: <message-id@example.com>
+Precedence: list
+Reply-To: <alice@example.com>
+Subject: [Team] Hi
+To: footer@example.com
+
+Hello
+
+----
+Team <footer@example.com>, archive: https://lists.example.com/archive/footer@example.com, leave: https://lists.example.com/leave/footer@example.com, contact: footer+owner@example.com`)
+
+	// broken templates fall back to the default
+
+	ul.Lists.UpdateFooter(list, "{{ .Unknown }}", "")
+
+	mustTransactOne("some_envelope@example.com", []string{"footer@example.com"},
+		`From: alice@example.com
+To: footer@example.com
+Subject: Hi
+
+Hello`)
+
+	wantMessage(t, "footer+bounces@example.com", []string{"member@example.com"}, `Archived-At: <https://lists.example.com/message/footer@example.com/`+lastArchived(t, list)+`>
+From: "alice via Team" <footer@example.com>
+List-Archive: <https://lists.example.com/archive/footer@example.com>
+List-Help: <https://lists.example.com/list/footer@example.com>
+List-Id: "Team" <footer.example.com>
+List-Owner: <mailto:footer+owner@example.com>
+List-Post: <mailto:footer@example.com>
+List-Unsubscribe: <mailto:footer@example.com?subject=leave>,
+ <https://lists.example.com/leave/footer@example.com>
+Message-Id: <message-id@example.com>
+Precedence: list
+Reply-To: <alice@example.com>
+Subject: [Team] Hi
+To: footer@example.com
+
+Hello
+
+----
+You can leave the mailing list "Team" here: https://lists.example.com/leave/footer@example.com`)
+
+	wantChansEmpty(t)
+}
+
+func TestTemplateOverrides(t *testing.T) {
+
+	ul.CreateList("templates@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("templates@example.com"))
+
+	ul.Lists.SetTemplate(list, "signoff-join.txt", "Hi {{ .MailAddress }}, welcome to {{ .ListAddress }}!\r\n")
+
+	ul.AddMembers(list, true, []*ulist.Addr{mustParse("alice@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "alice@example.com joined the list templates@example.com, reason: testing")
+
+	wantMessage(t, "templates+bounces@example.com", []string{"alice@example.com"}, `Content-Type: text/plain; charset=utf-8
+From: "List" <templates@example.com>
+Message-Id: <message-id@example.com>
+Subject: [List] Welcome
+To: alice@example.com
+
+Hi alice@example.com, welcome to templates@example.com!
+`)
+
+	// broken overrides fall back to the built-in template
+
+	ul.Lists.SetTemplate(list, "signoff-join.txt", "{{ .Unknown }}")
+
+	ul.AddMembers(list, true, []*ulist.Addr{mustParse("bob@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "bob@example.com joined the list templates@example.com, reason: testing")
+
+	wantMessage(t, "templates+bounces@example.com", []string{"bob@example.com"}, `Content-Type: text/plain; charset=utf-8
+From: "List" <templates@example.com>
+Message-Id: <message-id@example.com>
+Subject: [List] Welcome
+To: bob@example.com
+
+Hello bob@example.com,
+
+Welcome to the mailing list templates@example.com.
+
+----
+You can leave the mailing list "List" here: https://lists.example.com/leave/templates@example.com`)
+
+	if names, err := ul.Lists.Templates(list); err != nil || len(names) != 1 {
+		t.Fatalf("got templates %v and error %v, want one", names, err)
+	}
+
+	ul.Lists.SetTemplate(list, "signoff-join.txt", "")
+
+	if names, err := ul.Lists.Templates(list); err != nil || len(names) != 0 {
+		t.Fatalf("got templates %v and error %v, want none", names, err)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestHeaderPrivacy(t *testing.T) {
+
+	ul.CreateList("privacy@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("privacy@example.com"))
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "member@example.com joined the list privacy@example.com, reason: testing")
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+
+	const message = `Received: from [192.0.2.1] (alice.example.net [192.0.2.1]) by mx.example.com
+Return-Path: <alice@example.com>
+Delivered-To: alice@example.com
+X-Originating-IP: [192.0.2.1]
+User-Agent: Alice's Mail 1.0
+X-Mailer: Alice's Mail 1.0
+Disposition-Notification-To: alice@example.com
+From: Alice <alice@example.com>
+To: privacy@example.com
+Cc: Alice Private <alice@example.net>
+Reply-To: alice@example.net
+Sender: alice@example.com
+Organization: Alice Inc.
+X-Custom: alice was here
+In-Reply-To: <123@privacy.example.com>
+Subject: Hi
+Date: Mon, 02 Jan 2006 15:04:05 +0000
+Mime-Version: 1.0
+Content-Type: text/plain; charset=utf-8
+
+Hello`
+
+	// default policy
+
+	if err := ul.Lists.UpdateHeaders(list, "", "X-Static: hello wörld"); err != nil {
+		t.Fatal(err)
+	}
+
+	mustTransactOne("some_envelope@example.com", []string{"privacy@example.com"}, message)
+
+	got, err := mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"Received", "Return-Path", "Delivered-To", "X-Originating-Ip", "User-Agent", "X-Mailer", "Disposition-Notification-To"} {
+		if value := got.Header.Get(key); value != "" {
+			t.Fatalf("header %s has not been removed: %q", key, value)
+		}
+	}
+	for key, want := range map[string]string{
+		"X-Custom":    "alice was here",
+		"In-Reply-To": "<123@privacy.example.com>",
+		"X-Static":    "=?utf-8?q?hello_w=C3=B6rld?=",
+	} {
+		if value := got.Header.Get(key); value != want {
+			t.Fatalf("got header %s %q, want %q", key, value, want)
+		}
+	}
+
+	// custom policy
+
+	if err := ul.Lists.UpdateHeaders(list, "x-custom\nX-Ms-*", ""); err != nil {
+		t.Fatal(err)
+	}
+	if list.StripHeaders != "X-Custom\nX-Ms-*" {
+		t.Fatalf("got strip headers %q", list.StripHeaders)
+	}
+
+	mustTransactOne("some_envelope@example.com", []string{"privacy@example.com"}, message)
+
+	got, err = mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := got.Header.Get("X-Custom"); value != "" {
+		t.Fatalf("header X-Custom has not been removed: %q", value)
+	}
+	if value := got.Header.Get("X-Mailer"); value != "Alice's Mail 1.0" {
+		t.Fatalf("got X-Mailer %q", value)
+	}
+	if value := got.Header.Get("X-Static"); value != "" {
+		t.Fatalf("static header has not been removed: %q", value)
+	}
+
+	// HideFrom must not leak the sender, regardless of the policy
+
+	ul.Lists.Update(list, "List", false, true, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+
+	var forwardedIds []string
+	for _, header := range []string{
+		"Message-Id: <1@alice.example.net>",
+		"Message-Id: <2@alice.example.net>\nIn-Reply-To: <1@alice.example.net>\nReferences: <0@alice.example.net> <1@alice.example.net>",
+	} {
+		mustTransactOne("some_envelope@example.com", []string{"privacy@example.com"}, strings.Replace(message, "In-Reply-To: <123@privacy.example.com>", header, 1))
+
+		raw := (<-messageChannel).Message
+		for _, leak := range []string{"alice", "Alice", "192.0.2.1", "example.net"} {
+			if strings.Contains(raw, leak) {
+				t.Fatalf("forwarded message contains %q:\n%s", leak, raw)
+			}
+		}
+		got, err = mail.ReadMessage(strings.NewReader(raw))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for key, want := range map[string]string{
+			"From": `"List" <privacy@example.com>`,
+			"To":   `"List" <privacy@example.com>`,
+			"Date": "Mon, 02 Jan 2006 15:04:05 +0000",
+		} {
+			if value := got.Header.Get(key); value != want {
+				t.Fatalf("got header %s %q, want %q", key, value, want)
+			}
+		}
+		forwardedIds = append(forwardedIds, got.Header.Get("Message-Id"))
+	}
+
+	// the Message-Ids of the sender are rewritten like the Message-Id of a forwarded message, so the reply refers to the first message
+
+	if value := got.Header.Get("In-Reply-To"); value != forwardedIds[0] {
+		t.Fatalf("got In-Reply-To %q, want %q", value, forwardedIds[0])
+	}
+	if references := strings.Fields(got.Header.Get("References")); len(references) != 2 || references[1] != forwardedIds[0] {
+		t.Fatalf("got References %q, want two Message-Ids ending with %q", references, forwardedIds[0])
+	}
+
+	// Message-Ids which the list has created are kept
+
+	mustTransactOne("some_envelope@example.com", []string{"privacy@example.com"}, strings.Replace(message, "<123@privacy.example.com>", forwardedIds[1], 1))
+
+	got, err = mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if value := got.Header.Get("In-Reply-To"); value != forwardedIds[1] {
+		t.Fatalf("got In-Reply-To %q, want %q", value, forwardedIds[1])
+	}
+
+	// validation
+
+	for _, static := range []string{"From: mallory@example.com", "List-Id: foo", "no colon", "X-Empty:", "Bad Key: value"} {
+		if err := ul.Lists.UpdateHeaders(list, "", static); err == nil {
+			t.Fatalf("static header %q has been accepted", static)
+		}
+	}
+	if err := ul.Lists.UpdateHeaders(list, "Bad:Key", ""); err == nil {
+		t.Fatalf("invalid header key has been accepted")
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestListHeaders(t *testing.T) {
+
+	ul.CreateList("headers@example.com", "List Ü", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("headers@example.com"))
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "member@example.com joined the list headers@example.com, reason: testing")
+	ul.Lists.Update(list, "List Ü", true, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+	ul.Lists.UpdateArchive(list, ulist.ArchiveMembers)
+
+	mustTransactOne("some_envelope@example.com", []string{"headers@example.com"},
+		`From: alice@example.com
+To: headers@example.com
+Subject: Hi
+
+Hello`)
+
+	got, err := mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"Archived-At":      "<https://lists.example.com/message/headers@example.com/" + lastArchived(t, list) + ">",
+		"List-Archive":     "<https://lists.example.com/archive/headers@example.com>",
+		"List-Help":        "<https://lists.example.com/list/headers@example.com>",
+		"List-Id":          "=?utf-8?q?List_=C3=9C?= <headers.example.com>",
+		"List-Owner":       "<mailto:headers+owner@example.com>",
+		"List-Post":        "<mailto:headers@example.com>",
+		"List-Subscribe":   "<mailto:headers@example.com?subject=join>, <https://lists.example.com/join/headers@example.com>",
+		"List-Unsubscribe": "<mailto:headers@example.com?subject=leave>, <https://lists.example.com/leave/headers@example.com>",
+		"Precedence":       "list",
+	} {
+		if value := got.Header.Get(key); value != want {
+			t.Fatalf("got header %s %q, want %q", key, value, want)
+		}
+	}
+
+	// the List-Owner address accepts messages and reaches the admins
+
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("admin@example.com")}, false, false, false, true, false, "testing")
+	wantGDPREvent(t, "admin@example.com joined the list headers@example.com, reason: testing")
+
+	owner := strings.TrimSuffix(strings.TrimPrefix(got.Header.Get("List-Owner"), "<mailto:"), ">")
+	mustTransactOne("some_envelope@example.com", []string{owner},
+		`From: alice@example.com
+To: `+owner+`
+Subject: Question
+
+Hello admins`)
+
+	if envelope := <-messageChannel; !slices.Equal(envelope.EnvelopeTo, []string{"admin@example.com"}) || !strings.Contains(envelope.Message, "Subject: Question") || !strings.Contains(envelope.Message, "Hello admins") {
+		t.Fatalf("got message %v", envelope)
+	}
+
+	// loop detection with the RFC 2919 list identifier
+
+	err = transactOne("some_envelope@example.com", []string{"headers@example.com"},
+		`From: chris@example.com
+To: headers@example.com
+List-Id: Something <HEADERS.example.com>
+Subject: Hi
+
+Hello`)
+	wantErr(t, err, "SMTP error 554: email loop detected: headers@example.com")
+
+	// other lists don't match
+
+	mustTransactOne("some_envelope@example.com", []string{"headers@example.com"},
+		`From: chris@example.com
+To: headers@example.com
+List-Id: <headers.example.net>
+Subject: Hi
+
+Hello`)
+	<-messageChannel
+
+	wantChansEmpty(t)
+}
+
+func TestSublists(t *testing.T) {
+
+	ul.CreateList("umbrella@example.com", "Umbrella", "", "testing")
+	ul.CreateList("team-a@example.com", "Team A", "", "testing")
+	ul.CreateList("team-b@example.com", "Team B", "", "testing")
+	umbrella, _ := ul.Lists.GetList(mustParse("umbrella@example.com"))
+	teamA, _ := ul.Lists.GetList(mustParse("team-a@example.com"))
+	teamB, _ := ul.Lists.GetList(mustParse("team-b@example.com"))
+	ul.Lists.Update(umbrella, "Umbrella", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+
+	ul.AddMembers(umbrella, false, []*ulist.Addr{mustParse("alice@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "alice@example.com joined the list umbrella@example.com, reason: testing")
+	ul.AddMembers(teamA, false, []*ulist.Addr{mustParse("alice@example.com"), mustParse("bob@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "alice@example.com joined the list team-a@example.com, reason: testing\n\tbob@example.com joined the list team-a@example.com, reason: testing")
+	ul.AddMembers(teamA, false, []*ulist.Addr{mustParse("carol@example.com")}, false, false, false, false, false, "testing")
+	wantGDPREvent(t, "carol@example.com joined the list team-a@example.com, reason: testing")
+	ul.AddMembers(teamB, false, []*ulist.Addr{mustParse("dave@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "dave@example.com joined the list team-b@example.com, reason: testing")
+
+	// umbrella includes team A, team A includes team B
+
+	if err := ul.Lists.AddSublist(umbrella, teamA); err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.Lists.AddSublist(teamA, teamB); err != nil {
+		t.Fatal(err)
+	}
+
+	// cycles
+
+	for _, test := range []struct{ list, sublist *ulist.List }{
+		{umbrella, umbrella},
+		{teamA, umbrella},
+		{teamB, umbrella},
+		{teamB, teamA},
+	} {
+		if err := ul.Lists.AddSublist(test.list, test.sublist); err != ulist.ErrSublistCycle {
+			t.Fatalf("including %s in %s: got %v, want %v", test.sublist, test.list, err, ulist.ErrSublistCycle)
+		}
+	}
+
+	sublists, err := ul.Lists.Sublists(umbrella)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(sublists) != 1 || sublists[0].ID != teamA.ID {
+		t.Fatalf("got sublists %v", sublists)
+	}
+
+	// alice gets one message, carol doesn't receive messages
+
+	mustTransactOne("some_envelope@example.com", []string{"umbrella@example.com"},
+		`From: erin@example.com
+To: umbrella@example.com
+Subject: Hi
+
+Hello`)
+
+	got := <-messageChannel
+	if want := []string{"alice@example.com", "bob@example.com", "dave@example.com"}; !slices.Equal(got.EnvelopeTo, want) {
+		t.Fatalf("got recipients %v, want %v", got.EnvelopeTo, want)
+	}
+
+	// alice receives digests from the umbrella list, but gets each message immediately through team A, so she is left out of the digest
+
+	if err := ul.Lists.UpdateDelivery(umbrella, "alice@example.com", ulist.DeliveryDaily); err != nil {
+		t.Fatal(err)
+	}
+	digestReceivers, err := ul.Lists.DigestReceivers(umbrella, ulist.DeliveryDaily)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(digestReceivers) != 0 {
+		t.Fatalf("got digest receivers %v, want none", digestReceivers)
+	}
+	receivers, err := ul.Lists.Receivers(umbrella)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice@example.com", "bob@example.com", "dave@example.com"}; !slices.Equal(receivers, want) {
+		t.Fatalf("got receivers %v, want %v", receivers, want)
+	}
+
+	// removing
+
+	if err := ul.Lists.RemoveSublist(teamA, teamB); err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.Lists.AddSublist(teamB, umbrella); err != nil {
+		t.Fatalf("no cycle any more, got %v", err)
+	}
+
+	receivers, err = ul.Lists.Receivers(umbrella)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{"alice@example.com", "bob@example.com"}; !slices.Equal(receivers, want) {
+		t.Fatalf("got receivers %v, want %v", receivers, want)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestAliases(t *testing.T) {
+
+	ul.CreateList("aliases@example.com", "List", "", "testing")
+	list, _ := ul.Lists.GetList(mustParse("aliases@example.com"))
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("member@example.com")}, true, false, false, false, false, "testing")
+	wantGDPREvent(t, "member@example.com joined the list aliases@example.com, reason: testing")
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+
+	if err := ul.Lists.UpdateAliases(list, []*ulist.Addr{mustParse("info@old.example.net"), mustParse("info@new.example.net"), mustParse("aliases@example.com")}); err != nil {
+		t.Fatal(err)
+	}
+
+	aliases, err := ul.Lists.Aliases(list)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := mailutil.RFC5322AddrSpecs(aliases); !slices.Equal(got, []string{"info@new.example.net", "info@old.example.net"}) {
+		t.Fatalf("got aliases %v", got)
+	}
+
+	if isList, err := ul.Lists.IsList(*mustParse("info@old.example.net")); !isList || err != nil {
+		t.Fatalf("alias is not recognized: %t, %v", isList, err)
+	}
+
+	if got, err := ul.Lists.GetList(mustParse("info@old.example.net")); err != nil || got == nil || got.ID != list.ID || got.RFC5322AddrSpec() != "aliases@example.com" {
+		t.Fatalf("got list %v, %v", got, err)
+	}
+
+	// the alias is accepted in To or Cc, forwarded messages use the canonical address
+
+	mustTransactOne("some_envelope@example.com", []string{"info@old.example.net"},
+		`From: alice@example.com
+Cc: info@old.example.net
+Subject: Hi
+
+Hello`)
+
+	got, err := mail.ReadMessage(strings.NewReader((<-messageChannel).Message))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string]string{
+		"From":    `"alice via List" <aliases@example.com>`,
+		"List-Id": `"List" <aliases.example.com>`,
+	} {
+		if value := got.Header.Get(key); value != want {
+			t.Fatalf("got header %s %q, want %q", key, value, want)
+		}
+	}
+
+	err = transactOne("some_envelope@example.com", []string{"info@old.example.net"},
+		`From: alice@example.com
+To: info@other.example.net
+Subject: Hi
+
+Hello`)
+	wantErr(t, err, "SMTP error 541: list address aliases@example.com is not in To or Cc")
+
+	// conflicts
+
+	ul.CreateList("aliases-other@example.com", "Other", "", "testing")
+	other, _ := ul.Lists.GetList(mustParse("aliases-other@example.com"))
+
+	for _, alias := range []string{"info@old.example.net", "aliases@example.com", "foo+bounces@example.com"} {
+		if err := ul.Lists.UpdateAliases(other, []*ulist.Addr{mustParse(alias)}); err == nil {
+			t.Fatalf("alias %s has been accepted", alias)
+		}
+	}
+
+	if _, err := ul.Lists.Create("info@new.example.net", "Alias"); err == nil {
+		t.Fatalf("list with the address of an alias has been created")
+	}
+
+	// removing
+
+	if err := ul.Lists.UpdateAliases(list, nil); err != nil {
+		t.Fatal(err)
+	}
+	if isList, _ := ul.Lists.IsList(*mustParse("info@old.example.net")); isList {
+		t.Fatalf("removed alias is still recognized")
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestRenameList(t *testing.T) {
+
+	ul.CreateList("rename-old@example.com", "List", "alice@example.com", "testing")
+	<-messageChannel // welcome alice
+	wantGDPREvent(t, "alice@example.com joined the list rename-old@example.com, reason: testing")
+
+	list, _ := ul.Lists.GetList(mustParse("rename-old@example.com"))
+	ul.Lists.AddKnowns(list, []*ulist.Addr{mustParse("known@example.com")})
+	id := list.ID
+
+	if err := ul.RenameList(list, "rename-new@example.net", true, "testing"); err != nil {
+		t.Fatal(err)
+	}
+
+	wantGDPREvent(t, "alice@example.com is a member of the list rename-new@example.net, which has been renamed from rename-old@example.com, reason: testing")
+	wantMessage(t, "rename-new+bounces@example.net", []string{"alice@example.com"}, "Content-Type: text/plain; charset=utf-8\nFrom: \"List\" <rename-new@example.net>\nMessage-Id: <message-id@example.net>\nSubject: [List] New list address\nTo: alice@example.com\n\nThe mailing list rename-old@example.com has a new address: rename-new@example.net\n\nMessages to the old address still reach the list, but please use the new address from now on. If you filter messages from the list, you might have to adjust your filters.\n\nThis is an automatic message.")
+
+	renamed, err := ul.Lists.GetList(mustParse("rename-new@example.net"))
+	if err != nil || renamed == nil || renamed.ID != id {
+		t.Fatalf("got list %v, %v", renamed, err)
+	}
+	if members, _ := ul.Lists.Members(renamed); len(members) != 1 {
+		t.Fatalf("got %d members, want 1", len(members))
+	}
+	if knowns, _ := ul.Lists.Knowns(renamed); !slices.Equal(knowns, []string{"known@example.com"}) {
+		t.Fatalf("got knowns %v", knowns)
+	}
+
+	// the old address is an alias now
+
+	if old, _ := ul.Lists.GetList(mustParse("rename-old@example.com")); old == nil || old.RFC5322AddrSpec() != "rename-new@example.net" {
+		t.Fatalf("old address doesn't point to the renamed list: %v", old)
+	}
+
+	// rename back, the alias becomes the address again
+
+	if err := ul.RenameList(renamed, "rename-old@example.com", false, "testing"); err != nil {
+		t.Fatal(err)
+	}
+	wantGDPREvent(t, "alice@example.com is a member of the list rename-old@example.com, which has been renamed from rename-new@example.net, reason: testing")
+	<-messageChannel // notice
+
+	if isList, _ := ul.Lists.IsList(*mustParse("rename-new@example.net")); isList {
+		t.Fatalf("address has been kept although keepAlias is false")
+	}
+
+	// conflicts
+
+	ul.CreateList("rename-other@example.com", "Other", "", "testing")
+	for _, address := range []string{"rename-other@example.com", "rename-old@example.com", "rename+bounces@example.com", "invalid"} {
+		if err := ul.RenameList(renamed, address, false, "testing"); err == nil {
+			t.Fatalf("rename to %s has been accepted", address)
+		}
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestListTemplates(t *testing.T) {
+
+	ul.CreateList("tmpl-source@example.com", "Source", "", "testing")
+	source, _ := ul.Lists.GetList(mustParse("tmpl-source@example.com"))
+	ul.Lists.Update(source, "Source", true, true, ulist.Pass, ulist.Mod, ulist.Pass, ulist.Reject, ulist.Discard)
+	ul.Lists.UpdateFooter(source, "Footer of {{ .ListName }}", "")
+	ul.Lists.SetTemplate(source, "signoff-join.txt", "Welcome to {{ .ListAddress }}!\r\n")
+	ul.Lists.AddKnowns(source, []*ulist.Addr{mustParse("known@example.com")})
+	ul.AddMembers(source, false, []*ulist.Addr{mustParse("alice@example.com")}, true, true, false, false, false, "testing")
+	wantGDPREvent(t, "alice@example.com joined the list tmpl-source@example.com, reason: testing")
+	ul.Lists.UpdateDelivery(source, "alice@example.com", ulist.DeliveryWeekly)
+	ul.Lists.UpdateModeration(source, true, 7, false, true)
+	ul.Lists.UpdateArchive(source, ulist.ArchiveMembers)
+	ul.Lists.UpdateReplyTo(source, ulist.ReplyToFixed, "replies@example.com", false)
+	ul.Lists.UpdatePrefix(source, "Src", false, true)
+	ul.Lists.UpdateHeaders(source, "", "X-Custom: yes")
+	ul.CreateList("tmpl-sub@example.com", "Sub", "", "testing")
+	sub, _ := ul.Lists.GetList(mustParse("tmpl-sub@example.com"))
+	ul.Lists.AddSublist(source, sub)
+
+	// save and load a template
+
+	tmpl, err := ul.NewListTemplate(source, " semester ")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.Lists.SaveListTemplate(tmpl); err != nil {
+		t.Fatal(err)
+	}
+	if names, _ := ul.Lists.ListTemplates(); !slices.Equal(names, []string{"semester"}) {
+		t.Fatalf("got template names %v", names)
+	}
+	loaded, err := ul.Lists.GetListTemplate("semester")
+	if err != nil || loaded == nil {
+		t.Fatalf("got template %v, %v", loaded, err)
+	}
+	if missing, _ := ul.Lists.GetListTemplate("missing"); missing != nil {
+		t.Fatalf("got template %v, want nil", missing)
+	}
+
+	// create from template
+
+	list, added, errs := ul.CreateListFromTemplate("tmpl-new@example.com", "New", "bob@example.com", loaded, "testing")
+	if added != 1 || len(errs) > 0 {
+		t.Fatalf("got %d added, errors %v", added, errs)
+	}
+	wantGDPREvent(t, "bob@example.com joined the list tmpl-new@example.com, reason: testing")
+	wantMessage(t, "tmpl-new+bounces@example.com", []string{"bob@example.com"}, "Content-Type: text/plain; charset=utf-8\nFrom: \"New\" <tmpl-new@example.com>\nMessage-Id: <message-id@example.com>\nSubject: [New] Welcome\nTo: bob@example.com\n\nWelcome to tmpl-new@example.com!\n")
+
+	list, _ = ul.Lists.GetList(mustParse("tmpl-new@example.com"))
+	if !list.PublicSignup || !list.HideFrom || list.ActionMember != ulist.Mod || list.ActionUnknown != ulist.Reject || list.ActionBlocked != ulist.Discard || list.FooterPlain != "Footer of {{ .ListName }}" {
+		t.Fatalf("template has not been applied: %+v", list)
+	}
+	if knowns, _ := ul.Lists.Knowns(list); len(knowns) != 0 {
+		t.Fatalf("got knowns %v, want none", knowns)
+	}
+
+	// clone with knowns and members
+
+	clone, added, errs := ul.CloneList(source, "tmpl-clone@example.com", "Clone", "", true, true, "testing")
+	if clone == nil || added != 1 || len(errs) > 0 {
+		t.Fatalf("got list %v, %d added, errors %v", clone, added, errs)
+	}
+	wantGDPREvent(t, "alice@example.com joined the list tmpl-clone@example.com, reason: testing")
+	<-messageChannel // welcome alice
+
+	if knowns, _ := ul.Lists.Knowns(clone); !slices.Equal(knowns, []string{"known@example.com"}) {
+		t.Fatalf("got knowns %v", knowns)
+	}
+	m, _ := ul.Lists.GetMembership(clone, mustParse("alice@example.com"))
+	if !m.Member || !m.Receive || !m.Moderate || m.Admin || m.Delivery != ulist.DeliveryWeekly {
+		t.Fatalf("membership has not been copied: %+v", m)
+	}
+	if src, _ := ul.Lists.GetTemplate(clone, "signoff-join.txt"); src != "Welcome to {{ .ListAddress }}!\r\n" {
+		t.Fatalf("got notification template %q", src)
+	}
+
+	// all other settings are cloned too
+
+	clone, _ = ul.Lists.GetList(mustParse("tmpl-clone@example.com"))
+	if !clone.HeldNotice || clone.ModExpiry != 7 || !clone.ExpiryNotifyMods || clone.Archive != ulist.ArchiveMembers || clone.ReplyTo != ulist.ReplyToFixed || clone.ReplyToAddress != source.ReplyToAddress || clone.Prefix != "Src" || !clone.PostNumbers || clone.StaticHeaders != source.StaticHeaders {
+		t.Fatalf("settings have not been cloned: %+v", clone)
+	}
+	if sublists, _ := ul.Lists.Sublists(clone); len(sublists) != 1 || sublists[0].ID != sub.ID {
+		t.Fatalf("got sublists %v, want %v", sublists, sub)
+	}
+
+	// a template which can't be applied leaves no list behind
+
+	loaded.LimitAction = ulist.Pass
+	if list, _, errs := ul.CreateListFromTemplate("tmpl-invalid@example.com", "Invalid", "", loaded, "testing"); list != nil || len(errs) == 0 {
+		t.Fatalf("got list %v, errors %v, want an error", list, errs)
+	}
+	if list, err := ul.Lists.GetList(mustParse("tmpl-invalid@example.com")); list != nil || err != nil {
+		t.Fatalf("got list %v, %v, want nil, nil", list, err)
+	}
+
+	// remove
+
+	ul.Lists.RemoveListTemplate("semester")
+	if names, _ := ul.Lists.ListTemplates(); len(names) != 0 {
+		t.Fatalf("got template names %v, want none", names)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestCompose(t *testing.T) {
+
+	ul.CreateList("compose@example.com", "List", "alice@example.com", "testing")
+	<-messageChannel // welcome alice
+	wantGDPREvent(t, "alice@example.com joined the list compose@example.com, reason: testing")
+
+	list, _ := ul.Lists.GetList(mustParse("compose@example.com"))
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Mod, ulist.Reject, ulist.Reject)
+	os.RemoveAll(ul.ScheduledFolder(list.ListInfo)) // leftovers of a failed run
+
+	// moderator posts immediately
+
+	m, err := list.Compose(mustParse("Alice <alice@example.com>"), "Hellö", "Hi\nall", []ulist.Attachment{{Filename: "notes.txt", ContentType: "text/plain", Data: []byte("some notes")}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if action, err := ul.Post(list, m); action != ulist.Pass || err != nil {
+		t.Fatalf("got %s, %v, want pass", action, err)
+	}
+
+	envelope := <-messageChannel
+	for _, want := range []string{"From: \"Alice via List\" <compose@example.com>", "Subject: =?utf-8?q?[List]_Hell=C3=B6?=", "Hi\r\nall", "Content-Disposition: attachment; filename=notes.txt"} {
+		if !strings.Contains(envelope.Message, want) {
+			t.Fatalf("message %q does not contain %q", envelope.Message, want)
+		}
+	}
+
+	// admins who don't moderate can post like moderators, even if messages of members are moderated
+
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Mod, ulist.Mod, ulist.Reject, ulist.Reject)
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("carol@example.com")}, false, false, false, true, false, "testing")
+	wantGDPREvent(t, "carol@example.com joined the list compose@example.com, reason: testing")
+
+	m, _ = list.Compose(mustParse("carol@example.com"), "From the admin", "hi", nil)
+	if action, err := ul.Post(list, m); action != ulist.Pass || err != nil {
+		t.Fatalf("got %s, %v, want pass", action, err)
+	}
+	if envelope := <-messageChannel; !strings.Contains(envelope.Message, "Subject: [List] From the admin") {
+		t.Fatalf("got message %q", envelope.Message)
+	}
+
+	// admins are treated like moderators only in the compose form
+
+	if action, _, err := ul.GetAction(list, nil, []*ulist.Addr{mustParse("carol@example.com")}); action != ulist.Mod || err != nil {
+		t.Fatalf("got %s, %v, want mod", action, err)
+	}
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Mod, ulist.Reject, ulist.Reject)
+
+	// unknown senders are rejected
+
+	m, _ = list.Compose(mustParse("mallory@example.com"), "Spam", "spam", nil)
+	if _, err := ul.Post(list, m); err != ulist.ErrPostRejected {
+		t.Fatalf("got %v, want ErrPostRejected", err)
+	}
+
+	if _, err := list.Compose(mustParse("alice@example.com"), " ", "no subject", nil); err == nil {
+		t.Fatalf("message without subject has been composed")
+	}
+
+	// scheduled
+
+	var now = time.Now()
+
+	m, _ = list.Compose(mustParse("alice@example.com"), "Later", "later", nil)
+	if err := ul.Schedule(list, m, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	posts, err := ul.ScheduledPosts(list)
+	if err != nil || len(posts) != 1 || posts[0].Subject != "Later" || posts[0].From != "alice@example.com" {
+		t.Fatalf("got scheduled posts %v, %v", posts, err)
+	}
+
+	if sent, err := ul.SendScheduled(list, now); sent != 0 || err != nil {
+		t.Fatalf("got %d sent, %v, want 0", sent, err)
+	}
+	if sent, err := ul.SendScheduled(list, now.Add(2*time.Hour)); sent != 1 || err != nil {
+		t.Fatalf("got %d sent, %v, want 1", sent, err)
+	}
+	if envelope := <-messageChannel; !strings.Contains(envelope.Message, "Subject: [List] Later") {
+		t.Fatalf("got message %q", envelope.Message)
+	}
+	if posts, _ := ul.ScheduledPosts(list); len(posts) != 0 {
+		t.Fatalf("got scheduled posts %v, want none", posts)
+	}
+
+	// the sender is notified if a scheduled message is rejected at send time
+
+	m, _ = list.Compose(mustParse("bob@example.com"), "Rejected", "rejected", nil)
+	if err := ul.Schedule(list, m, now.Add(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if sent, err := ul.SendScheduled(list, now.Add(2*time.Hour)); sent != 0 || err != nil {
+		t.Fatalf("got %d sent, %v, want 0", sent, err)
+	}
+	wantMessage(t, "compose+bounces@example.com", []string{"bob@example.com"}, fmt.Sprintf(`Content-Type: text/plain; charset=utf-8
+From: "List" <compose@example.com>
+Message-Id: <message-id@example.com>
+Subject: [List] Your scheduled message has not been sent
+To: bob@example.com
+
+Your message to the mailing list compose@example.com with the subject "Rejected" was scheduled for %s, but it has not been sent: the list does not accept messages from this sender.
+
+It has been removed from the schedule. If you still want to send it, please compose it again.
+
+This is an automatic message.`, time.Unix(now.Add(time.Hour).Unix(), 0).Format("2006-01-02 15:04")))
+	if posts, _ := ul.ScheduledPosts(list); len(posts) != 0 {
+		t.Fatalf("got scheduled posts %v, want none", posts)
+	}
+
+	// cancel
+
+	ul.Schedule(list, m, now.Add(time.Hour))
+	posts, _ = ul.ScheduledPosts(list)
+	if err := ul.CancelScheduled(list, posts[0].Filename); err != nil {
+		t.Fatal(err)
+	}
+	if err := ul.CancelScheduled(list, "../compose"); err == nil {
+		t.Fatalf("invalid filename has been accepted")
+	}
+	if posts, _ := ul.ScheduledPosts(list); len(posts) != 0 {
+		t.Fatalf("got scheduled posts %v, want none", posts)
+	}
+
+	wantChansEmpty(t)
+}
+
+func TestRateLimit(t *testing.T) {
+
+	ul.CreateList("ratelimit@example.com", "List", "alice@example.com", "testing")
+	<-messageChannel // welcome alice
+	wantGDPREvent(t, "alice@example.com joined the list ratelimit@example.com, reason: testing")
+
+	list, _ := ul.Lists.GetList(mustParse("ratelimit@example.com"))
+	ul.Lists.Update(list, "List", false, false, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Reject)
+
+	for _, invalid := range [][]int{{-1, 0}, {0, -1}} {
+		if err := ul.Lists.UpdateRateLimit(list, invalid[0], invalid[1], ulist.Mod); err == nil {
+			t.Fatalf("negative rate limit has been accepted")
+		}
+	}
+	if err := ul.Lists.UpdateRateLimit(list, 2, 0, ulist.Pass); err == nil {
+		t.Fatalf("pass has been accepted as rate limit action")
+	}
+	if err := ul.Lists.UpdateRateLimit(list, 2, 0, ulist.Mod); err != nil {
+		t.Fatal(err)
+	}
+
+	// a moderator who gets hourly digests is not notified immediately
+
+	ul.AddMembers(list, false, []*ulist.Addr{mustParse("dave@example.com")}, false, true, true, false, false, "testing")
+	wantGDPREvent(t, "dave@example.com joined the list ratelimit@example.com, reason: testing")
+	ul.Lists.UpdateNotifyMode(list, "dave@example.com", ulist.NotifyHourly)
+
+	post := func() (ulist.Action, error) {
+		m, _ := list.Compose(mustParse("bob@example.com"), "Flood", "flood", nil)
+		return ul.Post(list, m)
+	}
+
+	// a message which can't be sent is not counted
+
+	ul.MTA = failingMTA{}
+	if _, err := post(); err == nil {
+		t.Fatalf("failing MTA has sent the message")
+	}
+	ul.MTA = mailutil.ChanMTA(messageChannel)
+
+	// two messages pass
+
+	for i := 0; i < 2; i++ {
+		if action, err := post(); action != ulist.Pass || err != nil {
+			t.Fatalf("got %s, %v, want pass", action, err)
+		}
+		<-messageChannel
+	}
+
+	// the third one is moderated, and the moderators are notified once
+
+	if action, err := post(); action != ulist.Mod || err != nil {
+		t.Fatalf("got %s, %v, want mod", action, err)
+	}
+	if envelope := <-messageChannel; !slices.Equal(envelope.EnvelopeTo, []string{"alice@example.com"}) || !strings.Contains(envelope.Message, "Subject: [List] A sender has reached the rate limit") || !strings.Contains(envelope.Message, "bob@example.com has reached the limit of 2 messages per hour") {
+		t.Fatalf("got message %v", envelope)
+	}
+	<-messageChannel // moderation notification
+
+	if action, err := post(); action != ulist.Mod || err != nil {
+		t.Fatalf("got %s, %v, want mod", action, err)
+	}
+	<-messageChannel // moderation notification only
+
+	counts, err := ul.Lists.PostCounts(list, time.Now())
+	if err != nil || len(counts) != 1 || counts[0] != (ulist.PostCount{Sender: "bob@example.com", Hour: 2, Day: 2}) {
+		t.Fatalf("got counts %v, %v", counts, err)
+	}
+
+	// daily limit with rejection
+
+	ul.Lists.UpdateRateLimit(list, 0, 2, ulist.Reject)
+	if action, err := post(); action != ulist.Reject || err != ulist.ErrPostRejected {
+		t.Fatalf("got %s, %v, want reject", action, err)
+	}
+
+	// other senders are not affected
+
+	m, _ := list.Compose(mustParse("carol@example.com"), "Hi", "hi", nil)
+	if action, err := ul.Post(list, m); action != ulist.Pass || err != nil {
+		t.Fatalf("got %s, %v, want pass", action, err)
+	}
+	<-messageChannel
+
+	filenames, _ := ul.StoredFilenames(list, -1)
+	for _, filename := range filenames {
+		ul.DeleteModeratedMail(list, filename)
+	}
+
+	wantChansEmpty(t)
+}
+
+// failingMTA fails to send any message.
+type failingMTA struct{}
+
+func (failingMTA) Send(envelopeFrom string, envelopeTo []string, header mail.Header, body io.Reader) error {
+	return errors.New("connection refused")
+}
+
+func (failingMTA) String() string {
+	return "failing MTA"
+}
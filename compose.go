@@ -0,0 +1,312 @@
+package ulist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/wansing/ulist/mailutil"
+	"github.com/wansing/ulist/txt"
+)
+
+// ErrPostRejected is returned if the list rejects or discards a composed message.
+var ErrPostRejected = errors.New("the list does not accept messages from this sender")
+
+// Attachment is a file which is attached to a composed message.
+type Attachment struct {
+	Filename    string
+	ContentType string // empty means application/octet-stream
+	Data        []byte
+}
+
+// ScheduledPost is a composed message which waits for its send time.
+type ScheduledPost struct {
+	Filename string
+	Time     time.Time
+	From     string // address
+	Subject  string
+}
+
+// Compose creates a message from the compose form of the web interface. The sender must have been authenticated by the caller.
+func (list *List) Compose(from *Addr, subject, text string, attachments []Attachment) (*mailutil.Message, error) {
+
+	if strings.TrimSpace(subject) == "" {
+		return nil, errors.New("subject is empty")
+	}
+
+	// normalize line endings to CRLF
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\n", "\r\n")
+
+	textPart := &mailutil.Part{
+		Header:    make(textproto.MIMEHeader),
+		MediaType: "text/plain",
+		Params:    make(map[string]string),
+	}
+	textPart.SetText(text)
+
+	root := textPart
+	if len(attachments) > 0 {
+		root = &mailutil.Part{
+			Header:    make(textproto.MIMEHeader),
+			MediaType: "multipart/mixed",
+			Params:    make(map[string]string),
+			Parts:     []*mailutil.Part{textPart},
+		}
+		for _, a := range attachments {
+			mediaType, params, err := mime.ParseMediaType(a.ContentType)
+			if err != nil {
+				mediaType, params = "application/octet-stream", nil
+			}
+			part := &mailutil.Part{
+				Header:    make(textproto.MIMEHeader),
+				MediaType: mediaType,
+				Params:    params,
+				Body:      a.Data,
+			}
+			part.Header.Set("Content-Type", mime.FormatMediaType(mediaType, params))
+			part.Header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filepath.Base(a.Filename)}))
+			root.Parts = append(root.Parts, part)
+		}
+	}
+
+	m := mailutil.NewMessage()
+	m.Header["Date"] = []string{time.Now().Format(time.RFC1123Z)}
+	m.Header["From"] = []string{from.RFC5322NameAddr()}
+	m.Header["Message-Id"] = []string{list.NewMessageId()}
+	m.Header["Mime-Version"] = []string{"1.0"}
+	m.Header["Subject"] = []string{mime.QEncoding.Encode("utf-8", subject)}
+	m.Header["To"] = []string{list.RFC5322NameAddr()}
+
+	if err := m.SetParts(root); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Post processes a composed message like a message which has been received over LMTP: depending on the sender in "From", it is forwarded or held for moderation. Admins are treated like moderators. If the list rejects or discards messages from the sender, ErrPostRejected is returned.
+func (u *Ulist) Post(list *List, m *mailutil.Message) (Action, error) {
+
+	froms, err := mailutil.ParseAddressesFromHeader(m.Header, "From", 10)
+	if err != nil {
+		return Reject, err
+	}
+	if len(froms) == 0 {
+		return Reject, errors.New(`no "From" addresses given`)
+	}
+
+	action, reason, err := u.getAction(list, m.Header, froms, true)
+	if err != nil {
+		return Reject, err
+	}
+
+	log.Printf("composed message to %s, action: %s, reason: %s", list, action, reason)
+
+	switch action {
+	case Pass:
+		if err := u.Forward(list, m); err != nil {
+			return action, err
+		}
+	case Mod:
+		if err := u.Save(list, m); err != nil {
+			return action, err
+		}
+		notifieds, err := u.Lists.NotifiedsWithMode(list, NotifyImmediate)
+		if err != nil {
+			return action, err
+		}
+		if err := u.NotifyMods(list, notifieds); err != nil {
+			log.Printf("error sending moderation notification: %v", err)
+		}
+	default:
+		if action == Reject {
+			u.Audit(list, nil, DecisionReject, m.Header)
+		}
+		return action, ErrPostRejected
+	}
+
+	return action, nil
+}
+
+// ScheduledFolder contains the composed messages of a list which are sent later. The send time is the prefix of the filename.
+func (u *Ulist) ScheduledFolder(li ListInfo) string {
+	return filepath.Join(u.SpoolDir, "scheduled", strconv.Itoa(li.ID))
+}
+
+// Schedule stores a composed message, so it is posted at the given time.
+func (u *Ulist) Schedule(list *List, m *mailutil.Message, at time.Time) error {
+
+	if err := os.MkdirAll(u.ScheduledFolder(list.ListInfo), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(u.ScheduledFolder(list.ListInfo), fmt.Sprintf("%010d-*.eml", at.Unix()))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := m.Save(file); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return file.Close()
+}
+
+// ScheduledPosts returns the scheduled messages of the list, next first.
+func (u *Ulist) ScheduledPosts(list *List) ([]ScheduledPost, error) {
+
+	entries, err := os.ReadDir(u.ScheduledFolder(list.ListInfo))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var posts []ScheduledPost
+	for _, entry := range entries {
+		at, ok := StoredTime(entry.Name())
+		if !ok {
+			continue
+		}
+		post := ScheduledPost{
+			Filename: entry.Name(),
+			Time:     at,
+		}
+		if file, err := os.Open(filepath.Join(u.ScheduledFolder(list.ListInfo), entry.Name())); err == nil {
+			if msg, err := mail.ReadMessage(file); err == nil {
+				if from, ok := mailutil.SingleFrom(msg.Header); ok {
+					post.From = from.RFC5322AddrSpec()
+				}
+				post.Subject = mailutil.RobustWordDecode(msg.Header.Get("Subject"))
+			}
+			file.Close()
+		}
+		posts = append(posts, post)
+	}
+
+	sort.Slice(posts, func(i, j int) bool {
+		return posts[i].Filename < posts[j].Filename
+	})
+	return posts, nil
+}
+
+// CancelScheduled removes a scheduled message.
+func (u *Ulist) CancelScheduled(list *List, filename string) error {
+	if filename == "" || strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+		return errors.New("invalid filename")
+	}
+	return os.Remove(filepath.Join(u.ScheduledFolder(list.ListInfo), filename))
+}
+
+// SendScheduled posts the scheduled messages whose send time has come. The posting rules are checked again, because the sender could have lost the permission in the meantime. A message is removed even if it is rejected, so it isn't tried again. Then the sender is notified.
+func (u *Ulist) SendScheduled(list *List, now time.Time) (int, error) {
+
+	posts, err := u.ScheduledPosts(list)
+	if err != nil {
+		return 0, err
+	}
+
+	var sent = 0
+	for _, post := range posts {
+
+		if post.Time.After(now) {
+			break // sorted
+		}
+
+		path := filepath.Join(u.ScheduledFolder(list.ListInfo), post.Filename)
+		file, err := os.Open(path)
+		if err != nil {
+			return sent, err
+		}
+		m, err := mailutil.ReadMessage(file)
+		file.Close()
+		if err != nil {
+			return sent, err
+		}
+
+		m.Header["Date"] = []string{now.Format(time.RFC1123Z)}
+
+		// remove first, so a failing MTA doesn't cause repeated posts
+		if err := os.Remove(path); err != nil {
+			return sent, err
+		}
+
+		if _, err := u.Post(list, m); err != nil {
+			log.Printf("error posting scheduled message %s to %s: %v", post.Filename, list, err)
+			if err := u.notifyScheduledFailed(list, post, err); err != nil {
+				log.Printf("error notifying sender of scheduled message %s: %v", post.Filename, err)
+			}
+			continue
+		}
+		sent++
+	}
+
+	return sent, nil
+}
+
+// notifyScheduledFailed tells the sender of a scheduled message that it has not been sent.
+func (u *Ulist) notifyScheduledFailed(list *List, post ScheduledPost, postErr error) error {
+
+	if post.From == "" {
+		return nil
+	}
+
+	var reason = "an error occurred while sending it" // don't expose internal errors
+	if errors.Is(postErr, ErrPostRejected) {
+		reason = postErr.Error()
+	}
+
+	body := &bytes.Buffer{}
+	data := txt.ScheduledFailedData{
+		ListAddress: list.RFC5322AddrSpec(),
+		Reason:      reason,
+		Subject:     post.Subject,
+		Time:        post.Time.Format("2006-01-02 15:04"),
+	}
+
+	if err := txt.ScheduledFailed.Execute(body, data); err != nil {
+		return err
+	}
+
+	return u.Notify(list, post.From, "Your scheduled message has not been sent", body)
+}
+
+// sendAllScheduled runs SendScheduled on all lists.
+func (u *Ulist) sendAllScheduled() {
+
+	lists, err := u.Lists.AllLists()
+	if err != nil {
+		log.Printf("error getting lists for scheduled messages: %v", err)
+		return
+	}
+
+	for _, li := range lists {
+		if _, err := os.Stat(u.ScheduledFolder(li)); err != nil {
+			continue // no scheduled messages
+		}
+		list, err := u.Lists.GetList(&li.Addr)
+		if err != nil || list == nil {
+			log.Printf("error getting list %s for scheduled messages: %v", li.RFC5322AddrSpec(), err)
+			continue
+		}
+		sent, err := u.SendScheduled(list, time.Now())
+		if err != nil {
+			log.Printf("error sending scheduled messages of %s: %v", list, err)
+		}
+		if sent > 0 {
+			log.Printf("sent %d scheduled messages of %s", sent, list)
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package ulist
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// Delivery determines how a receiving member gets the messages of the list.
+type Delivery int
+
+var ErrUnknownDeliveryString = errors.New("unknown delivery string")
+
+const (
+	DeliveryImmediate Delivery = iota // each message on its own, zero value
+	DeliveryDaily                     // one digest per day
+	DeliveryWeekly                    // one digest per week
+)
+
+// Deliveries are all delivery modes, for templates.
+var Deliveries = []Delivery{DeliveryImmediate, DeliveryDaily, DeliveryWeekly}
+
+// implement sql.Scanner
+func (d *Delivery) Scan(value interface{}) (err error) {
+	*d, err = ParseDelivery(value.(string))
+	return
+}
+
+// implement sql/driver.Valuer
+func (d Delivery) Value() (driver.Value, error) {
+	return d.String(), nil
+}
+
+func ParseDelivery(s string) (Delivery, error) {
+	switch s {
+	case DeliveryImmediate.String():
+		return DeliveryImmediate, nil
+	case DeliveryDaily.String():
+		return DeliveryDaily, nil
+	case DeliveryWeekly.String():
+		return DeliveryWeekly, nil
+	default:
+		return DeliveryImmediate, ErrUnknownDeliveryString
+	}
+}
+
+func (d Delivery) String() string {
+	switch d {
+	case DeliveryImmediate:
+		return "immediate"
+	case DeliveryDaily:
+		return "daily"
+	case DeliveryWeekly:
+		return "weekly"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Interval returns the time between two digests. It is zero for DeliveryImmediate.
+func (d Delivery) Interval() time.Duration {
+	switch d {
+	case DeliveryDaily:
+		return 24 * time.Hour
+	case DeliveryWeekly:
+		return 7 * 24 * time.Hour
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,262 @@
+package ulist
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/wansing/ulist/mailutil"
+	"github.com/wansing/ulist/txt"
+)
+
+// digestRetention is how long forwarded messages are kept for digests. It must be longer than the longest Delivery interval.
+const digestRetention = 8 * 24 * time.Hour
+
+// DigestFolder contains the forwarded messages of a list which have not been sent in all digests yet. It is separate from the StorageFolder, which holds the moderation queue.
+func (u *Ulist) DigestFolder(li ListInfo) string {
+	return filepath.Join(u.SpoolDir, "digest", strconv.Itoa(li.ID))
+}
+
+// digestJob is the name of the job which sends the digests of a list with the given delivery mode.
+func digestJob(li ListInfo, delivery Delivery) string {
+	return fmt.Sprintf("digest-%s-%d", delivery, li.ID)
+}
+
+// storeForDigest saves a forwarded message if any member receives digests.
+func (u *Ulist) storeForDigest(list *List, header mail.Header, body []byte) error {
+
+	var hasDigestReceivers bool
+	for _, delivery := range Deliveries {
+		if delivery.Interval() == 0 {
+			continue
+		}
+		receivers, err := u.Lists.DigestReceivers(list, delivery)
+		if err != nil {
+			return err
+		}
+		if len(receivers) > 0 {
+			hasDigestReceivers = true
+			break
+		}
+	}
+	if !hasDigestReceivers {
+		return nil
+	}
+
+	if err := os.MkdirAll(u.DigestFolder(list.ListInfo), 0700); err != nil {
+		return err
+	}
+
+	file, err := os.CreateTemp(u.DigestFolder(list.ListInfo), fmt.Sprintf("%010d-*.eml", time.Now().Unix()))
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	m := &mailutil.Message{
+		Header: header,
+		Body:   body,
+	}
+	if err := m.Save(file); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+	return file.Close()
+}
+
+// digestFilenames returns the names of the stored digest messages, oldest first.
+func (u *Ulist) digestFilenames(list *List) ([]string, error) {
+	entries, err := os.ReadDir(u.DigestFolder(list.ListInfo))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var filenames []string
+	for _, entry := range entries {
+		filenames = append(filenames, entry.Name())
+	}
+	sort.Strings(filenames)
+	return filenames, nil
+}
+
+// SendDigest sends the messages which have been forwarded since the last digest to the members with the given delivery mode. It does nothing if the interval has not elapsed yet. Messages which are too old for any digest are removed.
+func (u *Ulist) SendDigest(list *List, delivery Delivery, now time.Time) error {
+
+	if delivery.Interval() == 0 {
+		return nil
+	}
+
+	jobName := digestJob(list.ListInfo, delivery)
+
+	last, err := u.Lists.LastRun(jobName)
+	if err != nil {
+		return err
+	}
+	if last.IsZero() {
+		last = now.Add(-delivery.Interval()) // first run
+	}
+	if now.Sub(last) < delivery.Interval() {
+		return nil
+	}
+
+	receivers, err := u.Lists.DigestReceivers(list, delivery)
+	if err != nil {
+		return err
+	}
+
+	filenames, err := u.digestFilenames(list)
+	if err != nil {
+		return err
+	}
+
+	var messages [][]byte
+	var entries []txt.DigestEntry
+
+	for _, filename := range filenames {
+		stored, ok := StoredTime(filename)
+		if !ok {
+			continue
+		}
+		if now.Sub(stored) > digestRetention {
+			if err := os.Remove(filepath.Join(u.DigestFolder(list.ListInfo), filename)); err != nil {
+				log.Printf("error removing old digest message: %v", err)
+			}
+			continue
+		}
+		if len(receivers) == 0 || !stored.After(last) || stored.After(now) {
+			continue
+		}
+		raw, err := os.ReadFile(filepath.Join(u.DigestFolder(list.ListInfo), filename))
+		if err != nil {
+			return err
+		}
+		msg, err := mail.ReadMessage(bytes.NewReader(raw))
+		if err != nil {
+			continue
+		}
+		messages = append(messages, raw)
+		entries = append(entries, txt.DigestEntry{
+			Number:  len(entries) + 1,
+			From:    mailutil.RobustWordDecode(msg.Header.Get("From")),
+			Subject: mailutil.RobustWordDecode(msg.Header.Get("Subject")),
+		})
+	}
+
+	// set last run before sending, so a failing MTA doesn't cause duplicate digests
+
+	if err := u.Lists.SetLastRun(jobName, now); err != nil {
+		return err
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	// table of contents
+
+	var footer string
+	if u.Web != nil {
+		footer = u.Web.FooterPlain(list)
+	}
+
+	toc := &bytes.Buffer{}
+	data := txt.DigestTOCData{
+		Delivery:     delivery.String(),
+		Entries:      entries,
+		Footer:       footer,
+		ListNameAddr: list.RFC5322NameAddr(),
+	}
+	if err := txt.DigestTOC.Execute(toc, data); err != nil {
+		return err
+	}
+
+	// multipart/digest with one message/rfc822 part per message, see RFC 2046 section 5.1.5
+
+	digest := &bytes.Buffer{}
+	digestWriter := multipart.NewWriter(digest)
+	for _, message := range messages {
+		w, err := digestWriter.CreatePart(textproto.MIMEHeader{"Content-Type": []string{"message/rfc822"}})
+		if err != nil {
+			return err
+		}
+		if _, err := w.Write(message); err != nil {
+			return err
+		}
+	}
+	if err := digestWriter.Close(); err != nil {
+		return err
+	}
+
+	// multipart/mixed with the table of contents first, like RFC 1153 digests
+
+	body := &bytes.Buffer{}
+	bodyWriter := multipart.NewWriter(body)
+
+	w, err := bodyWriter.CreatePart(textproto.MIMEHeader{"Content-Type": []string{"text/plain; charset=utf-8"}})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, toc); err != nil {
+		return err
+	}
+
+	w, err = bodyWriter.CreatePart(textproto.MIMEHeader{"Content-Type": []string{mime.FormatMediaType("multipart/digest", map[string]string{"boundary": digestWriter.Boundary()})}})
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(w, digest); err != nil {
+		return err
+	}
+
+	if err := bodyWriter.Close(); err != nil {
+		return err
+	}
+
+	header := make(mail.Header)
+	header["Content-Type"] = []string{mime.FormatMediaType("multipart/mixed", map[string]string{"boundary": bodyWriter.Boundary()})}
+	header["From"] = []string{list.RFC5322NameAddr()}
+	u.setListHeaders(list, header)
+	header["Message-Id"] = []string{list.NewMessageId()}
+	header["Mime-Version"] = []string{"1.0"}
+	header["Subject"] = []string{mime.QEncoding.Encode("utf-8", fmt.Sprintf("[%s] %s digest, %d messages", list.DisplayOrLocal(), delivery, len(messages)))}
+	header["To"] = []string{list.RFC5322AddrSpec()}
+
+	return u.MTA.Send(list.BounceAddress(), receivers, header, body)
+}
+
+func (u *Ulist) sendAllDigests() {
+
+	lists, err := u.Lists.AllLists()
+	if err != nil {
+		log.Printf("error getting lists for digests: %v", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, li := range lists {
+		list, err := u.Lists.GetList(&li.Addr)
+		if err != nil || list == nil {
+			log.Printf("error getting list %s for digests: %v", li.RFC5322AddrSpec(), err)
+			continue
+		}
+		for _, delivery := range Deliveries {
+			if err := u.SendDigest(list, delivery, now); err != nil {
+				log.Printf("error sending %s digest of %s: %v", delivery, list, err)
+			}
+		}
+	}
+}
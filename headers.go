@@ -0,0 +1,221 @@
+package ulist
+
+import (
+	"fmt"
+	"mime"
+	"net/mail"
+	"net/textproto"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/wansing/ulist/mailutil"
+)
+
+// DefaultStripHeaders are removed from forwarded messages unless List.StripHeaders is set. They can reveal the IP address, the mailbox or the software of the sender. A trailing "*" matches any suffix.
+var DefaultStripHeaders = []string{
+	"Arc-*",
+	"Authentication-Results",
+	"Delivered-To",
+	"Disposition-Notification-To",
+	"Errors-To",
+	"Received",
+	"Return-Path",
+	"Return-Receipt-To",
+	"User-Agent",
+	"X-Authenticated-Sender",
+	"X-Authenticated-User",
+	"X-Client-Ip",
+	"X-Envelope-From",
+	"X-Envelope-To",
+	"X-Forwarded-For",
+	"X-Mailer",
+	"X-Mimeole",
+	"X-Ms-Exchange-*",
+	"X-Newsreader",
+	"X-Original-To",
+	"X-Originating-Ip",
+	"X-Remote-Ip",
+	"X-Sender",
+	"X-Sender-Ip",
+}
+
+// hideFromHeaders are the only header fields of the original message which are kept if HideFrom is set, because any other field could identify the sender. In-Reply-To and References are required for threading, their Message-Ids are rewritten by hideMessageIds.
+var hideFromHeaders = []string{
+	"Content-Disposition",
+	"Content-Language",
+	"Content-Transfer-Encoding",
+	"Content-Type",
+	"Date",
+	"In-Reply-To",
+	"Mime-Version",
+	"References",
+	"Subject",
+}
+
+// reservedHeaders can't be added as static headers because ulist sets them or they are specific to each message. A trailing "*" matches any suffix.
+var reservedHeaders = []string{
+	"Archived-At",
+	"Bcc",
+	"Cc",
+	"Content-*",
+	"Date",
+	"Dkim-Signature",
+	"From",
+	"In-Reply-To",
+	"List-*",
+	"Message-Id",
+	"Mime-Version",
+	"Precedence",
+	"Received",
+	"References",
+	"Reply-To",
+	"Return-Path",
+	"Sender",
+	"Subject",
+	"To",
+}
+
+// StripHeaderKeys returns the header keys which are removed from forwarded messages.
+func (list *List) StripHeaderKeys() []string {
+	if list.StripHeaders == "" {
+		return DefaultStripHeaders
+	}
+	keys, _ := ParseHeaderKeys(list.StripHeaders) // validated when saved
+	return keys
+}
+
+// staticHeaders returns the static header fields with Q-encoded values.
+func (list *List) staticHeaders() mail.Header {
+	header, _ := ParseStaticHeaders(list.StaticHeaders) // validated when saved
+	for key, values := range header {
+		for i := range values {
+			values[i] = mime.QEncoding.Encode("utf-8", values[i])
+		}
+		header[key] = values
+	}
+	return header
+}
+
+// listMessageIdPattern matches Message-Ids which have been created by NewMessageId or forwardedMessageId.
+var listMessageIdPattern = regexp.MustCompile(`^<[0-9a-z_-]{32}@`)
+
+// hideMessageIds rewrites the Message-Ids in the In-Reply-To and References fields like forwardedMessageId, because a Message-Id of the sender can contain their domain. Message-Ids which have been created for the list are kept.
+func (list *List) hideMessageIds(header mail.Header) {
+	for _, key := range []string{"In-Reply-To", "References"} {
+		if _, ok := header[key]; !ok {
+			continue
+		}
+		ids := mailutil.MessageIDs(header.Get(key))
+		if len(ids) == 0 {
+			delete(header, key)
+			continue
+		}
+		for i, id := range ids {
+			if !listMessageIdPattern.MatchString(id) || !strings.HasSuffix(id, "@"+list.Domain+">") {
+				ids[i] = list.forwardedMessageId(id)
+			}
+		}
+		header[key] = []string{strings.Join(ids, " ")}
+	}
+}
+
+// keepHeader returns whether a header field of the original message is kept in forwarded messages.
+func (list *List) keepHeader(strip []string, key string) bool {
+	if list.HideFrom && !slices.Contains(hideFromHeaders, key) {
+		return false
+	}
+	return !matchHeaderKey(strip, key)
+}
+
+// matchHeaderKey returns whether the canonical key matches one of the patterns.
+func matchHeaderKey(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if key == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+// ParseHeaderKeys parses header keys, separated by whitespace or commas, and returns them in canonical notation. A trailing "*" matches any suffix.
+func ParseHeaderKeys(s string) ([]string, error) {
+	var keys []string
+	for _, field := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' || r == '\t' || r == '\r' || r == '\n' }) {
+		key := strings.TrimSuffix(field, "*")
+		if !validHeaderKey(key) {
+			return nil, fmt.Errorf("invalid header key: %q", field)
+		}
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if strings.HasSuffix(field, "*") {
+			key += "*"
+		}
+		if !slices.Contains(keys, key) {
+			keys = append(keys, key)
+		}
+	}
+	return keys, nil
+}
+
+// ParseStaticHeaders parses lines like "X-Foo: bar". Keys are returned in canonical notation. Empty lines are skipped.
+func ParseStaticHeaders(s string) (mail.Header, error) {
+	var header = make(mail.Header)
+	for _, line := range strings.Split(s, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok {
+			return nil, fmt.Errorf("header line has no colon: %q", line)
+		}
+		key = strings.TrimSpace(key)
+		value = strings.TrimSpace(value)
+		if !validHeaderKey(key) {
+			return nil, fmt.Errorf("invalid header key: %q", key)
+		}
+		key = textproto.CanonicalMIMEHeaderKey(key)
+		if matchHeaderKey(reservedHeaders, key) {
+			return nil, fmt.Errorf("header %s can't be set", key)
+		}
+		if value == "" {
+			return nil, fmt.Errorf("header %s has no value", key)
+		}
+		header[key] = append(header[key], value)
+	}
+	return header, nil
+}
+
+// FormatStaticHeaders is the inverse of ParseStaticHeaders.
+func FormatStaticHeaders(header mail.Header) string {
+	var keys = make([]string, 0, len(header))
+	for key := range header {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+
+	var lines []string
+	for _, key := range keys {
+		for _, value := range header[key] {
+			lines = append(lines, key+": "+value)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validHeaderKey checks whether s consists of printable US-ASCII characters except colon, see RFC 5322 section 2.2.
+func validHeaderKey(s string) bool {
+	if s == "" || len(s) > 76 {
+		return false
+	}
+	for _, c := range []byte(s) {
+		if c < 33 || c > 126 || c == ':' {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,27 @@
+package ulist
+
+import (
+	"time"
+)
+
+// runPeriodically runs job immediately and then every interval, until done is closed. A running job is not interrupted, and u.Waiting waits for it.
+func (u *Ulist) runPeriodically(done <-chan struct{}, interval time.Duration, job func()) {
+
+	u.Waiting.Add(1)
+
+	go func() {
+		defer u.Waiting.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			job()
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+}
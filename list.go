@@ -7,8 +7,13 @@ import (
 	"encoding/base64"
 	"errors"
 	"fmt"
+	"log"
 	"net/mail"
+	"os"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/wansing/ulist/mailutil"
@@ -19,13 +24,31 @@ var ErrLink = errors.New("link is invalid or expired") // HMAC related, don't le
 
 type List struct {
 	ListInfo
-	HMACKey       []byte // [32]byte would require check when reading from database
-	PublicSignup  bool   // default: false
-	HideFrom      bool   // default: false
-	ActionMod     Action
-	ActionMember  Action
-	ActionKnown   Action
-	ActionUnknown Action
+	HMACKey            []byte // [32]byte would require check when reading from database
+	PublicSignup       bool   // default: false
+	HideFrom           bool   // default: false
+	HeldNotice         bool   // default: false, send an auto-reply to senders whose message is held for moderation
+	ModExpiry          int    // default: 0, delete moderated messages after this number of days, zero means never
+	ExpiryNotifySender bool   // default: false
+	ExpiryNotifyMods   bool   // default: false
+	ActionMod          Action
+	ActionMember       Action
+	ActionKnown        Action
+	ActionUnknown      Action
+	ActionBlocked      Action // Reject or Discard
+	ReplyTo            ReplyTo
+	ReplyToAddress     string // used if ReplyTo is ReplyToFixed
+	KeepReplyTo        bool   // default: false, append the original Reply-To addresses unless HideFrom is set
+	Prefix             string // text of the subject tag, default: empty, which means DisplayOrLocal
+	NoPrefix           bool   // default: false, don't tag subjects at all
+	PostNumbers        bool   // default: false, append a running number to the subject tag
+	FooterPlain        string // template, default: empty, which means the default footer
+	FooterHTML         string // template, default: empty, which means the default footer
+	StripHeaders       string // header keys, one per line, default: empty, which means DefaultStripHeaders
+	StaticHeaders      string // "Key: value" lines, which are added to forwarded messages
+	RateLimitHour      int    // default: 0, maximum number of forwarded messages per sender and hour, zero means unlimited
+	RateLimitDay       int    // default: 0, maximum number of forwarded messages per sender and day, zero means unlimited
+	RateLimitAction    Action // Mod or Reject, applies to messages of senders who have reached a rate limit
 }
 
 type rateLimitKey struct {
@@ -36,8 +59,119 @@ type rateLimitKey struct {
 var (
 	sentJoinCheckbacks  = make(map[rateLimitKey]int64) // value: unix time
 	sentLeaveCheckbacks = make(map[rateLimitKey]int64) // value: unix time
+	sentHeldNotices     = make(map[rateLimitKey]int64) // value: unix time
+	sentHeldNoticesLock sync.Mutex                     // LMTP sessions run concurrently
 )
 
+// SetAnnounceOnly applies the preset for announcement lists: moderators can post, messages from everyone else are rejected, and replies go to the given address or, if it is empty, to the sender.
+func (u *Ulist) SetAnnounceOnly(list *List, replyToAddress string) error {
+
+	var replyTo = ReplyToSender
+	if replyToAddress != "" {
+		replyTo = ReplyToFixed
+	}
+
+	if err := u.Lists.UpdateReplyTo(list, replyTo, replyToAddress, false); err != nil {
+		return err
+	}
+
+	return u.Lists.Update(list, list.Display, list.PublicSignup, list.HideFrom, Pass, Reject, Reject, Reject, list.ActionBlocked)
+}
+
+// RenameList changes the address of the list. The ID and with it all members, settings, the moderation queue and the archive are kept. If keepAlias is true, the old address becomes an alias. Members are notified.
+func (u *Ulist) RenameList(list *List, rawAddress string, keepAlias bool, reason string) error {
+
+	newAddr, err := mailutil.ParseAddress(rawAddress)
+	if err != nil {
+		return err
+	}
+
+	oldAddress := list.RFC5322AddrSpec()
+
+	if err := u.Lists.Rename(list, newAddr, keepAlias); err != nil {
+		return err
+	}
+
+	members, err := u.Lists.Members(list)
+	if err != nil {
+		return err
+	}
+
+	var notice bytes.Buffer
+	if err := txt.RenamedNotice.Execute(&notice, txt.RenamedNoticeData{
+		KeepAlias:  keepAlias,
+		NewAddress: list.RFC5322AddrSpec(),
+		OldAddress: oldAddress,
+	}); err != nil {
+		return err
+	}
+
+	var gdprEvent = &strings.Builder{}
+	var notifyFailed = 0
+
+	for _, member := range members {
+
+		if gdprEvent.Len() > 0 {
+			gdprEvent.WriteString("\t") // indent line
+		}
+		fmt.Fprintf(gdprEvent, "%s is a member of the list %s, which has been renamed from %s, reason: %s\n", member.MemberAddress, list, oldAddress, reason)
+
+		if err := u.Notify(list, member.MemberAddress, "New list address", bytes.NewReader(notice.Bytes())); err != nil {
+			log.Printf("error sending renamed notice: %v", err)
+			notifyFailed++
+		}
+	}
+
+	if gdprEvent.Len() > 0 {
+		if err := u.GDPRLogger.Printf("%s", gdprEvent); err != nil {
+			log.Printf("error writing to GDPR log: %v", err)
+		}
+	}
+
+	if notifyFailed > 0 {
+		return fmt.Errorf("the list has been renamed, but sending %d notifications failed", notifyFailed)
+	}
+	return nil
+}
+
+// DeleteList deletes the list from the database, and its moderation queue, digest messages, scheduled messages, archive and job states. IDs of deleted lists can be reused by new lists, so nothing must be left behind.
+func (u *Ulist) DeleteList(list *List) error {
+
+	if err := u.Lists.Delete(list); err != nil {
+		return err
+	}
+
+	for _, delivery := range Deliveries {
+		if delivery.Interval() > 0 {
+			if err := u.Lists.RemoveLastRun(digestJob(list.ListInfo, delivery)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, mode := range NotifyModes {
+		if mode.Interval() > 0 {
+			if err := u.Lists.RemoveLastRun(modDigestJob(list.ListInfo, mode)); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, folder := range []string{u.StorageFolder(list.ListInfo), u.DigestFolder(list.ListInfo), u.ScheduledFolder(list.ListInfo)} {
+		if err := os.RemoveAll(folder); err != nil {
+			return err
+		}
+	}
+
+	if u.Archive != nil {
+		if err := u.Archive.DeleteArchive(list); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
 // CreateHMAC creates an HMAC with a given user email address and the current time. The HMAC is returned as a base64 RawURLEncoding string.
 func (list *List) CreateHMAC(addr *Addr) (int64, string, error) {
 	var now = time.Now().Unix()
@@ -87,11 +221,40 @@ func (list *List) createHMAC(addr *Addr, timestamp int64) ([]byte, error) {
 	return mac.Sum(nil), nil
 }
 
+// forwardedMessageId returns the Message-Id of a message which is forwarded to the members. It is derived from the original Message-Id, so a message which the MTA delivers again gets the same Message-Id. If there is no original Message-Id, a new one is created.
+func (list *List) forwardedMessageId(original string) string {
+	original = strings.TrimSpace(original)
+	if original == "" || len(list.HMACKey) == 0 {
+		return list.NewMessageId()
+	}
+	mac := hmac.New(sha256.New, list.HMACKey)
+	mac.Write([]byte(original))
+	var idLeft = strings.ToLower(base64.URLEncoding.EncodeToString(mac.Sum(nil)[:24])) // like NewMessageId
+	return (&mail.Address{Address: idLeft + "@" + list.Domain}).String()
+}
+
 // GetAction determines the maximum action of an email by the "From" addresses and possible spam headers. It also returns a human-readable reason for the decision.
 //
 // The SMTP envelope sender is ignored, because it's actually something different and a case for the spam filtering system.
 // (Mailman incorporates it last, which is probably never, because each email must have a From header: https://mail.python.org/pipermail/mailman-users/2017-January/081797.html)
 func (u *Ulist) GetAction(list *List, header mail.Header, froms []*Addr) (Action, string, error) {
+	return u.getAction(list, header, froms, false)
+}
+
+// getAction implements GetAction. If composed is true, admins of the list and the superadmin get the action of moderators, because the compose form is for moderators and admins.
+func (u *Ulist) getAction(list *List, header mail.Header, froms []*Addr, composed bool) (Action, string, error) {
+
+	// blocked senders are rejected or discarded, no matter which other roles they have
+
+	for _, from := range froms {
+		blocked, err := u.Lists.IsBlocked(list, from)
+		if err != nil {
+			return Reject, "", fmt.Errorf("error getting blocklist from database: %v", err)
+		}
+		if blocked {
+			return list.ActionBlocked, fmt.Sprintf("%s is blocked", from), nil
+		}
+	}
 
 	var action = list.ActionUnknown
 	var reason string
@@ -108,6 +271,16 @@ func (u *Ulist) GetAction(list *List, header mail.Header, froms []*Addr) (Action
 				return Reject, "", fmt.Errorf("error getting status from database: %v", err)
 			}
 
+			if composed && !slices.Contains(statuses, Moderator) {
+				membership, err := u.Lists.GetMembership(list, from)
+				if err != nil {
+					return Reject, "", fmt.Errorf("error getting membership from database: %v", err)
+				}
+				if membership.Admin || from.RFC5322AddrSpec() == u.Superadmin {
+					statuses = append(statuses, Moderator)
+				}
+			}
+
 			for _, status := range statuses {
 
 				var fromAction Action = Reject
@@ -129,6 +302,13 @@ func (u *Ulist) GetAction(list *List, header mail.Header, froms []*Addr) (Action
 		}
 	}
 
+	// senders who have reached a rate limit are moderated or rejected
+
+	action, reason, err := u.applyRateLimit(list, froms, action, reason)
+	if err != nil {
+		return Reject, "", err
+	}
+
 	// Pass becomes Mod if the email has a positive spam header
 
 	if action == Pass {
@@ -144,6 +324,12 @@ func (u *Ulist) GetAction(list *List, header mail.Header, froms []*Addr) (Action
 // SendJoinCheckback does not check the authorization of the asking person. This must be done by the caller.
 func (u *Ulist) SendJoinCheckback(list *List, recipient *Addr) error {
 
+	if blocked, err := u.Lists.IsBlocked(list, recipient); err != nil {
+		return err
+	} else if blocked {
+		return ErrBlocked
+	}
+
 	// rate limiting
 
 	if lastSentTimestamp, ok := sentJoinCheckbacks[rateLimitKey{recipient.RFC5322AddrSpec(), list.RFC5322AddrSpec()}]; ok {
@@ -174,7 +360,7 @@ func (u *Ulist) SendJoinCheckback(list *List, recipient *Addr) error {
 	}
 
 	body := &bytes.Buffer{}
-	if err = txt.CheckbackJoin.Execute(body, data); err != nil {
+	if err = u.executeTemplate(list, txt.CheckbackJoin, body, data); err != nil {
 		return err
 	}
 
@@ -224,7 +410,7 @@ func (u *Ulist) SendLeaveCheckback(list *List, user *Addr) (bool, error) {
 	}
 
 	body := &bytes.Buffer{}
-	if err = txt.CheckbackLeave.Execute(body, data); err != nil {
+	if err = u.executeTemplate(list, txt.CheckbackLeave, body, data); err != nil {
 		return false, err
 	}
 
@@ -237,8 +423,10 @@ func (u *Ulist) SendLeaveCheckback(list *List, user *Addr) (bool, error) {
 	return true, nil
 }
 
-func (list *List) SignoffLeaveMessage() ([]byte, error) {
+func (u *Ulist) SignoffLeaveMessage(list *List) ([]byte, error) {
 	var buf = &bytes.Buffer{}
-	var err = txt.SignoffLeave.Execute(buf, list.RFC5322AddrSpec())
+	var err = u.executeTemplate(list, txt.SignoffLeave, buf, txt.SignoffLeaveData{
+		ListAddress: list.RFC5322AddrSpec(),
+	})
 	return buf.Bytes(), err
 }
@@ -7,8 +7,6 @@ import (
 	"net/mail"
 	"strings"
 	"time"
-
-	"github.com/wansing/ulist/mailutil"
 )
 
 func init() {
@@ -18,6 +16,7 @@ func init() {
 type ListInfo struct {
 	ID int
 	Addr
+	Archive ArchiveAccess // default: ArchiveOff
 }
 
 func (li *ListInfo) BounceAddress() string {
@@ -26,6 +25,13 @@ func (li *ListInfo) BounceAddress() string {
 	return copy.RFC5322AddrSpec()
 }
 
+// OwnerAddress returns the address which reaches the admins of the list.
+func (li *ListInfo) OwnerAddress() string {
+	copy := li.Addr
+	copy.Local += OwnerAddressSuffix
+	return copy.RFC5322AddrSpec()
+}
+
 // NewMessageId creates a new RFC5322 compliant Message-Id with the list domain as "id-right".
 func (li *ListInfo) NewMessageId() string {
 	var randBytes = make([]byte, 24)
@@ -37,11 +43,44 @@ func (li *ListInfo) NewMessageId() string {
 	return (&mail.Address{Address: idLeft + "@" + li.Domain}).String()
 }
 
-func (li *ListInfo) PrefixSubject(subject string) string {
-	subject = mailutil.RobustWordDecode(subject)
-	var prefix = "[" + li.DisplayOrLocal() + "]"
-	if firstSquareBracket := strings.Index(subject, "["); firstSquareBracket == -1 || firstSquareBracket != strings.Index(subject, prefix) { // square bracket not found or before prefix
-		subject = prefix + " " + subject
+// RFC2919ListId returns the list identifier in angle brackets, like "<list.example.com>". Characters which are not allowed in a dot-atom are replaced or removed.
+func (li *ListInfo) RFC2919ListId() string {
+	var label = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= 'A' && r <= 'Z', r >= '0' && r <= '9':
+			return r
+		case strings.ContainsRune(".!#$%&'*+-/=?^_`{|}~", r):
+			return r
+		default:
+			return '-'
+		}
+	}, li.Local)
+	label = strings.Join(strings.FieldsFunc(label, func(r rune) bool { return r == '.' }), ".") // no leading, trailing or consecutive dots
+	if label == "" {
+		label = "-"
+	}
+	return "<" + label + "." + li.Domain + ">"
+}
+
+// RFC2919ListIdField returns the value of the List-Id header field: the display name, if any, followed by the list identifier.
+func (li *ListInfo) RFC2919ListIdField() string {
+	if li.Display == "" {
+		return li.RFC2919ListId()
+	}
+	var phrase = mime.QEncoding.Encode("utf-8", li.Display)
+	if phrase == li.Display {
+		phrase = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(li.Display) + `"`
+	}
+	return phrase + " " + li.RFC2919ListId()
+}
+
+// MatchesListId returns whether the value of a List-Id header field refers to this list. Earlier versions used the list address instead of an RFC 2919 list identifier, so both are accepted.
+func (li *ListInfo) MatchesListId(field string) bool {
+	start := strings.LastIndex(field, "<")
+	end := strings.LastIndex(field, ">")
+	if start < 0 || end < start {
+		return false
 	}
-	return mime.QEncoding.Encode("utf-8", subject)
+	id := strings.TrimSpace(field[start+1 : end])
+	return strings.EqualFold("<"+id+">", li.RFC2919ListId()) || strings.EqualFold(id, li.RFC5322AddrSpec())
 }
@@ -13,12 +13,12 @@ func TestBounceAddress(t *testing.T) {
 		input    ListInfo
 		expected string
 	}{
-		{ListInfo{1, Addr{Display: "", Local: `foo`, Domain: `example.com`}}, `foo+bounces@example.com`},
-		{ListInfo{2, Addr{Display: "", Local: `foo.bar`, Domain: `example.com`}}, `foo.bar+bounces@example.com`},         // one dot is okay
-		{ListInfo{3, Addr{Display: "", Local: `foo..bar`, Domain: `example.com`}}, `"foo..bar+bounces"@example.com`},     // local-parts with consecutive dots must be quoted
-		{ListInfo{4, Addr{Display: "", Local: `foo bar`, Domain: `example.com`}}, `"foo bar+bounces"@example.com`},       // some characters are only allowed in quotes
-		{ListInfo{5, Addr{Display: "", Local: `foo@bar`, Domain: `example.com`}}, `"foo@bar+bounces"@example.com`},       // some characters are only allowed in quotes
-		{ListInfo{6, Addr{Display: "", Local: `"foo@bar"`, Domain: `example.com`}}, `"\"foo@bar\"+bounces"@example.com`}, // double quotes must be escaped
+		{ListInfo{ID: 1, Addr: Addr{Display: "", Local: `foo`, Domain: `example.com`}}, `foo+bounces@example.com`},
+		{ListInfo{ID: 2, Addr: Addr{Display: "", Local: `foo.bar`, Domain: `example.com`}}, `foo.bar+bounces@example.com`},         // one dot is okay
+		{ListInfo{ID: 3, Addr: Addr{Display: "", Local: `foo..bar`, Domain: `example.com`}}, `"foo..bar+bounces"@example.com`},     // local-parts with consecutive dots must be quoted
+		{ListInfo{ID: 4, Addr: Addr{Display: "", Local: `foo bar`, Domain: `example.com`}}, `"foo bar+bounces"@example.com`},       // some characters are only allowed in quotes
+		{ListInfo{ID: 5, Addr: Addr{Display: "", Local: `foo@bar`, Domain: `example.com`}}, `"foo@bar+bounces"@example.com`},       // some characters are only allowed in quotes
+		{ListInfo{ID: 6, Addr: Addr{Display: "", Local: `"foo@bar"`, Domain: `example.com`}}, `"\"foo@bar\"+bounces"@example.com`}, // double quotes must be escaped
 	}
 
 	for _, test := range tests {
@@ -28,12 +28,44 @@ func TestBounceAddress(t *testing.T) {
 	}
 }
 
+func TestRFC2919ListId(t *testing.T) {
+
+	tests := []struct {
+		input    ListInfo
+		id       string
+		field    string
+		matching []string
+	}{
+		{ListInfo{Addr: Addr{Display: "", Local: `foo`, Domain: `example.com`}}, `<foo.example.com>`, `<foo.example.com>`, []string{`<FOO.example.com>`, `"Foo" <foo@example.com>`}},
+		{ListInfo{Addr: Addr{Display: `Foo "Bar"`, Local: `foo.bar`, Domain: `example.com`}}, `<foo.bar.example.com>`, `"Foo \"Bar\"" <foo.bar.example.com>`, []string{`Foo <foo.bar.example.com>`}},
+		{ListInfo{Addr: Addr{Display: "Ü", Local: `foo..bar`, Domain: `example.com`}}, `<foo.bar.example.com>`, `=?utf-8?q?=C3=9C?= <foo.bar.example.com>`, []string{`"foo..bar"@example.com <"foo..bar"@example.com>`}},
+		{ListInfo{Addr: Addr{Display: "", Local: `foo bar`, Domain: `example.com`}}, `<foo-bar.example.com>`, `<foo-bar.example.com>`, nil},
+	}
+
+	for _, test := range tests {
+		if result := test.input.RFC2919ListId(); result != test.id {
+			t.Errorf("got %s, want %s", result, test.id)
+		}
+		if result := test.input.RFC2919ListIdField(); result != test.field {
+			t.Errorf("got %s, want %s", result, test.field)
+		}
+		for _, m := range append(test.matching, test.field) {
+			if !test.input.MatchesListId(m) {
+				t.Errorf("%s should match %s", m, test.id)
+			}
+		}
+		if test.input.MatchesListId("<other.example.com>") {
+			t.Errorf("<other.example.com> should not match %s", test.id)
+		}
+	}
+}
+
 // we can't test the uniqueness across test runs here
 func TestNewMessageId(t *testing.T) {
 
 	var li = &ListInfo{
-		1,
-		Addr{
+		ID: 1,
+		Addr: Addr{
 			Local:  "list",
 			Domain: "example.com",
 		},
@@ -56,33 +88,3 @@ func TestNewMessageId(t *testing.T) {
 		}
 	}
 }
-
-func TestPrefixSubject(t *testing.T) {
-
-	list := &List{}
-	list.Display = "List"
-
-	tests := []struct {
-		input    string
-		expected string
-	}{
-		{"", "[List] "},
-		{"Foo", "[List] Foo"},
-		{"Re: Foo", "[List] Re: Foo"},
-		{"[List] Foo", "[List] Foo"},
-		{"Re: FW: [List] Foo", "Re: FW: [List] Foo"},
-		{"[", "[List] ["},
-		{"Re: [", "[List] Re: ["},
-		{"[ <- Bracket", "[List] [ <- Bracket"},
-		{"Re: [ <- Bracket", "[List] Re: [ <- Bracket"},
-		{"[Bar] [List]", "[List] [Bar] [List]"},
-		{"Re: [Bar] [List]", "[List] Re: [Bar] [List]"},
-		{"=?UTF-8?Q?=5BList=5D_Hello?=", "[List] Hello"},
-	}
-
-	for _, test := range tests {
-		if result := list.PrefixSubject(test.input); result != test.expected {
-			t.Errorf("got %s, want %s", result, test.expected)
-		}
-	}
-}
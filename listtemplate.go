@@ -0,0 +1,256 @@
+package ulist
+
+import (
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/wansing/ulist/mailutil"
+)
+
+// ListTemplate contains the settings which are applied to new lists. It is stored as JSON, so fields can be added without changing the database schema. Missing fields get their zero value.
+//
+// It contains all settings of a list except the address, the display name and the running post number.
+type ListTemplate struct {
+	Name               string            `json:"-"`
+	PublicSignup       bool              `json:"public_signup"`
+	HideFrom           bool              `json:"hide_from"`
+	HeldNotice         bool              `json:"held_notice"`
+	ModExpiry          int               `json:"mod_expiry"`
+	ExpiryNotifySender bool              `json:"expiry_notify_sender"`
+	ExpiryNotifyMods   bool              `json:"expiry_notify_mods"`
+	ActionMod          Action            `json:"action_mod"`
+	ActionMember       Action            `json:"action_member"`
+	ActionKnown        Action            `json:"action_known"`
+	ActionUnknown      Action            `json:"action_unknown"`
+	ActionBlocked      Action            `json:"action_blocked"`
+	Archive            ArchiveAccess     `json:"archive"`
+	ReplyTo            ReplyTo           `json:"reply_to"`
+	ReplyToAddress     string            `json:"reply_to_address"`
+	KeepReplyTo        bool              `json:"keep_reply_to"`
+	Prefix             string            `json:"prefix"`
+	NoPrefix           bool              `json:"no_prefix"`
+	PostNumbers        bool              `json:"post_numbers"`
+	StripHeaders       string            `json:"strip_headers"`
+	StaticHeaders      string            `json:"static_headers"`
+	RateLimitHour      int               `json:"rate_limit_hour"`
+	RateLimitDay       int               `json:"rate_limit_day"`
+	LimitAction        Action            `json:"rate_limit_action"`
+	FooterPlain        string            `json:"footer_plain"`
+	FooterHTML         string            `json:"footer_html"`
+	Notifications      map[string]string `json:"notifications"` // overridden notification templates, key is the name in the txt package
+}
+
+// NewListTemplate returns a template with the settings of the given list, including its overridden notification templates.
+func (u *Ulist) NewListTemplate(list *List, name string) (*ListTemplate, error) {
+
+	t := &ListTemplate{
+		Name:               strings.TrimSpace(name),
+		PublicSignup:       list.PublicSignup,
+		HideFrom:           list.HideFrom,
+		HeldNotice:         list.HeldNotice,
+		ModExpiry:          list.ModExpiry,
+		ExpiryNotifySender: list.ExpiryNotifySender,
+		ExpiryNotifyMods:   list.ExpiryNotifyMods,
+		ActionMod:          list.ActionMod,
+		ActionMember:       list.ActionMember,
+		ActionKnown:        list.ActionKnown,
+		ActionUnknown:      list.ActionUnknown,
+		ActionBlocked:      list.ActionBlocked,
+		Archive:            list.Archive,
+		ReplyTo:            list.ReplyTo,
+		ReplyToAddress:     list.ReplyToAddress,
+		KeepReplyTo:        list.KeepReplyTo,
+		Prefix:             list.Prefix,
+		NoPrefix:           list.NoPrefix,
+		PostNumbers:        list.PostNumbers,
+		StripHeaders:       list.StripHeaders,
+		StaticHeaders:      list.StaticHeaders,
+		RateLimitHour:      list.RateLimitHour,
+		RateLimitDay:       list.RateLimitDay,
+		LimitAction:        list.RateLimitAction,
+		FooterPlain:        list.FooterPlain,
+		FooterHTML:         list.FooterHTML,
+		Notifications:      make(map[string]string),
+	}
+
+	names, err := u.Lists.Templates(list)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		src, err := u.Lists.GetTemplate(list, n)
+		if err != nil {
+			return nil, err
+		}
+		t.Notifications[n] = src
+	}
+
+	return t, nil
+}
+
+// applyListTemplate overwrites the settings of the list with those of the template.
+func (u *Ulist) applyListTemplate(list *List, t *ListTemplate) error {
+
+	if err := u.Lists.Update(list, list.Display, t.PublicSignup, t.HideFrom, t.ActionMod, t.ActionMember, t.ActionKnown, t.ActionUnknown, t.ActionBlocked); err != nil {
+		return err
+	}
+
+	if err := u.Lists.UpdateModeration(list, t.HeldNotice, t.ModExpiry, t.ExpiryNotifySender, t.ExpiryNotifyMods); err != nil {
+		return err
+	}
+
+	if err := u.Lists.UpdateArchive(list, t.Archive); err != nil {
+		return err
+	}
+
+	if err := u.Lists.UpdateReplyTo(list, t.ReplyTo, t.ReplyToAddress, t.KeepReplyTo); err != nil {
+		return err
+	}
+
+	if err := u.Lists.UpdatePrefix(list, t.Prefix, t.NoPrefix, t.PostNumbers); err != nil {
+		return err
+	}
+
+	if err := u.Lists.UpdateHeaders(list, t.StripHeaders, t.StaticHeaders); err != nil {
+		return err
+	}
+
+	if err := u.Lists.UpdateRateLimit(list, t.RateLimitHour, t.RateLimitDay, t.LimitAction); err != nil {
+		return err
+	}
+
+	if err := u.Lists.UpdateFooter(list, t.FooterPlain, t.FooterHTML); err != nil {
+		return err
+	}
+
+	for name, src := range t.Notifications {
+		if err := u.Lists.SetTemplate(list, name, src); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// CreateListFromTemplate creates a list like CreateList and applies the template before the admins are added, so they get the welcome message of the template. If t is nil, the default settings are used. If the template can't be applied, the list is deleted again.
+func (u *Ulist) CreateListFromTemplate(address, name, rawAdminMods string, t *ListTemplate, reason string) (*List, int, []error) {
+
+	adminMods, errs := mailutil.ParseAddresses(rawAdminMods, WebBatchLimit)
+	if len(errs) > 0 {
+		return nil, 0, []error{fmt.Errorf("parsing %d email addresses", len(errs))}
+	}
+
+	list, err := u.Lists.Create(address, name)
+	if err != nil {
+		return nil, 0, []error{err}
+	}
+
+	if t != nil {
+		if err := u.applyListTemplate(list, t); err != nil {
+			if delErr := u.DeleteList(list); delErr != nil {
+				log.Printf("error deleting list %s after applying the template failed: %v", list, delErr)
+			}
+			return nil, 0, []error{fmt.Errorf("applying template: %w", err)}
+		}
+	}
+
+	added, errs := u.AddMembers(list, true, adminMods, true, true, true, true, true, reason)
+	return list, added, errs
+}
+
+// CloneList creates a list with all settings, notification templates and sublists of source. Only the address, the display name and the running post number are not copied. Optionally the known addresses and the members of source, including their permissions, are copied. Copied members get a welcome message.
+func (u *Ulist) CloneList(source *List, address, name, rawAdminMods string, copyKnowns, copyMembers bool, reason string) (*List, int, []error) {
+
+	t, err := u.NewListTemplate(source, "")
+	if err != nil {
+		return nil, 0, []error{err}
+	}
+
+	list, added, errs := u.CreateListFromTemplate(address, name, rawAdminMods, t, reason)
+	if list == nil || len(errs) > 0 {
+		return list, added, errs
+	}
+
+	sublists, err := u.Lists.Sublists(source)
+	if err != nil {
+		return list, added, []error{err}
+	}
+	for _, li := range sublists {
+		sublist, err := u.Lists.GetList(&li.Addr)
+		if err != nil {
+			return list, added, []error{err}
+		}
+		if sublist == nil {
+			continue
+		}
+		if err := u.Lists.AddSublist(list, sublist); err != nil {
+			return list, added, []error{err}
+		}
+	}
+
+	if copyKnowns {
+		knowns, err := u.Lists.Knowns(source)
+		if err != nil {
+			return list, added, []error{err}
+		}
+		var addrs []*Addr
+		for _, known := range knowns {
+			addr, err := mailutil.ParseAddress(known)
+			if err != nil {
+				return list, added, []error{err}
+			}
+			addrs = append(addrs, addr)
+		}
+		if _, err := u.Lists.AddKnowns(list, addrs); err != nil {
+			return list, added, []error{err}
+		}
+	}
+
+	if copyMembers {
+		members, err := u.Lists.Members(source)
+		if err != nil {
+			return list, added, []error{err}
+		}
+
+		// group members by their permissions, so AddMembers is called once per group
+		type perms struct {
+			receive, moderate, notify, admin, bounces bool
+		}
+		var groups = make(map[perms][]*Addr)
+		var order []perms
+		for _, m := range members {
+			addr, err := mailutil.ParseAddress(m.MemberAddress)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			p := perms{m.Receive, m.Moderate, m.Notify, m.Admin, m.Bounces}
+			if _, ok := groups[p]; !ok {
+				order = append(order, p)
+			}
+			groups[p] = append(groups[p], addr)
+		}
+
+		for _, p := range order {
+			n, groupErrs := u.AddMembers(list, true, groups[p], p.receive, p.moderate, p.notify, p.admin, p.bounces, reason)
+			added += n
+			errs = append(errs, groupErrs...)
+		}
+
+		for _, m := range members {
+			if m.Delivery != DeliveryImmediate {
+				if err := u.Lists.UpdateDelivery(list, m.MemberAddress, m.Delivery); err != nil {
+					errs = append(errs, err)
+				}
+			}
+			if m.NotifyMode != NotifyImmediate {
+				if err := u.Lists.UpdateNotifyMode(list, m.MemberAddress, m.NotifyMode); err != nil {
+					errs = append(errs, err)
+				}
+			}
+		}
+	}
+
+	return list, added, errs
+}
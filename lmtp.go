@@ -1,6 +1,7 @@
 package ulist
 
 import (
+	"errors"
 	"io"
 	"log"
 	"net/mail"
@@ -38,7 +39,8 @@ func (lb LMTPBackend) NewSession(_ *smtp.Conn) (smtp.Session, error) {
 type lmtpSession struct {
 	Ulist    *Ulist
 	Lists    []*List
-	isBounce bool // indicated by empty Envelope-From
+	Owners   []*List // lists whose owner address is a recipient
+	isBounce bool    // indicated by empty Envelope-From
 	logId    uint32
 }
 
@@ -49,6 +51,7 @@ func (s *lmtpSession) logf(format string, a ...interface{}) {
 // "RSET". Aborts the current mail transaction.
 func (s *lmtpSession) Reset() {
 	s.Lists = nil
+	s.Owners = nil
 	s.isBounce = false
 }
 
@@ -93,8 +96,11 @@ func (s *lmtpSession) rcpt(toStr string) error {
 	}
 
 	toBounce := strings.HasSuffix(to.Local, BounceAddressSuffix)
+	toOwner := strings.HasSuffix(to.Local, OwnerAddressSuffix)
 
 	switch {
+	case toOwner:
+		to.Local = strings.TrimSuffix(to.Local, OwnerAddressSuffix) // accepts any message
 	case toBounce && !s.isBounce:
 		return SMTPErrorf(541, "bounce address accepts only bounce notifications (with empty envelope-from)") // 541 The recipient address rejected your message
 	case !toBounce && s.isBounce:
@@ -111,6 +117,18 @@ func (s *lmtpSession) rcpt(toStr string) error {
 		return SMTPErrUserNotExist
 	}
 
+	if toOwner {
+		owners, err := s.Ulist.owners(list)
+		if err != nil {
+			return SMTPErrorf(451, "getting list admins from database: %v", err) // 451 Aborted – Local error in processing
+		}
+		if len(owners) == 0 {
+			return SMTPErrUserNotExist
+		}
+		s.Owners = append(s.Owners, list)
+		return nil
+	}
+
 	s.Lists = append(s.Lists, list)
 
 	return nil
@@ -134,7 +152,7 @@ func (s *lmtpSession) data(r io.Reader) error {
 
 	// check s.Lists again (in case MAIL FROM and RCPT TO have not been called before)
 
-	if len(s.Lists) == 0 {
+	if len(s.Lists) == 0 && len(s.Owners) == 0 {
 		return SMTPErrUserNotExist
 	}
 
@@ -192,6 +210,19 @@ func (s *lmtpSession) data(r io.Reader) error {
 				}
 			}
 
+			aliases, err := s.Ulist.Lists.Aliases(list)
+			if err != nil {
+				return SMTPErrorf(451, "getting aliases from database: %v", err)
+			}
+
+			for _, alias := range aliases {
+				for _, addr := range append(tos, ccs...) {
+					if alias.Equals(addr) {
+						continue nextList
+					}
+				}
+			}
+
 			return SMTPErrorf(541, "list address %s is not in To or Cc", list) // 541 The recipient address rejected your message
 		}
 	}
@@ -199,17 +230,32 @@ func (s *lmtpSession) data(r io.Reader) error {
 	// check for mailing list loops
 
 	for _, field := range message.Header["List-Id"] {
+		for _, list := range s.Lists {
+			if list.MatchesListId(field) {
+				return SMTPErrorf(554, "email loop detected: %s", list)
+			}
+		}
+	}
+
+	// forward messages to owner addresses to the admins
 
-		listId, err := mailutil.ParseAddress(field)
+	for _, list := range s.Owners {
+
+		owners, err := s.Ulist.owners(list)
 		if err != nil {
-			return SMTPErrorf(510, `parsing list-id field "%s": %v`, field, err) // 510 Bad email address
+			return SMTPErrorf(451, "getting list admins from database: %v", err) // 451 Aborted – Local error in processing
 		}
 
-		for _, list := range s.Lists {
-			if list.Equals(listId) {
-				return SMTPErrorf(554, "email loop detected: %s", list)
-			}
+		envelopeFrom := list.BounceAddress()
+		if s.isBounce {
+			envelopeFrom = "" // if this mail gets bounced, that won't cause a bounce loop
+		}
+
+		if err := s.Ulist.MTA.Send(envelopeFrom, owners, message.Header, message.BodyReader()); err != nil {
+			return SMTPErrorf(451, "forwarding message to the admins: %v", err)
 		}
+
+		s.logf("forwarded message to the admins of %s through %s", list, s.Ulist.MTA)
 	}
 
 	// process mail
@@ -275,6 +321,9 @@ func (s *lmtpSession) data(r io.Reader) error {
 			// public signup check is crucial, as SendJoinCheckback sends a confirmation link which allows the receiver to join
 			if list.PublicSignup && !m.Member && command == "join" {
 				if err = s.Ulist.SendJoinCheckback(list, personalFrom); err != nil {
+					if errors.Is(err, ErrBlocked) {
+						return SMTPErrorf(550, "%s is blocked", personalFrom)
+					}
 					return SMTPErrorf(451, "sending join checkback: %v", err)
 				}
 				continue // next list
@@ -311,7 +360,10 @@ func (s *lmtpSession) data(r io.Reader) error {
 
 		switch action {
 		case Reject:
+			s.Ulist.Audit(list, nil, DecisionReject, message.Header)
 			return SMTPErrUserNotExist
+		case Discard:
+			s.logf("discarded email") // reason has been logged above
 		case Pass:
 			if err := s.Ulist.Forward(list, message); err != nil {
 				return SMTPErrorf(451, "sending email: %v", err)
@@ -321,13 +373,18 @@ func (s *lmtpSession) data(r io.Reader) error {
 			if err := s.Ulist.Save(list, message); err != nil {
 				return SMTPErrorf(471, "saving email to file: %v", err)
 			}
-			notifieds, err := s.Ulist.Lists.Notifieds(list)
+			notifieds, err := s.Ulist.Lists.NotifiedsWithMode(list, NotifyImmediate)
 			if err != nil {
 				return SMTPErrorf(451, "getting notifieds from database: %v", err) // 451 Aborted – Local error in processing
 			}
 			if err = s.Ulist.NotifyMods(list, notifieds); err != nil {
 				s.logf("sending moderation notificiation: %v", err)
 			}
+			if list.HeldNotice {
+				if err = s.Ulist.NotifyHeldSender(list, message.Header); err != nil {
+					s.logf("sending held notice to sender: %v", err)
+				}
+			}
 			s.logf("stored email for moderation")
 		}
 	}
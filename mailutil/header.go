@@ -39,6 +39,23 @@ func IsSpam(header mail.Header) (bool, string) {
 	return false, ""
 }
 
+// IsAutoSubmitted detects automatically generated messages like vacation replies, bounces and mailing list traffic, which must not be answered automatically. See RFC 3834.
+func IsAutoSubmitted(header mail.Header) (bool, string) {
+	if val := strings.ToLower(strings.TrimSpace(header.Get("Auto-Submitted"))); val != "" && val != "no" {
+		return true, fmt.Sprintf(`Auto-Submitted is "%s"`, val)
+	}
+	switch val := strings.ToLower(strings.TrimSpace(header.Get("Precedence"))); val {
+	case "bulk", "junk", "list":
+		return true, fmt.Sprintf(`Precedence is "%s"`, val)
+	}
+	for _, key := range []string{"List-Id", "List-Unsubscribe", "X-Autoreply", "X-Autorespond"} {
+		if header.Get(key) != "" {
+			return true, fmt.Sprintf("%s is present", key)
+		}
+	}
+	return false, ""
+}
+
 func IsSpamKey(headerKey string) bool {
 	headerKey = textproto.CanonicalMIMEHeaderKey(headerKey)
 	for _, key := range spamKeys {
@@ -49,6 +66,25 @@ func IsSpamKey(headerKey string) bool {
 	return false
 }
 
+// MessageIDs extracts the msg-ids, including angle brackets, from the value of an In-Reply-To or References header field. Comments and malformed parts are skipped.
+func MessageIDs(value string) []string {
+	var ids []string
+	for {
+		start := strings.Index(value, "<")
+		if start == -1 {
+			return ids
+		}
+		end := strings.Index(value[start:], ">")
+		if end == -1 {
+			return ids
+		}
+		if id := value[start : start+end+1]; strings.Contains(id, "@") && !strings.ContainsAny(id, " \t\r\n") {
+			ids = append(ids, id)
+		}
+		value = value[start+end+1:]
+	}
+}
+
 // ParseAddressesFromHeader parses email addresses from a header line. In contrast to ParseAddresses, parsing is strictly.
 func ParseAddressesFromHeader(header mail.Header, fieldName string, limit int) ([]*Addr, error) {
 
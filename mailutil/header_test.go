@@ -207,3 +207,79 @@ func TestIsSpamKey(t *testing.T) {
 		}
 	}
 }
+
+func TestIsAutoSubmitted(t *testing.T) {
+
+	tests := []struct {
+		header mail.Header
+		expect bool
+	}{
+		{
+			mail.Header{
+				"From":    []string{"alice@example.com"},
+				"Subject": []string{"Hello"},
+			},
+			false,
+		},
+		{
+			mail.Header{
+				"From":           []string{"alice@example.com"},
+				"Subject":        []string{"Hello"},
+				"Auto-Submitted": []string{"no"},
+			},
+			false,
+		},
+		{
+			mail.Header{
+				"From":           []string{"alice@example.com"},
+				"Subject":        []string{"Out of office"},
+				"Auto-Submitted": []string{"auto-replied"},
+			},
+			true,
+		},
+		{
+			mail.Header{
+				"From":       []string{"alice@example.com"},
+				"Subject":    []string{"Hello"},
+				"Precedence": []string{"Bulk"},
+			},
+			true,
+		},
+		{
+			mail.Header{
+				"From":    []string{"alice@example.com"},
+				"Subject": []string{"Hello"},
+				"List-Id": []string{"<foo.example.com>"},
+			},
+			true,
+		},
+	}
+
+	for _, test := range tests {
+		var got, _ = IsAutoSubmitted(test.header)
+		if got != test.expect {
+			t.Errorf("got %v, want %v", got, test.expect)
+		}
+	}
+}
+
+func TestMessageIDs(t *testing.T) {
+
+	tests := []struct {
+		value  string
+		expect []string
+	}{
+		{"", nil},
+		{"<a@example.com>", []string{"<a@example.com>"}},
+		{" <a@example.com>\r\n <b@example.com> ", []string{"<a@example.com>", "<b@example.com>"}},
+		{"<a@example.com> (comment) <b@example.com>", []string{"<a@example.com>", "<b@example.com>"}},
+		{"<no-at> <broken id@example.com> <c@example.com", nil},
+	}
+
+	for _, test := range tests {
+		got := MessageIDs(test.value)
+		if strings.Join(got, ",") != strings.Join(test.expect, ",") {
+			t.Fatalf("got %v, want %v", got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,181 @@
+package mailutil
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// elements which are kept, their content is kept anyway unless they are in droppedElements
+var allowedElements = map[atom.Atom]bool{
+	atom.A: true, atom.Abbr: true, atom.Address: true, atom.B: true, atom.Big: true, atom.Blockquote: true, atom.Br: true,
+	atom.Caption: true, atom.Center: true, atom.Cite: true, atom.Code: true, atom.Col: true, atom.Colgroup: true,
+	atom.Dd: true, atom.Del: true, atom.Div: true, atom.Dl: true, atom.Dt: true, atom.Em: true, atom.Font: true,
+	atom.H1: true, atom.H2: true, atom.H3: true, atom.H4: true, atom.H5: true, atom.H6: true, atom.Hr: true,
+	atom.I: true, atom.Img: true, atom.Ins: true, atom.Li: true, atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Q: true, atom.S: true, atom.Small: true, atom.Span: true, atom.Strike: true, atom.Strong: true,
+	atom.Sub: true, atom.Sup: true, atom.Table: true, atom.Tbody: true, atom.Td: true, atom.Tfoot: true,
+	atom.Th: true, atom.Thead: true, atom.Tr: true, atom.U: true, atom.Ul: true,
+}
+
+// elements which are removed including their content
+var droppedElements = map[atom.Atom]bool{
+	atom.Applet: true, atom.Audio: true, atom.Button: true, atom.Embed: true, atom.Frame: true, atom.Frameset: true,
+	atom.Iframe: true, atom.Math: true, atom.Noscript: true, atom.Object: true, atom.Script: true,
+	atom.Select: true, atom.Style: true, atom.Svg: true, atom.Template: true, atom.Textarea: true, atom.Title: true,
+	atom.Video: true,
+}
+
+var allowedAttributes = map[string]bool{
+	"align": true, "alt": true, "bgcolor": true, "border": true, "cellpadding": true, "cellspacing": true,
+	"color": true, "colspan": true, "dir": true, "face": true, "height": true, "lang": true, "rowspan": true,
+	"size": true, "style": true, "title": true, "valign": true, "width": true,
+	// handled separately
+	"href": true, "src": true,
+}
+
+// SanitizeHTML returns a safe subset of the given HTML. Scripts, forms, frames and event handlers are removed. Links are kept if they use http, https or mailto. Remote images are blocked. Image sources with a "cid:" URL are replaced by the result of inline, or removed if inline returns false.
+func SanitizeHTML(input string, inline func(contentID string) (string, bool)) string {
+
+	var b strings.Builder
+	var dropDepth int // > 0 while we're inside a dropped element
+	var tokenizer = html.NewTokenizer(strings.NewReader(input))
+
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			return b.String() // io.EOF or a tokenizer error
+		}
+
+		token := tokenizer.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedElements[token.DataAtom] {
+				if tt == html.StartTagToken && !isVoid(token.DataAtom) {
+					dropDepth++
+				}
+				continue
+			}
+			if dropDepth > 0 || !allowedElements[token.DataAtom] {
+				continue
+			}
+			token.Attr = sanitizeAttributes(token, inline)
+			if token.DataAtom == atom.A {
+				token.Attr = append(token.Attr, html.Attribute{Key: "target", Val: "_blank"}, html.Attribute{Key: "rel", Val: "noopener noreferrer"})
+			}
+			b.WriteString(token.String())
+		case html.EndTagToken:
+			if droppedElements[token.DataAtom] {
+				if dropDepth > 0 {
+					dropDepth--
+				}
+				continue
+			}
+			if dropDepth > 0 || !allowedElements[token.DataAtom] {
+				continue
+			}
+			b.WriteString(token.String())
+		case html.TextToken:
+			if dropDepth > 0 {
+				continue
+			}
+			b.WriteString(token.String()) // escapes the text
+		}
+		// comments and doctypes are dropped
+	}
+}
+
+func isVoid(a atom.Atom) bool {
+	switch a {
+	case atom.Embed, atom.Frame:
+		return true
+	}
+	return false
+}
+
+func sanitizeAttributes(token html.Token, inline func(string) (string, bool)) []html.Attribute {
+	var result []html.Attribute
+	for _, attr := range token.Attr {
+		key := strings.ToLower(attr.Key)
+		if attr.Namespace != "" || !allowedAttributes[key] {
+			continue
+		}
+		switch key {
+		case "href":
+			if token.DataAtom != atom.A || !hasScheme(attr.Val, "http:", "https:", "mailto:") {
+				continue
+			}
+		case "src":
+			if token.DataAtom != atom.Img {
+				continue
+			}
+			if !hasScheme(attr.Val, "cid:") {
+				continue // blocks remote content and tracking pixels
+			}
+			replacement, ok := inline(strings.TrimSpace(attr.Val)[len("cid:"):])
+			if !ok {
+				continue
+			}
+			attr.Val = replacement
+		case "style":
+			// url() could load remote content, expression() is executed by ancient browsers, backslashes could hide both
+			lower := strings.ToLower(attr.Val)
+			if strings.Contains(lower, "url") || strings.Contains(lower, "expression") || strings.Contains(lower, "\\") || strings.Contains(lower, "@import") {
+				continue
+			}
+		}
+		result = append(result, html.Attribute{Key: key, Val: attr.Val})
+	}
+	return result
+}
+
+func hasScheme(url string, schemes ...string) bool {
+	url = strings.ToLower(strings.TrimSpace(url))
+	for _, scheme := range schemes {
+		if strings.HasPrefix(url, scheme) {
+			return true
+		}
+	}
+	return false
+}
+
+// HTMLText returns the text content of the given HTML, e.g. for a search index. The content of scripts, styles and other dropped elements is omitted. Line breaks are inserted after block elements.
+func HTMLText(input string) string {
+
+	var b strings.Builder
+	var dropDepth int
+	var tokenizer = html.NewTokenizer(strings.NewReader(input))
+
+	for {
+		tt := tokenizer.Next()
+		if tt == html.ErrorToken {
+			return strings.TrimSpace(b.String())
+		}
+
+		token := tokenizer.Token()
+
+		switch tt {
+		case html.StartTagToken, html.SelfClosingTagToken:
+			if droppedElements[token.DataAtom] && tt == html.StartTagToken && !isVoid(token.DataAtom) {
+				dropDepth++
+			}
+			if token.DataAtom == atom.Br {
+				b.WriteString("\n")
+			}
+		case html.EndTagToken:
+			if droppedElements[token.DataAtom] && dropDepth > 0 {
+				dropDepth--
+			}
+			switch token.DataAtom {
+			case atom.Div, atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Li, atom.P, atom.Tr:
+				b.WriteString("\n")
+			}
+		case html.TextToken:
+			if dropDepth == 0 {
+				b.WriteString(token.Data) // unescaped
+			}
+		}
+	}
+}
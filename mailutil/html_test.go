@@ -0,0 +1,55 @@
+package mailutil
+
+import "testing"
+
+func TestSanitizeHTML(t *testing.T) {
+
+	inline := func(contentID string) (string, bool) {
+		if contentID == "logo@example.com" {
+			return "data:image/png;base64,AAAA", true
+		}
+		return "", false
+	}
+
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{`<p onclick="alert(1)">Hi</p>`, `<p>Hi</p>`},
+		{`<script>alert(1)</script>Hi`, `Hi`},
+		{`<style>body { background: url(https://tracker.example.com) }</style>Hi`, `Hi`},
+		{`<a href="javascript:alert(1)">Hi</a>`, `<a target="_blank" rel="noopener noreferrer">Hi</a>`},
+		{`<a href="https://example.com">Hi</a>`, `<a href="https://example.com" target="_blank" rel="noopener noreferrer">Hi</a>`},
+		{`<img src="https://tracker.example.com/pixel.gif">`, `<img>`},
+		{`<img src="cid:logo@example.com" alt="Logo">`, `<img src="data:image/png;base64,AAAA" alt="Logo">`},
+		{`<img src="cid:unknown@example.com">`, `<img>`},
+		{`<div style="color: red">Hi</div>`, `<div style="color: red">Hi</div>`},
+		{`<div style="background: url(https://tracker.example.com)">Hi</div>`, `<div>Hi</div>`},
+		{`<form action="https://example.com"><input name="password"></form>`, ``},
+		{`<iframe src="https://example.com">Hi</iframe>Hello`, `Hello`},
+		{`<html><head><title>Title</title></head><body>Hi &lt;3</body></html>`, `Hi &lt;3`},
+	}
+
+	for _, test := range tests {
+		if got := SanitizeHTML(test.input, inline); got != test.expect {
+			t.Errorf("got %s, want %s", got, test.expect)
+		}
+	}
+}
+
+func TestHTMLText(t *testing.T) {
+
+	tests := []struct {
+		input  string
+		expect string
+	}{
+		{`<p>Hello</p><p>World &amp; all</p>`, "Hello\nWorld & all"},
+		{`<style>p { color: red }</style><script>alert(1)</script>Hi<br>there`, "Hi\nthere"},
+	}
+
+	for _, test := range tests {
+		if got := HTMLText(test.input); got != test.expect {
+			t.Errorf("got %q, want %q", got, test.expect)
+		}
+	}
+}
@@ -0,0 +1,156 @@
+package mailutil
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"time"
+)
+
+// mboxrd, see https://www.loc.gov/preservation/digital/formats/fdd/fdd000385.shtml
+//
+// Each message begins with a "From " line. Lines of the message which match /^>*From / get one more ">". Line endings are LF.
+
+// MboxWriter writes messages in the mboxrd format.
+type MboxWriter struct {
+	w *bufio.Writer
+}
+
+func NewMboxWriter(w io.Writer) *MboxWriter {
+	return &MboxWriter{
+		w: bufio.NewWriter(w),
+	}
+}
+
+// Write writes a message. The sender should be an address without spaces, like the envelope sender. CRLF line endings are converted to LF.
+func (mw *MboxWriter) Write(sender string, t time.Time, raw []byte) error {
+
+	sender = strings.Join(strings.Fields(sender), "")
+	if sender == "" {
+		sender = "MAILER-DAEMON"
+	}
+
+	if _, err := mw.w.WriteString("From " + sender + " " + t.UTC().Format(time.ANSIC) + "\n"); err != nil {
+		return err
+	}
+
+	for len(raw) > 0 {
+		var line []byte
+		if i := bytes.IndexByte(raw, '\n'); i >= 0 {
+			line, raw = raw[:i], raw[i+1:]
+		} else {
+			line, raw = raw, nil
+		}
+		line = bytes.TrimSuffix(line, []byte("\r"))
+		if isFromLine(bytes.TrimLeft(line, ">")) {
+			mw.w.WriteByte('>')
+		}
+		mw.w.Write(line)
+		mw.w.WriteByte('\n')
+	}
+
+	// empty line between messages
+	_, err := mw.w.WriteString("\n")
+	return err
+}
+
+// Flush must be called after the last message has been written.
+func (mw *MboxWriter) Flush() error {
+	return mw.w.Flush()
+}
+
+// MboxReader reads messages in the mboxrd format. It accepts the mboxo format as well, but quoted "From " lines remain quoted then.
+type MboxReader struct {
+	r        *bufio.Reader
+	fromLine string // "From " line of the next message, without line ending
+}
+
+func NewMboxReader(r io.Reader) *MboxReader {
+	return &MboxReader{
+		r: bufio.NewReader(r),
+	}
+}
+
+// Next returns the next message with LF line endings and the time of its "From " line, which is zero if it can't be parsed. It returns io.EOF after the last message.
+func (mr *MboxReader) Next() ([]byte, time.Time, error) {
+
+	// find the first "From " line
+
+	for mr.fromLine == "" {
+		line, err := mr.readLine()
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if isFromLine([]byte(line)) {
+			mr.fromLine = line
+			break
+		}
+		if strings.TrimSpace(line) != "" {
+			return nil, time.Time{}, errors.New("mbox does not start with a \"From \" line")
+		}
+	}
+
+	t := parseFromLineTime(mr.fromLine)
+	mr.fromLine = ""
+
+	var buf bytes.Buffer
+	for {
+		line, err := mr.readLine()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, time.Time{}, err
+		}
+		if isFromLine([]byte(line)) {
+			mr.fromLine = line
+			break
+		}
+		if unquoted := strings.TrimPrefix(line, ">"); isFromLine([]byte(strings.TrimLeft(unquoted, ">"))) {
+			line = unquoted
+		}
+		buf.WriteString(line)
+		buf.WriteByte('\n')
+	}
+
+	// remove the empty line which separates messages
+	raw := bytes.TrimSuffix(buf.Bytes(), []byte("\n"))
+	if !bytes.HasSuffix(raw, []byte("\n")) {
+		raw = append(raw, '\n')
+	}
+
+	return raw, t, nil
+}
+
+// readLine returns the next line without line ending. It returns io.EOF only if there is nothing left.
+func (mr *MboxReader) readLine() (string, error) {
+	line, err := mr.r.ReadString('\n')
+	if err == io.EOF && line != "" {
+		err = nil
+	}
+	if err != nil {
+		return "", err
+	}
+	line = strings.TrimSuffix(line, "\n")
+	line = strings.TrimSuffix(line, "\r")
+	return line, nil
+}
+
+func isFromLine(line []byte) bool {
+	return bytes.HasPrefix(line, []byte("From "))
+}
+
+// parseFromLineTime parses lines like "From alice@example.com Mon Jan  2 15:04:05 2006". Some writers append a time zone, which is ignored.
+func parseFromLineTime(fromLine string) time.Time {
+	fields := strings.Fields(fromLine)
+	if len(fields) < 7 {
+		return time.Time{}
+	}
+	t, err := time.Parse(time.ANSIC, strings.Join(fields[2:7], " "))
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
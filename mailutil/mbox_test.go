@@ -0,0 +1,70 @@
+package mailutil
+
+import (
+	"bytes"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestMbox(t *testing.T) {
+
+	messages := []string{
+		"Subject: one\r\n\r\nFrom the start\r\n>From quoted\r\nplain line\r\n",
+		"Subject: two\n\nno final line break",
+		"Subject: three\n\n\n>>From twice\n\n",
+	}
+	expected := []string{
+		"Subject: one\n\nFrom the start\n>From quoted\nplain line\n",
+		"Subject: two\n\nno final line break\n",
+		"Subject: three\n\n\n>>From twice\n\n",
+	}
+	expectedMbox := "From alice@example.com Mon Jan  2 15:04:05 2006\nSubject: one\n\n>From the start\n>>From quoted\nplain line\n\n" +
+		"From MAILER-DAEMON Mon Jan  2 15:04:05 2006\nSubject: two\n\nno final line break\n\n" +
+		"From MAILER-DAEMON Mon Jan  2 15:04:05 2006\nSubject: three\n\n\n>>>From twice\n\n\n"
+
+	date := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+
+	var buf bytes.Buffer
+	mw := NewMboxWriter(&buf)
+	for i, message := range messages {
+		var sender string
+		if i == 0 {
+			sender = "alice@example.com"
+		}
+		if err := mw.Write(sender, date, []byte(message)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := mw.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := buf.String(); got != expectedMbox {
+		t.Fatalf("got mbox %q, want %q", got, expectedMbox)
+	}
+
+	mr := NewMboxReader(&buf)
+	for i := range expected {
+		raw, tm, err := mr.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(raw) != expected[i] {
+			t.Fatalf("message %d: got %q, want %q", i, raw, expected[i])
+		}
+		if !tm.Equal(date) {
+			t.Fatalf("message %d: got time %v, want %v", i, tm, date)
+		}
+	}
+	if _, _, err := mr.Next(); err != io.EOF {
+		t.Fatalf("got %v, want io.EOF", err)
+	}
+}
+
+func TestMboxReaderInvalid(t *testing.T) {
+	mr := NewMboxReader(bytes.NewReader([]byte("Subject: no mbox\n\nbody\n")))
+	if _, _, err := mr.Next(); err == nil || err == io.EOF {
+		t.Fatalf("got %v, want error", err)
+	}
+}
@@ -0,0 +1,257 @@
+package mailutil
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/textproto"
+	"strings"
+
+	"golang.org/x/text/encoding/htmlindex"
+)
+
+// maxPartDepth limits the nesting of multipart bodies, so malicious messages can't exhaust the stack.
+const maxPartDepth = 16
+
+// Part is a node of the MIME tree of a message. Multipart nodes have Parts, leaf nodes have a Body.
+type Part struct {
+	Header    textproto.MIMEHeader
+	MediaType string // lowercase, like "text/plain", defaults to "text/plain" if the Content-Type is missing or invalid
+	Params    map[string]string
+	Body      []byte // decoded from the Content-Transfer-Encoding, but not from the charset
+	Parts     []*Part
+}
+
+// ParseParts parses the MIME tree of the message.
+func (m *Message) ParseParts() (*Part, error) {
+	return parsePart(textproto.MIMEHeader(m.Header), m.BodyReader(), 0)
+}
+
+func parsePart(header textproto.MIMEHeader, body io.Reader, depth int) (*Part, error) {
+
+	if depth > maxPartDepth {
+		return nil, errors.New("multipart nesting is too deep")
+	}
+
+	mediaType, params, err := mime.ParseMediaType(header.Get("Content-Type"))
+	if err != nil {
+		mediaType = "text/plain"
+		params = map[string]string{}
+	}
+
+	part := &Part{
+		Header:    header,
+		MediaType: mediaType,
+		Params:    params,
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") && params["boundary"] != "" {
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			p, err := reader.NextRawPart() // don't let multipart decode quoted-printable, we do it ourselves
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				return nil, err
+			}
+			child, err := parsePart(p.Header, p, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			part.Parts = append(part.Parts, child)
+		}
+		return part, nil
+	}
+
+	switch strings.ToLower(strings.TrimSpace(header.Get("Content-Transfer-Encoding"))) {
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, body) // ignores line breaks
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	}
+
+	part.Body, err = io.ReadAll(body)
+	if err != nil {
+		// keep what has been decoded so far, broken encodings are common
+		if len(part.Body) == 0 {
+			return nil, err
+		}
+	}
+
+	return part, nil
+}
+
+// Leaves returns the non-multipart nodes of the tree in depth-first order.
+func (p *Part) Leaves() []*Part {
+	if len(p.Parts) == 0 {
+		return []*Part{p}
+	}
+	var leaves []*Part
+	for _, child := range p.Parts {
+		leaves = append(leaves, child.Leaves()...)
+	}
+	return leaves
+}
+
+// ContentID returns the Content-ID without angle brackets.
+func (p *Part) ContentID() string {
+	return strings.Trim(strings.TrimSpace(p.Header.Get("Content-ID")), "<>")
+}
+
+// Filename returns the decoded filename from the Content-Disposition or, as a fallback, the name parameter of the Content-Type.
+func (p *Part) Filename() string {
+	if _, params, err := mime.ParseMediaType(p.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return RobustWordDecode(params["filename"])
+	}
+	return RobustWordDecode(p.Params["name"])
+}
+
+// IsAttachment returns whether the part is explicitly marked as an attachment or has a filename.
+func (p *Part) IsAttachment() bool {
+	if disposition, _, err := mime.ParseMediaType(p.Header.Get("Content-Disposition")); err == nil && disposition == "attachment" {
+		return true
+	}
+	return p.Filename() != ""
+}
+
+// Text returns the body converted from its charset to UTF-8. Unknown charsets are ignored.
+func (p *Part) Text() string {
+	if charset := p.Params["charset"]; charset != "" {
+		if enc, err := htmlindex.Get(charset); err == nil {
+			if decoded, err := enc.NewDecoder().Bytes(p.Body); err == nil {
+				return string(decoded)
+			}
+		}
+	}
+	return string(p.Body)
+}
+
+// SetText replaces the body of a text part and sets its charset to UTF-8.
+func (p *Part) SetText(text string) {
+	p.Body = []byte(text)
+	p.Params["charset"] = "utf-8"
+	p.Header.Set("Content-Type", mime.FormatMediaType(p.MediaType, p.Params))
+}
+
+// RemoveLeaves removes the leaves whose index in Leaves() is contained in indexes. If the part itself is a leaf, it is not removed.
+func (p *Part) RemoveLeaves(indexes map[int]bool) {
+	var index int
+	p.removeLeaves(indexes, &index)
+}
+
+func (p *Part) removeLeaves(indexes map[int]bool, index *int) {
+	if len(p.Parts) == 0 {
+		*index++
+		return
+	}
+	var kept []*Part
+	for _, child := range p.Parts {
+		if len(child.Parts) == 0 && indexes[*index] {
+			*index++
+			continue
+		}
+		child.removeLeaves(indexes, index)
+		kept = append(kept, child)
+	}
+	p.Parts = kept
+}
+
+// KeepAlternative replaces each multipart/alternative part which contains keep by its alternative which contains keep, so other versions of the same content are removed. It returns the new root, which differs from p if p is multipart/alternative.
+func (p *Part) KeepAlternative(keep *Part) *Part {
+	for i, child := range p.Parts {
+		if child.contains(keep) {
+			p.Parts[i] = child.KeepAlternative(keep)
+			if p.MediaType == "multipart/alternative" {
+				return p.Parts[i]
+			}
+			break
+		}
+	}
+	return p
+}
+
+func (p *Part) contains(q *Part) bool {
+	if p == q {
+		return true
+	}
+	for _, child := range p.Parts {
+		if child.contains(q) {
+			return true
+		}
+	}
+	return false
+}
+
+// SetParts replaces the body of the message by the encoded MIME tree and updates the MIME header fields.
+func (m *Message) SetParts(root *Part) error {
+	body, err := root.encode()
+	if err != nil {
+		return err
+	}
+	m.Body = body
+	for _, key := range []string{"Content-Type", "Content-Transfer-Encoding"} {
+		if values, ok := root.Header[key]; ok {
+			m.Header[key] = values
+		} else {
+			delete(m.Header, key)
+		}
+	}
+	return nil
+}
+
+// encode returns the encoded body of the part. Multipart bodies get a new boundary, leaves are encoded in quoted-printable (text) or base64 (everything else). The header of the part is updated accordingly.
+func (p *Part) encode() ([]byte, error) {
+
+	var buf bytes.Buffer
+
+	if len(p.Parts) > 0 {
+		writer := multipart.NewWriter(&buf) // new random boundary, because edited text could contain the old one
+		for _, child := range p.Parts {
+			body, err := child.encode()
+			if err != nil {
+				return nil, err
+			}
+			w, err := writer.CreatePart(child.Header)
+			if err != nil {
+				return nil, err
+			}
+			if _, err := w.Write(body); err != nil {
+				return nil, err
+			}
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		p.Params["boundary"] = writer.Boundary()
+		p.Header.Set("Content-Type", mime.FormatMediaType(p.MediaType, p.Params))
+		p.Header.Del("Content-Transfer-Encoding")
+		return buf.Bytes(), nil
+	}
+
+	if strings.HasPrefix(p.MediaType, "text/") {
+		w := quotedprintable.NewWriter(&buf)
+		if _, err := w.Write(p.Body); err != nil {
+			return nil, err
+		}
+		if err := w.Close(); err != nil {
+			return nil, err
+		}
+		p.Header.Set("Content-Transfer-Encoding", "quoted-printable")
+		return buf.Bytes(), nil
+	}
+
+	encoded := base64.StdEncoding.EncodeToString(p.Body)
+	for len(encoded) > 76 {
+		buf.WriteString(encoded[:76])
+		buf.WriteString("\r\n")
+		encoded = encoded[76:]
+	}
+	buf.WriteString(encoded)
+	p.Header.Set("Content-Transfer-Encoding", "base64")
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,179 @@
+package mailutil
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseParts(t *testing.T) {
+
+	msg, err := ReadMessage(strings.NewReader("Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n" +
+		"Content-Transfer-Encoding: quoted-printable\r\n\r\n" +
+		"Gr=FC=DFe\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<p>Hello</p>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=\"=?utf-8?q?r=C3=A9sum=C3=A9.pdf?=\"\r\n" +
+		"Content-Transfer-Encoding: base64\r\n\r\n" +
+		"SGVs\r\nbG8=\r\n" +
+		"--outer--\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := msg.ParseParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaves := root.Leaves()
+	if len(leaves) != 3 {
+		t.Fatalf("got %d leaves, want 3", len(leaves))
+	}
+
+	if got := leaves[0].Text(); got != "Grüße" {
+		t.Errorf("got text %q, want %q", got, "Grüße")
+	}
+	if leaves[0].IsAttachment() {
+		t.Error("text part is an attachment")
+	}
+
+	if leaves[1].MediaType != "text/html" {
+		t.Errorf("got media type %s, want text/html", leaves[1].MediaType)
+	}
+
+	if !leaves[2].IsAttachment() {
+		t.Error("pdf part is not an attachment")
+	}
+	if got := leaves[2].Filename(); got != "résumé.pdf" {
+		t.Errorf("got filename %q, want %q", got, "résumé.pdf")
+	}
+	if got := string(leaves[2].Body); got != "Hello" {
+		t.Errorf("got body %q, want %q", got, "Hello")
+	}
+}
+
+func TestSetParts(t *testing.T) {
+
+	msg, err := ReadMessage(strings.NewReader("Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\n" +
+		"Content-Type: text/plain; charset=iso-8859-1\r\n\r\n" +
+		"Hello\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=a.pdf\r\n\r\n" +
+		"PDF\r\n" +
+		"--outer\r\n" +
+		"Content-Type: image/png; name=b.png\r\n\r\n" +
+		"PNG\r\n" +
+		"--outer--\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := msg.ParseParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root.Leaves()[0].SetText("Grüße\r\n--outer\r\n")
+	root.RemoveLeaves(map[int]bool{1: true})
+
+	if err := msg.SetParts(root); err != nil {
+		t.Fatal(err)
+	}
+
+	reparsed, err := msg.ParseParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	leaves := reparsed.Leaves()
+	if len(leaves) != 2 {
+		t.Fatalf("got %d leaves, want 2", len(leaves))
+	}
+	if got := leaves[0].Text(); got != "Grüße\r\n--outer\r\n" {
+		t.Errorf("got text %q", got)
+	}
+	if got := leaves[1].Filename(); got != "b.png" {
+		t.Errorf("got filename %q, want b.png", got)
+	}
+	if got := string(leaves[1].Body); got != "PNG" {
+		t.Errorf("got body %q, want PNG", got)
+	}
+}
+
+func TestKeepAlternative(t *testing.T) {
+
+	msg, err := ReadMessage(strings.NewReader("Content-Type: multipart/alternative; boundary=alt\r\n\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/plain; charset=utf-8\r\n\r\n" +
+		"Call me at 555-1234\r\n" +
+		"--alt\r\n" +
+		"Content-Type: text/html; charset=utf-8\r\n\r\n" +
+		"<p>Call me at 555-1234</p>\r\n" +
+		"--alt--\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	root, err := msg.ParseParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text := root.Leaves()[0]
+	text.SetText("Call me")
+	root = root.KeepAlternative(text)
+	if err := msg.SetParts(root); err != nil {
+		t.Fatal(err)
+	}
+
+	// parse again
+
+	root, err = msg.ParseParts()
+	if err != nil {
+		t.Fatal(err)
+	}
+	leaves := root.Leaves()
+	if len(leaves) != 1 || leaves[0].MediaType != "text/plain" || leaves[0].Text() != "Call me" {
+		t.Fatalf("got leaves %+v, want the edited text only", leaves)
+	}
+	if strings.Contains(string(msg.Body), "555-1234") {
+		t.Errorf("message still contains the removed text: %q", msg.Body)
+	}
+	if got := msg.Header.Get("Content-Type"); !strings.HasPrefix(got, "text/plain") {
+		t.Errorf("got Content-Type %q, want text/plain", got)
+	}
+
+	// nested in multipart/mixed, the attachment is kept
+
+	msg, _ = ReadMessage(strings.NewReader("Content-Type: multipart/mixed; boundary=outer\r\n\r\n" +
+		"--outer\r\n" +
+		"Content-Type: multipart/alternative; boundary=inner\r\n\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/plain\r\n\r\n" +
+		"Hello\r\n" +
+		"--inner\r\n" +
+		"Content-Type: text/html\r\n\r\n" +
+		"<p>Hello</p>\r\n" +
+		"--inner--\r\n" +
+		"--outer\r\n" +
+		"Content-Type: application/pdf; name=a.pdf\r\n\r\n" +
+		"pdf\r\n" +
+		"--outer--\r\n"))
+	root, _ = msg.ParseParts()
+	root = root.KeepAlternative(root.Leaves()[0])
+	var types []string
+	for _, leaf := range root.Leaves() {
+		types = append(types, leaf.MediaType)
+	}
+	if root.MediaType != "multipart/mixed" || strings.Join(types, ",") != "text/plain,application/pdf" {
+		t.Errorf("got %s with leaves %v", root.MediaType, types)
+	}
+}
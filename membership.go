@@ -7,6 +7,22 @@ type Membership struct {
 	Receive       bool
 	Moderate      bool
 	Notify        bool
+	NotifyMode    NotifyMode
+	Delivery      Delivery
 	Admin         bool
 	Bounces       bool
 }
+
+// CanReadArchive returns whether the archive of the list is enabled and can be read with this membership. Use an empty Membership for visitors who are not logged in.
+func (m Membership) CanReadArchive() bool {
+	switch m.Archive {
+	case ArchivePublic:
+		return true
+	case ArchiveMembers:
+		return m.Member || m.Moderate || m.Admin
+	case ArchiveModerators:
+		return m.Moderate || m.Admin
+	default:
+		return false
+	}
+}
@@ -1,15 +1,22 @@
 package ulist
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"log"
 	"net/mail"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/wansing/ulist/mailutil"
+	"github.com/wansing/ulist/txt"
 )
 
 // caller must close the returned file
@@ -74,9 +81,406 @@ func (u *Ulist) Save(list *List, m *mailutil.Message) error {
 	return nil
 }
 
+// Overwrite replaces a moderated message, e.g. after a moderator has edited it. The file is replaced atomically and keeps its name.
+func (u *Ulist) Overwrite(list *List, filename string, m *mailutil.Message) error {
+	if strings.Contains(filename, "..") || strings.Contains(filename, "/") {
+		return errors.New("invalid filename")
+	}
+
+	file, err := os.CreateTemp(u.StorageFolder(list.ListInfo), "edit-*.tmp")
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	if err := m.Save(file); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	if err := file.Close(); err != nil {
+		_ = os.Remove(file.Name())
+		return err
+	}
+
+	return os.Rename(file.Name(), filepath.Join(u.StorageFolder(list.ListInfo), filename))
+}
+
 func (u *Ulist) DeleteModeratedMail(list *List, filename string) error {
 	if filename == "" {
 		return errors.New("delete: filename is empty")
 	}
 	return os.Remove(u.StorageFolder(list.ListInfo) + "/" + filename)
 }
+
+// StoredFilenames returns the names of up to limit moderated messages of the list, in no particular order.
+func (u *Ulist) StoredFilenames(list *List, limit int) ([]string, error) {
+	folder, err := os.Open(u.StorageFolder(list.ListInfo))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil // the folder is created when the first message is moderated
+		}
+		return nil, err
+	}
+	defer folder.Close()
+
+	filenames, err := folder.Readdirnames(limit)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	return filenames, nil
+}
+
+// StoredTime extracts the time when a moderated message has been saved from its filename.
+func StoredTime(filename string) (time.Time, bool) {
+	prefix, _, found := strings.Cut(filename, "-")
+	if !found {
+		return time.Time{}, false
+	}
+	unix, err := strconv.ParseInt(prefix, 10, 64)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return time.Unix(unix, 0), true
+}
+
+// ExpireModeratedMails deletes the moderated messages which are older than list.ModExpiry days. If configured, it notifies the senders and moderators.
+func (u *Ulist) ExpireModeratedMails(list *List) (int, error) {
+
+	if list.ModExpiry <= 0 {
+		return 0, nil
+	}
+
+	filenames, err := u.StoredFilenames(list, -1)
+	if err != nil {
+		return 0, err
+	}
+
+	var deadline = time.Now().AddDate(0, 0, -1*list.ModExpiry)
+	var expired = 0
+	var notifiedSenders = make(map[string]struct{}) // one notice per sender and run
+
+	for _, filename := range filenames {
+
+		stored, ok := StoredTime(filename)
+		if !ok || stored.After(deadline) {
+			continue
+		}
+
+		header, err := u.ReadHeader(list, filename) // err is evaluated below, we delete unparseable messages anyway
+
+		if err := u.DeleteModeratedMail(list, filename); err != nil {
+			return expired, err
+		}
+		expired++
+		u.Audit(list, nil, DecisionExpire, header)
+
+		if list.ExpiryNotifySender && err == nil {
+			if from, ok := mailutil.SingleFrom(header); ok {
+				if _, done := notifiedSenders[from.RFC5322AddrSpec()]; !done {
+					notifiedSenders[from.RFC5322AddrSpec()] = struct{}{}
+					if err := u.notifyExpiredSender(list, header); err != nil {
+						log.Printf("error sending expiry notice to sender: %v", err)
+					}
+				}
+			}
+		}
+	}
+
+	if list.ExpiryNotifyMods && expired > 0 {
+		if err := u.notifyModsExpired(list, expired); err != nil {
+			log.Printf("error sending expiry notification to moderators: %v", err)
+		}
+	}
+
+	return expired, nil
+}
+
+func (u *Ulist) notifyExpiredSender(list *List, header mail.Header) error {
+
+	body := &bytes.Buffer{}
+	data := txt.ExpiredNoticeData{
+		Days:        list.ModExpiry,
+		ListAddress: list.RFC5322AddrSpec(),
+		Subject:     mailutil.RobustWordDecode(header.Get("Subject")),
+	}
+
+	if err := txt.ExpiredNotice.Execute(body, data); err != nil {
+		return err
+	}
+
+	_, err := u.autoReply(list, header, "Your message has not been moderated", body)
+	return err
+}
+
+func (u *Ulist) notifyModsExpired(list *List, count int) error {
+
+	notifieds, err := u.Lists.Notifieds(list)
+	if err != nil {
+		return err
+	}
+
+	var footer string
+	var settingsUrl string
+	if u.Web != nil {
+		footer = u.Web.FooterPlain(list)
+		settingsUrl = u.Web.SettingsUrl(list)
+	}
+
+	body := &bytes.Buffer{}
+	data := txt.NotifyModsExpiredData{
+		Count:        count,
+		Days:         list.ModExpiry,
+		Footer:       footer,
+		ListNameAddr: list.RFC5322NameAddr(),
+		SettingsHref: settingsUrl,
+	}
+
+	if err := txt.NotifyModsExpired.Execute(body, data); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, notified := range notifieds {
+		if err := u.Notify(list, notified, "Unmoderated messages have been deleted", bytes.NewReader(body.Bytes())); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// expireAllModeratedMails runs ExpireModeratedMails on all lists.
+func (u *Ulist) expireAllModeratedMails() {
+
+	lists, err := u.Lists.AllLists()
+	if err != nil {
+		log.Printf("error getting lists for moderation expiry: %v", err)
+		return
+	}
+
+	for _, li := range lists {
+		list, err := u.Lists.GetList(&li.Addr)
+		if err != nil || list == nil {
+			log.Printf("error getting list %s for moderation expiry: %v", li.RFC5322AddrSpec(), err)
+			continue
+		}
+		expired, err := u.ExpireModeratedMails(list)
+		if err != nil {
+			log.Printf("error expiring moderated messages of %s: %v", list, err)
+		}
+		if expired > 0 {
+			log.Printf("deleted %d expired moderated messages of %s", expired, list)
+		}
+	}
+}
+
+// modDigestJob is the name of the job which sends the moderation digests of a list with the given notify mode.
+func modDigestJob(li ListInfo, mode NotifyMode) string {
+	return fmt.Sprintf("mod-digest-%s-%d", mode, li.ID)
+}
+
+// SendModDigest sends a summary of the messages which have been held since the last digest to the notified members with the given mode. It does nothing if the interval of the mode has not passed yet. The time of the last digest is stored in the database, so the schedule survives restarts.
+func (u *Ulist) SendModDigest(list *List, mode NotifyMode, now time.Time) error {
+
+	if mode.Interval() == 0 {
+		return nil
+	}
+
+	jobName := modDigestJob(list.ListInfo, mode)
+
+	last, err := u.Lists.LastRun(jobName)
+	if err != nil {
+		return err
+	}
+	if last.IsZero() {
+		last = now.Add(-mode.Interval()) // first run
+	}
+	if now.Sub(last) < mode.Interval() {
+		return nil
+	}
+
+	notifieds, err := u.Lists.NotifiedsWithMode(list, mode)
+	if err != nil {
+		return err
+	}
+
+	var messages []txt.DigestMessage
+
+	if len(notifieds) > 0 {
+
+		filenames, err := u.StoredFilenames(list, -1)
+		if err != nil {
+			return err
+		}
+		sort.Strings(filenames) // oldest first
+
+		for _, filename := range filenames {
+			stored, ok := StoredTime(filename)
+			if !ok || !stored.After(last) || stored.After(now) {
+				continue
+			}
+			header, err := u.ReadHeader(list, filename)
+			if err != nil {
+				messages = append(messages, txt.DigestMessage{Subject: "(unreadable message)"})
+				continue
+			}
+			message := txt.DigestMessage{
+				From:    mailutil.RobustWordDecode(header.Get("From")),
+				Subject: mailutil.RobustWordDecode(header.Get("Subject")),
+			}
+			if isSpam, reason := mailutil.IsSpam(header); isSpam {
+				message.Spam = reason
+			}
+			messages = append(messages, message)
+		}
+	}
+
+	// set last run before sending, so a failing MTA doesn't cause duplicate digests
+
+	if err := u.Lists.SetLastRun(jobName, now); err != nil {
+		return err
+	}
+
+	if len(messages) == 0 {
+		return nil
+	}
+
+	var footer string
+	var modUrl string
+	if u.Web != nil {
+		footer = u.Web.FooterPlain(list)
+		modUrl = u.Web.ModUrl(list)
+	}
+
+	body := &bytes.Buffer{}
+	data := txt.NotifyModsDigestData{
+		Footer:       footer,
+		ListNameAddr: list.RFC5322NameAddr(),
+		Messages:     messages,
+		ModHref:      modUrl,
+	}
+
+	if err := txt.NotifyModsDigest.Execute(body, data); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, notified := range notifieds {
+		if err := u.Notify(list, notified, fmt.Sprintf("%d messages need moderation", len(messages)), bytes.NewReader(body.Bytes())); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+func (u *Ulist) sendAllModDigests() {
+
+	lists, err := u.Lists.AllLists()
+	if err != nil {
+		log.Printf("error getting lists for moderation digests: %v", err)
+		return
+	}
+
+	now := time.Now()
+
+	for _, li := range lists {
+		list, err := u.Lists.GetList(&li.Addr)
+		if err != nil || list == nil {
+			log.Printf("error getting list %s for moderation digests: %v", li.RFC5322AddrSpec(), err)
+			continue
+		}
+		for _, mode := range NotifyModes {
+			if err := u.SendModDigest(list, mode, now); err != nil {
+				log.Printf("error sending %s moderation digest of %s: %v", mode, list, err)
+			}
+		}
+	}
+}
+
+// ModFilter selects moderated messages. Empty fields match everything.
+type ModFilter struct {
+	Sender  string    // case-insensitive substring of the decoded "From" header
+	Subject string    // case-insensitive substring of the decoded subject
+	Spam    string    // "yes", "no" or empty
+	After   time.Time // stored at or after
+	Before  time.Time // stored before
+}
+
+func (f ModFilter) IsEmpty() bool {
+	return f == ModFilter{}
+}
+
+// needsHeader returns whether Matches evaluates the header.
+func (f ModFilter) needsHeader() bool {
+	return f.Sender != "" || f.Subject != "" || f.Spam != ""
+}
+
+// Matches reports whether a moderated message matches the filter. Messages with an unreadable header match only if the filter doesn't look at the header.
+func (f ModFilter) Matches(filename string, header mail.Header, headerErr error) bool {
+
+	if !f.After.IsZero() || !f.Before.IsZero() {
+		stored, ok := StoredTime(filename)
+		if !ok {
+			return false
+		}
+		if !f.After.IsZero() && stored.Before(f.After) {
+			return false
+		}
+		if !f.Before.IsZero() && !stored.Before(f.Before) {
+			return false
+		}
+	}
+
+	if !f.needsHeader() {
+		return true
+	}
+
+	if headerErr != nil {
+		return false
+	}
+
+	if f.Sender != "" && !strings.Contains(strings.ToLower(mailutil.RobustWordDecode(header.Get("From"))), strings.ToLower(f.Sender)) {
+		return false
+	}
+
+	if f.Subject != "" && !strings.Contains(strings.ToLower(mailutil.RobustWordDecode(header.Get("Subject"))), strings.ToLower(f.Subject)) {
+		return false
+	}
+
+	if f.Spam != "" {
+		isSpam, _ := mailutil.IsSpam(header)
+		if isSpam != (f.Spam == "yes") {
+			return false
+		}
+	}
+
+	return true
+}
+
+// FilterModerated returns the filenames of all moderated messages which match the filter, newest first. The caller should paginate them.
+func (u *Ulist) FilterModerated(list *List, filter ModFilter) ([]string, error) {
+
+	filenames, err := u.StoredFilenames(list, -1) // read all, because the directory order is arbitrary
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Sort(sort.Reverse(sort.StringSlice(filenames)))
+
+	if filter.IsEmpty() {
+		return filenames, nil
+	}
+
+	var matching []string
+	for _, filename := range filenames {
+		var header mail.Header
+		var err error
+		if filter.needsHeader() {
+			header, err = u.ReadHeader(list, filename)
+		}
+		if filter.Matches(filename, header, err) {
+			matching = append(matching, filename)
+		}
+	}
+	return matching, nil
+}
@@ -0,0 +1,88 @@
+package ulist
+
+import (
+	"errors"
+	"fmt"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestModFilter(t *testing.T) {
+
+	day := time.Date(2024, 5, 20, 0, 0, 0, 0, time.Local)
+	filename := fmt.Sprintf("%010d-123.eml", day.Add(12*time.Hour).Unix())
+
+	header := mail.Header{
+		"From":          []string{"=?utf-8?q?J=C3=BCrgen?= <juergen@example.com>"},
+		"Subject":       []string{"Cheap Watches"},
+		"X-Spam-Status": []string{"Yes, score=12"},
+	}
+
+	tests := []struct {
+		filter    ModFilter
+		headerErr error
+		want      bool
+	}{
+		{ModFilter{}, nil, true},
+		{ModFilter{}, errors.New("unreadable"), true},
+		{ModFilter{Sender: "jürgen"}, nil, true},
+		{ModFilter{Sender: "JUERGEN@"}, nil, true},
+		{ModFilter{Sender: "alice"}, nil, false},
+		{ModFilter{Subject: "watches"}, nil, true},
+		{ModFilter{Subject: "watches"}, errors.New("unreadable"), false},
+		{ModFilter{Spam: "yes"}, nil, true},
+		{ModFilter{Spam: "no"}, nil, false},
+		{ModFilter{After: day, Before: day.AddDate(0, 0, 1)}, nil, true},
+		{ModFilter{After: day.AddDate(0, 0, 1)}, nil, false},
+		{ModFilter{Before: day}, nil, false},
+	}
+
+	for _, test := range tests {
+		if got := test.filter.Matches(filename, header, test.headerErr); got != test.want {
+			t.Errorf("%+v: got %v, want %v", test.filter, got, test.want)
+		}
+	}
+}
+
+func TestFilterModeratedAll(t *testing.T) {
+
+	u := &Ulist{SpoolDir: t.TempDir()}
+	list := &List{ListInfo: ListInfo{ID: 1}}
+
+	if err := os.MkdirAll(u.StorageFolder(list.ListInfo), 0700); err != nil {
+		t.Fatal(err)
+	}
+
+	// more than the 1000 messages which were read before
+	const count = 1500
+	start := time.Date(2024, 5, 20, 0, 0, 0, 0, time.Local)
+	for i := 0; i < count; i++ {
+		filename := fmt.Sprintf("%010d-%d.eml", start.Add(time.Duration(i)*time.Minute).Unix(), i)
+		if err := os.WriteFile(filepath.Join(u.StorageFolder(list.ListInfo), filename), []byte("Subject: Hi\r\n\r\nHello"), 0600); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	all, err := u.FilterModerated(list, ModFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(all) != count {
+		t.Fatalf("got %d messages, want %d", len(all), count)
+	}
+	if want := fmt.Sprintf("%010d-%d.eml", start.Add((count-1)*time.Minute).Unix(), count-1); all[0] != want {
+		t.Errorf("got newest %s, want %s", all[0], want)
+	}
+
+	// the first hour only
+	oldest, err := u.FilterModerated(list, ModFilter{Before: start.Add(time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(oldest) != 60 {
+		t.Errorf("got %d messages before %v, want 60", len(oldest), start.Add(time.Hour))
+	}
+}
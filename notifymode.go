@@ -0,0 +1,70 @@
+package ulist
+
+import (
+	"database/sql/driver"
+	"errors"
+	"time"
+)
+
+// NotifyMode determines how a notified member learns about messages which need moderation.
+type NotifyMode int
+
+var ErrUnknownNotifyModeString = errors.New("unknown notify mode string")
+
+const (
+	NotifyImmediate NotifyMode = iota // one notification per message, zero value
+	NotifyHourly                      // one digest per hour
+	NotifyDaily                       // one digest per day
+)
+
+// NotifyModes are all notify modes, for templates.
+var NotifyModes = []NotifyMode{NotifyImmediate, NotifyHourly, NotifyDaily}
+
+// implement sql.Scanner
+func (n *NotifyMode) Scan(value interface{}) (err error) {
+	*n, err = ParseNotifyMode(value.(string))
+	return
+}
+
+// implement sql/driver.Valuer
+func (n NotifyMode) Value() (driver.Value, error) {
+	return n.String(), nil
+}
+
+func ParseNotifyMode(s string) (NotifyMode, error) {
+	switch s {
+	case NotifyImmediate.String():
+		return NotifyImmediate, nil
+	case NotifyHourly.String():
+		return NotifyHourly, nil
+	case NotifyDaily.String():
+		return NotifyDaily, nil
+	default:
+		return NotifyImmediate, ErrUnknownNotifyModeString
+	}
+}
+
+func (n NotifyMode) String() string {
+	switch n {
+	case NotifyImmediate:
+		return "immediate"
+	case NotifyHourly:
+		return "hourly"
+	case NotifyDaily:
+		return "daily"
+	default:
+		return "<unknown>"
+	}
+}
+
+// Interval returns the time between two digests. It is zero for NotifyImmediate.
+func (n NotifyMode) Interval() time.Duration {
+	switch n {
+	case NotifyHourly:
+		return time.Hour
+	case NotifyDaily:
+		return 24 * time.Hour
+	default:
+		return 0
+	}
+}
@@ -0,0 +1,146 @@
+package ulist
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/wansing/ulist/txt"
+)
+
+// PostCount is the number of messages of a sender which have been forwarded recently.
+type PostCount struct {
+	Sender string
+	Hour   int // in the last hour
+	Day    int // in the last 24 hours
+}
+
+var (
+	sentLimitNotices     = make(map[rateLimitKey]int64) // value: unix time
+	sentLimitNoticesLock sync.Mutex
+)
+
+// HasRateLimit returns whether the number of forwarded messages per sender is limited.
+func (list *List) HasRateLimit() bool {
+	return list.RateLimitHour > 0 || list.RateLimitDay > 0
+}
+
+// countPost records a forwarded message for the rate limits. Senders are recorded only if the list has a rate limit.
+func (u *Ulist) countPost(list *List, froms []*Addr, now time.Time) error {
+	if !list.HasRateLimit() {
+		return nil
+	}
+	for _, from := range froms {
+		if err := u.Lists.AddPost(list, from.RFC5322AddrSpec(), now); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkRateLimit returns the first sender who has reached a rate limit of the list, and a description of the limit.
+func (u *Ulist) checkRateLimit(list *List, froms []*Addr, now time.Time) (*Addr, string, error) {
+
+	var limits = []struct {
+		max    int
+		period time.Duration
+		name   string
+	}{
+		{list.RateLimitHour, time.Hour, "hour"},
+		{list.RateLimitDay, 24 * time.Hour, "day"},
+	}
+
+	for _, from := range froms {
+		for _, limit := range limits {
+			if limit.max <= 0 {
+				continue
+			}
+			count, err := u.Lists.CountPosts(list, from.RFC5322AddrSpec(), now.Add(-limit.period))
+			if err != nil {
+				return nil, "", err
+			}
+			if count >= limit.max {
+				return from, fmt.Sprintf("%d messages per %s", limit.max, limit.name), nil
+			}
+		}
+	}
+
+	return nil, "", nil
+}
+
+// notifyModsLimit tells the moderators who get immediate notifications that a sender has reached a rate limit. They are notified at most once per sender, list and day.
+func (u *Ulist) notifyModsLimit(list *List, sender *Addr, limit string) error {
+
+	var key = rateLimitKey{sender.RFC5322AddrSpec(), list.RFC5322AddrSpec()}
+
+	sentLimitNoticesLock.Lock()
+	if lastSentTimestamp, ok := sentLimitNotices[key]; ok && lastSentTimestamp > time.Now().AddDate(0, 0, -1).Unix() {
+		sentLimitNoticesLock.Unlock()
+		return nil
+	}
+	sentLimitNotices[key] = time.Now().Unix()
+	sentLimitNoticesLock.Unlock()
+
+	notifieds, err := u.Lists.NotifiedsWithMode(list, NotifyImmediate)
+	if err != nil {
+		return err
+	}
+
+	var footer string
+	var modUrl string
+	if u.Web != nil {
+		footer = u.Web.FooterPlain(list)
+		modUrl = u.Web.ModUrl(list)
+	}
+
+	body := &bytes.Buffer{}
+	data := txt.NotifyModsLimitData{
+		Footer:       footer,
+		Limit:        limit,
+		ListNameAddr: list.RFC5322NameAddr(),
+		ModHref:      modUrl,
+		Rejected:     list.RateLimitAction == Reject,
+		Sender:       sender.RFC5322AddrSpec(),
+	}
+
+	if err := txt.NotifyModsLimit.Execute(body, data); err != nil {
+		return err
+	}
+
+	var lastErr error
+	for _, notified := range notifieds {
+		if err := u.Notify(list, notified, "A sender has reached the rate limit", bytes.NewReader(body.Bytes())); err != nil {
+			lastErr = err
+		}
+	}
+	return lastErr
+}
+
+// applyRateLimit lowers the action to list.RateLimitAction if a sender has reached a rate limit, and notifies the moderators then.
+func (u *Ulist) applyRateLimit(list *List, froms []*Addr, action Action, reason string) (Action, string, error) {
+
+	if !list.HasRateLimit() || action < Mod {
+		return action, reason, nil
+	}
+
+	sender, limit, err := u.checkRateLimit(list, froms, time.Now())
+	if err != nil {
+		return Reject, "", fmt.Errorf("error getting post counts from database: %v", err)
+	}
+	if sender == nil {
+		return action, reason, nil
+	}
+
+	if action > list.RateLimitAction {
+		action = list.RateLimitAction
+	}
+	reason = fmt.Sprintf("%s, but %s has reached the limit of %s", reason, sender, limit)
+
+	if err := u.notifyModsLimit(list, sender, limit); err != nil {
+		log.Printf("error sending rate limit notification: %v", err)
+	}
+
+	return action, reason, nil
+}
@@ -0,0 +1,104 @@
+package ulist
+
+import (
+	"database/sql/driver"
+	"errors"
+	"net/mail"
+	"slices"
+
+	"github.com/wansing/ulist/mailutil"
+)
+
+// ReplyTo determines the Reply-To header field of forwarded messages.
+type ReplyTo int
+
+var ErrUnknownReplyToString = errors.New("unknown reply-to string")
+
+const (
+	ReplyToSender ReplyTo = iota // the original senders, or nothing if HideFrom is set, zero value
+	ReplyToList                  // the list address
+	ReplyToFixed                 // List.ReplyToAddress
+)
+
+// ReplyTos are all reply-to policies, for templates.
+var ReplyTos = []ReplyTo{ReplyToSender, ReplyToList, ReplyToFixed}
+
+// implement sql.Scanner
+func (r *ReplyTo) Scan(value interface{}) (err error) {
+	*r, err = ParseReplyTo(value.(string))
+	return
+}
+
+// implement sql/driver.Valuer
+func (r ReplyTo) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+// implement encoding.TextMarshaler, used in list templates
+func (r ReplyTo) MarshalText() ([]byte, error) {
+	return []byte(r.String()), nil
+}
+
+// implement encoding.TextUnmarshaler
+func (r *ReplyTo) UnmarshalText(text []byte) (err error) {
+	*r, err = ParseReplyTo(string(text))
+	return
+}
+
+func ParseReplyTo(s string) (ReplyTo, error) {
+	switch s {
+	case ReplyToSender.String():
+		return ReplyToSender, nil
+	case ReplyToList.String():
+		return ReplyToList, nil
+	case ReplyToFixed.String():
+		return ReplyToFixed, nil
+	default:
+		return ReplyToSender, ErrUnknownReplyToString
+	}
+}
+
+func (r ReplyTo) String() string {
+	switch r {
+	case ReplyToSender:
+		return "sender"
+	case ReplyToList:
+		return "list"
+	case ReplyToFixed:
+		return "fixed"
+	default:
+		return "<unknown>"
+	}
+}
+
+// replyTo returns the addresses for the Reply-To header field of a forwarded message. The result is empty if Reply-To should default to the (rewritten) "From".
+func (list *List) replyTo(originalHeader mail.Header, originalFroms []*Addr) []string {
+
+	var addrs []string
+
+	switch list.ReplyTo {
+	case ReplyToList:
+		addrs = append(addrs, list.RFC5322NameAddr())
+	case ReplyToFixed:
+		addrs = append(addrs, list.ReplyToAddress)
+	default:
+		// Without rewriting "From", "Reply-To" would default to the from addresses, so let's mimic that.
+		// If you use rspamd to filter outgoing mail, you should disable the Symbol "SPOOF_REPLYTO" in the "Symbols" menu, see https://github.com/rspamd/rspamd/issues/1891
+		for _, from := range originalFroms {
+			addrs = append(addrs, from.RFC5322NameAddr())
+		}
+	}
+
+	// the original Reply-To could reveal the sender, malformed values are dropped
+	if list.KeepReplyTo && !list.HideFrom {
+		if original, err := mailutil.ParseAddressesFromHeader(originalHeader, "Reply-To", 10); err == nil {
+			for _, o := range original {
+				if addr := o.RFC5322NameAddr(); !slices.Contains(addrs, addr) {
+					addrs = append(addrs, addr)
+				}
+			}
+		}
+	}
+
+	return addrs
+}
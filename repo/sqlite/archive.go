@@ -0,0 +1,456 @@
+package sqlite
+
+import (
+	"database/sql"
+	"math"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/wansing/ulist"
+)
+
+// snippet markers, must not occur in text
+const (
+	snippetStart = "\x02"
+	snippetEnd   = "\x03"
+)
+
+const snippetRunes = 160 // approximate length of a snippet if full-text search is not available
+
+type ArchiveDB struct {
+	sqlDB             *sql.DB
+	fts               bool // whether the full-text search index is available
+	addStmt           *sql.Stmt
+	exportStmt        *sql.Stmt
+	findThreadStmt    *sql.Stmt
+	getBetweenStmt    *sql.Stmt
+	getMessageStmt    *sql.Stmt
+	getMonthsStmt     *sql.Stmt
+	getThreadStmt     *sql.Stmt
+	isArchivedStmt    *sql.Stmt
+	removeListStmt    *sql.Stmt
+	setThreadRootStmt *sql.Stmt
+}
+
+func OpenArchiveDB(connStr string) (*ArchiveDB, error) {
+	sqlDB, err := sql.Open("sqlite3", connStr)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = sqlDB.Exec(`
+
+		CREATE TABLE IF NOT EXISTS archive (
+			id         INTEGER PRIMARY KEY,
+			list       INTEGER NOT NULL,
+			thread     INTEGER NOT NULL, -- id of the first message of the thread
+			message_id TEXT NOT NULL,
+			time       INTEGER NOT NULL, -- unix timestamp
+			sender     TEXT NOT NULL,    -- decoded "From" header, respects hide_from
+			subject    TEXT NOT NULL,    -- decoded
+			raw        BLOB NOT NULL,
+			body       TEXT NOT NULL     -- decoded text, for the search index
+		);
+
+		CREATE INDEX IF NOT EXISTS archive_list_time ON archive (list, time);
+		CREATE INDEX IF NOT EXISTS archive_list_message_id ON archive (list, message_id);
+		CREATE INDEX IF NOT EXISTS archive_list_thread ON archive (list, thread);
+	`)
+	if err != nil {
+		return nil, err
+	}
+
+	db := &ArchiveDB{
+		sqlDB: sqlDB,
+	}
+
+	db.fts, err = setupFTS(sqlDB)
+	if err != nil {
+		return nil, err
+	}
+
+	db.addStmt, err = db.sqlDB.Prepare("insert into archive (list, thread, message_id, time, sender, subject, raw, body) values (?, ?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.exportStmt, err = db.sqlDB.Prepare("select id, thread, message_id, time, sender, subject, raw from archive where list = ? and time >= ? and time < ? order by time, id")
+	if err != nil {
+		return nil, err
+	}
+	db.findThreadStmt, err = db.sqlDB.Prepare("select thread from archive where list = ? and message_id = ? limit 1")
+	if err != nil {
+		return nil, err
+	}
+	db.getBetweenStmt, err = db.sqlDB.Prepare("select id, thread, message_id, time, sender, subject from archive where list = ? and time >= ? and time < ? order by time, id")
+	if err != nil {
+		return nil, err
+	}
+	db.getMessageStmt, err = db.sqlDB.Prepare("select id, thread, message_id, time, sender, subject, raw from archive where list = ? and id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.getMonthsStmt, err = db.sqlDB.Prepare("select cast(strftime('%Y', time, 'unixepoch') as integer), cast(strftime('%m', time, 'unixepoch') as integer), count(*) from archive where list = ? group by 1, 2 order by 1 desc, 2 desc")
+	if err != nil {
+		return nil, err
+	}
+	db.getThreadStmt, err = db.sqlDB.Prepare("select id, thread, message_id, time, sender, subject, raw from archive where list = ? and thread = ? order by time, id")
+	if err != nil {
+		return nil, err
+	}
+	db.isArchivedStmt, err = db.sqlDB.Prepare("select exists (select 1 from archive where list = ? and message_id = ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.removeListStmt, err = db.sqlDB.Prepare("delete from archive where list = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.setThreadRootStmt, err = db.sqlDB.Prepare("update archive set thread = id where id = ?")
+	if err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+func (db *ArchiveDB) Close() error {
+	return db.sqlDB.Close()
+}
+
+// FullTextSearch returns whether Search uses the FTS5 index. If not, it falls back to substring matching.
+func (db *ArchiveDB) FullTextSearch() bool {
+	return db.fts
+}
+
+// AddArchived adds the message to the thread of the first referenced message which is in the archive. If there is none, the message starts a new thread.
+func (db *ArchiveDB) AddArchived(list *ulist.List, message *ulist.ArchivedMessage, references []string) error {
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var thread int
+	for _, reference := range references {
+		err := tx.Stmt(db.findThreadStmt).QueryRow(list.ID, reference).Scan(&thread)
+		if err == nil {
+			break
+		}
+		if err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	result, err := tx.Stmt(db.addStmt).Exec(list.ID, thread, message.MessageID, message.Time.Unix(), message.From, message.Subject, message.Raw, message.Text)
+	if err != nil {
+		return err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+
+	if thread == 0 {
+		if _, err := tx.Stmt(db.setThreadRootStmt).Exec(id); err != nil {
+			return err
+		}
+		thread = int(id)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	message.ID = int(id)
+	message.Thread = thread
+	return nil
+}
+
+func (db *ArchiveDB) Archived(list *ulist.List, id int) (*ulist.ArchivedMessage, error) {
+	var message = &ulist.ArchivedMessage{}
+	var unix int64
+	err := db.getMessageStmt.QueryRow(list.ID, id).Scan(&message.ID, &message.Thread, &message.MessageID, &unix, &message.From, &message.Subject, &message.Raw)
+	switch err {
+	case nil:
+		message.Time = time.Unix(unix, 0)
+		return message, nil
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+}
+
+func (db *ArchiveDB) ArchivedBetween(list *ulist.List, from, to time.Time) ([]ulist.ArchivedMessage, error) {
+	return db.messagesWhere(db.getBetweenStmt, false, list.ID, from.Unix(), to.Unix())
+}
+
+func (db *ArchiveDB) ArchivedMonths(list *ulist.List) ([]ulist.ArchiveMonth, error) {
+
+	rows, err := db.getMonthsStmt.Query(list.ID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var months []ulist.ArchiveMonth
+	for rows.Next() {
+		var month ulist.ArchiveMonth
+		if err := rows.Scan(&month.Year, &month.Month, &month.Count); err != nil {
+			return nil, err
+		}
+		months = append(months, month)
+	}
+	return months, rows.Err()
+}
+
+func (db *ArchiveDB) ArchivedThread(list *ulist.List, thread int) ([]ulist.ArchivedMessage, error) {
+	return db.messagesWhere(db.getThreadStmt, true, list.ID, thread)
+}
+
+func (db *ArchiveDB) DeleteArchive(list *ulist.List) error {
+	_, err := db.removeListStmt.Exec(list.ID)
+	return err
+}
+
+func (db *ArchiveDB) ExportArchived(list *ulist.List, from, to time.Time, f func(*ulist.ArchivedMessage) error) error {
+
+	var fromUnix int64 = math.MinInt64
+	var toUnix int64 = math.MaxInt64
+	if !from.IsZero() {
+		fromUnix = from.Unix()
+	}
+	if !to.IsZero() {
+		toUnix = to.Unix()
+	}
+
+	rows, err := db.exportStmt.Query(list.ID, fromUnix, toUnix)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var message ulist.ArchivedMessage
+		var unix int64
+		if err := rows.Scan(&message.ID, &message.Thread, &message.MessageID, &unix, &message.From, &message.Subject, &message.Raw); err != nil {
+			return err
+		}
+		message.Time = time.Unix(unix, 0)
+		if err := f(&message); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func (db *ArchiveDB) IsArchived(list *ulist.List, messageID string) (bool, error) {
+	var exists bool
+	err := db.isArchivedStmt.QueryRow(list.ID, messageID).Scan(&exists)
+	return exists, err
+}
+
+// messagesWhere runs a statement which selects id, thread, message_id, time, sender, subject and, if withRaw is true, raw.
+func (db *ArchiveDB) messagesWhere(stmt *sql.Stmt, withRaw bool, args ...interface{}) ([]ulist.ArchivedMessage, error) {
+
+	rows, err := stmt.Query(args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var messages []ulist.ArchivedMessage
+	for rows.Next() {
+		var message ulist.ArchivedMessage
+		var unix int64
+		var dest = []interface{}{&message.ID, &message.Thread, &message.MessageID, &unix, &message.From, &message.Subject}
+		if withRaw {
+			dest = append(dest, &message.Raw)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return nil, err
+		}
+		message.Time = time.Unix(unix, 0)
+		messages = append(messages, message)
+	}
+	return messages, rows.Err()
+}
+
+// setupFTS creates the FTS5 index and the triggers which keep it up to date. FTS5 requires the build tag "sqlite_fts5". Without it, the triggers are removed and false is returned.
+func setupFTS(sqlDB *sql.DB) (bool, error) {
+
+	_, err := sqlDB.Exec(`CREATE VIRTUAL TABLE IF NOT EXISTS archive_fts USING fts5(subject, sender, body, content='archive', content_rowid='id');`)
+	if err != nil {
+		if !strings.Contains(err.Error(), "no such module") {
+			return false, err
+		}
+		// inserts would fail if the triggers referred to the unavailable index
+		_, err = sqlDB.Exec(`
+			DROP TRIGGER IF EXISTS archive_fts_insert;
+			DROP TRIGGER IF EXISTS archive_fts_delete;
+		`)
+		return false, err
+	}
+
+	// If the triggers don't exist, the index is new or has missed messages while the binary was built without FTS5.
+
+	var triggers int
+	if err := sqlDB.QueryRow("select count(*) from sqlite_master where type = 'trigger' and name like 'archive_fts_%'").Scan(&triggers); err != nil {
+		return false, err
+	}
+	if triggers == 2 {
+		return true, nil
+	}
+
+	_, err = sqlDB.Exec(`
+
+		CREATE TRIGGER IF NOT EXISTS archive_fts_insert AFTER INSERT ON archive BEGIN
+			INSERT INTO archive_fts (rowid, subject, sender, body) VALUES (new.id, new.subject, new.sender, new.body);
+		END;
+
+		CREATE TRIGGER IF NOT EXISTS archive_fts_delete AFTER DELETE ON archive BEGIN
+			INSERT INTO archive_fts (archive_fts, rowid, subject, sender, body) VALUES ('delete', old.id, old.subject, old.sender, old.body);
+		END;
+
+		INSERT INTO archive_fts (archive_fts) VALUES ('rebuild');
+	`)
+	return err == nil, err
+}
+
+// Search returns up to limit messages of the given lists which contain all words of the query. With FTS5, the best matches come first, else the newest.
+func (db *ArchiveDB) Search(lists []ulist.ListInfo, query string, from, to time.Time, limit int) ([]ulist.ArchiveSearchResult, error) {
+
+	terms := strings.Fields(query)
+	if len(lists) == 0 || len(terms) == 0 {
+		return nil, nil
+	}
+
+	var conditions []string
+	var args []interface{}
+
+	// lists
+
+	placeholders := make([]string, len(lists))
+	for i, li := range lists {
+		placeholders[i] = "?"
+		args = append(args, li.ID)
+	}
+	conditions = append(conditions, "a.list in ("+strings.Join(placeholders, ", ")+")")
+
+	// time
+
+	if !from.IsZero() {
+		conditions = append(conditions, "a.time >= ?")
+		args = append(args, from.Unix())
+	}
+	if !to.IsZero() {
+		conditions = append(conditions, "a.time < ?")
+		args = append(args, to.Unix())
+	}
+
+	// terms
+
+	var stmt string
+	if db.fts {
+		// quote each term, so user input can't use the FTS5 query syntax
+		quoted := make([]string, len(terms))
+		for i, term := range terms {
+			quoted[i] = `"` + strings.ReplaceAll(term, `"`, `""`) + `"`
+		}
+		conditions = append(conditions, "archive_fts match ?")
+		args = append(args, strings.Join(quoted, " "))
+		stmt = "select a.id, a.list, a.thread, a.message_id, a.time, a.sender, a.subject, snippet(archive_fts, -1, char(2), char(3), '…', 24) from archive_fts join archive a on a.id = archive_fts.rowid where " + strings.Join(conditions, " and ") + " order by rank limit ?"
+	} else {
+		for _, term := range terms {
+			conditions = append(conditions, `(a.subject like ? escape '\' or a.sender like ? escape '\' or a.body like ? escape '\')`)
+			pattern := "%" + likeEscaper.Replace(term) + "%"
+			args = append(args, pattern, pattern, pattern)
+		}
+		stmt = "select a.id, a.list, a.thread, a.message_id, a.time, a.sender, a.subject, a.body from archive a where " + strings.Join(conditions, " and ") + " order by a.time desc, a.id desc limit ?"
+	}
+	args = append(args, limit)
+
+	rows, err := db.sqlDB.Query(stmt, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []ulist.ArchiveSearchResult
+	for rows.Next() {
+		var result ulist.ArchiveSearchResult
+		var unix int64
+		var snippet string
+		if err := rows.Scan(&result.ID, &result.ListID, &result.Thread, &result.MessageID, &unix, &result.From, &result.Subject, &snippet); err != nil {
+			return nil, err
+		}
+		result.Time = time.Unix(unix, 0)
+		if db.fts {
+			result.Snippet = parseSnippet(snippet)
+		} else {
+			result.Snippet = likeSnippet(snippet, terms)
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// parseSnippet splits the output of the FTS5 snippet function at the markers.
+func parseSnippet(snippet string) []ulist.SnippetFragment {
+	var fragments []ulist.SnippetFragment
+	for snippet != "" {
+		before, rest, found := strings.Cut(snippet, snippetStart)
+		if before != "" {
+			fragments = append(fragments, ulist.SnippetFragment{Text: before})
+		}
+		if !found {
+			break
+		}
+		match, after, _ := strings.Cut(rest, snippetEnd)
+		fragments = append(fragments, ulist.SnippetFragment{Text: match, Match: true})
+		snippet = after
+	}
+	return fragments
+}
+
+// likeSnippet mimics the FTS5 snippet function: it returns the text around the first occurrence of a term, with all occurrences marked.
+func likeSnippet(body string, terms []string) []ulist.SnippetFragment {
+
+	quoted := make([]string, len(terms))
+	for i, term := range terms {
+		quoted[i] = regexp.QuoteMeta(term)
+	}
+	pattern := regexp.MustCompile("(?i)" + strings.Join(quoted, "|"))
+
+	// cut a window around the first match
+
+	runes := []rune(body)
+	start := 0
+	if loc := pattern.FindStringIndex(body); loc != nil {
+		start = len([]rune(body[:loc[0]])) - snippetRunes/4
+		if start < 0 {
+			start = 0
+		}
+	}
+	end := start + snippetRunes
+	if end > len(runes) {
+		end = len(runes)
+	}
+
+	window := string(runes[start:end])
+	if start > 0 {
+		window = "…" + window
+	}
+	if end < len(runes) {
+		window = window + "…"
+	}
+
+	return parseSnippet(pattern.ReplaceAllStringFunc(window, func(match string) string {
+		return snippetStart + match + snippetEnd
+	}))
+}
@@ -0,0 +1,101 @@
+//go:build sqlite_fts5
+
+package sqlite
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/wansing/ulist"
+)
+
+func TestSearchFTS(t *testing.T) {
+
+	db, err := OpenArchiveDB(filepath.Join(t.TempDir(), "archive.sqlite3"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+
+	if !db.FullTextSearch() {
+		t.Fatal("full-text search is not available")
+	}
+
+	list := &ulist.List{ListInfo: ulist.ListInfo{ID: 1}}
+	other := &ulist.List{ListInfo: ulist.ListInfo{ID: 2}}
+	now := time.Now()
+
+	messages := []struct {
+		list    *ulist.List
+		subject string
+		text    string
+	}{
+		{list, "Picnic", "Let's have a picnic in the park on Sunday."},
+		{list, "Re: Picnic", "Picnic sounds good, but not in the park."},
+		{list, "Meeting", "The meeting is on Monday."},
+		{other, "Picnic", "Another list has a picnic too."},
+	}
+	for i, m := range messages {
+		err := db.AddArchived(m.list, &ulist.ArchivedMessage{
+			MessageID: "<" + m.subject + ">",
+			Time:      now.Add(time.Duration(i) * time.Minute),
+			From:      "alice@example.com",
+			Subject:   m.subject,
+			Raw:       []byte("Subject: " + m.subject + "\r\n\r\n" + m.text),
+			Text:      m.text,
+		}, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		query string
+		want  int
+	}{
+		{"picnic", 2},
+		{"PICNIC park", 2},
+		{"picnic sunday", 1},
+		{"monday", 1},
+		{"picnic monday", 0},
+		{"pic", 0},               // FTS5 matches whole words
+		{`picnic OR meeting`, 0}, // FTS5 query syntax is quoted
+		{`"park`, 2},             // no syntax error
+	}
+	for _, test := range tests {
+		results, err := db.Search([]ulist.ListInfo{list.ListInfo}, test.query, time.Time{}, time.Time{}, 10)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+			continue
+		}
+		if len(results) != test.want {
+			t.Errorf("%s: got %d results, want %d", test.query, len(results), test.want)
+		}
+	}
+
+	// snippet
+
+	results, err := db.Search([]ulist.ListInfo{list.ListInfo}, "sunday", time.Time{}, time.Time{}, 10)
+	if err != nil || len(results) != 1 {
+		t.Fatalf("got %d results, %v, want 1", len(results), err)
+	}
+	var matches []string
+	for _, fragment := range results[0].Snippet {
+		if fragment.Match {
+			matches = append(matches, fragment.Text)
+		}
+	}
+	if len(matches) != 1 || matches[0] != "Sunday" {
+		t.Errorf("got snippet matches %v, want [Sunday]", matches)
+	}
+
+	// deleted messages are removed from the index
+
+	if err := db.DeleteArchive(list); err != nil {
+		t.Fatal(err)
+	}
+	if results, _ := db.Search([]ulist.ListInfo{list.ListInfo, other.ListInfo}, "picnic", time.Time{}, time.Time{}, 10); len(results) != 1 || results[0].ListID != other.ID {
+		t.Errorf("got %d results after deleting the archive, want 1 of the other list", len(results))
+	}
+}
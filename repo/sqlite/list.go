@@ -4,10 +4,13 @@ import (
 	"crypto/rand"
 	"database/sql"
 	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
+	"time"
 
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/wansing/ulist"
@@ -16,27 +19,80 @@ import (
 
 type ListDB struct {
 	sqlDB                 *sql.DB
+	addAuditEntryStmt     *sql.Stmt
+	addBlockedStmt        *sql.Stmt
 	addKnownStmt          *sql.Stmt
 	addMemberStmt         *sql.Stmt
+	countAuditEntriesStmt *sql.Stmt
 	createListStmt        *sql.Stmt
 	getAdminsStmt         *sql.Stmt
+	getAuditEntriesStmt   *sql.Stmt
+	getBlockedStmt        *sql.Stmt
 	getBouncesStmt        *sql.Stmt
+	getDigestRcptsStmt    *sql.Stmt
 	getKnownsStmt         *sql.Stmt
 	getListStmt           *sql.Stmt
 	getMemberStmt         *sql.Stmt
 	getMembersStmt        *sql.Stmt
 	getMembershipsStmt    *sql.Stmt
 	getNotifiedsStmt      *sql.Stmt
+	getNotifiedsModeStmt  *sql.Stmt
+	getLastRunStmt        *sql.Stmt
 	getReceiversStmt      *sql.Stmt
+	isBlockedStmt         *sql.Stmt
 	isListStmt            *sql.Stmt
 	isKnownStmt           *sql.Stmt
+	removeBlockedStmt     *sql.Stmt
 	removeKnownStmt       *sql.Stmt
+	removeLastRunStmt     *sql.Stmt
 	removeListStmt        *sql.Stmt
+	removeListAuditStmt   *sql.Stmt
+	removeListBlockedStmt *sql.Stmt
 	removeListKnownsStmt  *sql.Stmt
 	removeListMembersStmt *sql.Stmt
+	removeTemplatesStmt   *sql.Stmt
+	getTemplateStmt       *sql.Stmt
+	getTemplatesStmt      *sql.Stmt
+	removeTemplateStmt    *sql.Stmt
+	setTemplateStmt       *sql.Stmt
+	addPostStmt           *sql.Stmt
+	countPostsStmt        *sql.Stmt
+	getPostCountsStmt     *sql.Stmt
+	removeOldPostsStmt    *sql.Stmt
+	removeListPostsStmt   *sql.Stmt
+	getListTmplStmt       *sql.Stmt
+	getListTmplsStmt      *sql.Stmt
+	removeListTmplStmt    *sql.Stmt
+	saveListTmplStmt      *sql.Stmt
+	addAliasStmt          *sql.Stmt
+	getAliasesStmt        *sql.Stmt
+	getAddressOwnerStmt   *sql.Stmt
+	removeAliasStmt       *sql.Stmt
+	removeAliasesStmt     *sql.Stmt
+	renameListStmt        *sql.Stmt
+	addSublistStmt        *sql.Stmt
+	getSublistsStmt       *sql.Stmt
+	includesStmt          *sql.Stmt
+	removeSublistStmt     *sql.Stmt
+	removeSublistsStmt    *sql.Stmt
 	removeMemberStmt      *sql.Stmt
+	setLastRunStmt        *sql.Stmt
+	updateArchiveStmt     *sql.Stmt
 	updateListStmt        *sql.Stmt
+	updateFooterStmt      *sql.Stmt
+	updateHeadersStmt     *sql.Stmt
+	updateModerationStmt  *sql.Stmt
+	updatePrefixStmt      *sql.Stmt
+	updateRateLimitStmt   *sql.Stmt
+	nextPostNumberStmt    *sql.Stmt
+	addPostNumberStmt     *sql.Stmt
+	getPostNumberStmt     *sql.Stmt
+	removeOldNumbersStmt  *sql.Stmt
+	removeListNumbersStmt *sql.Stmt
+	updateReplyToStmt     *sql.Stmt
 	updateMemberStmt      *sql.Stmt
+	updateNotifyModeStmt  *sql.Stmt
+	updateDeliveryStmt    *sql.Stmt
 }
 
 func OpenListDB(connStr string) (*ListDB, error) {
@@ -59,25 +115,111 @@ func OpenListDB(connStr string) (*ListDB, error) {
 			action_member    TEXT NOT NULL,
 			action_known     TEXT NOT NULL,
 			action_unknown   TEXT NOT NULL,
+			action_blocked   TEXT NOT NULL, -- reject or discard
+			held_notice      BOOLEAN NOT NULL, -- send an auto-reply to senders whose message is held for moderation
+			mod_expiry       INTEGER NOT NULL, -- delete moderated messages after this number of days, zero means never
+			expiry_notify_sender BOOLEAN NOT NULL,
+			expiry_notify_mods   BOOLEAN NOT NULL,
+			archive          TEXT NOT NULL, -- off, public, members or moderators
+			reply_to         TEXT NOT NULL, -- sender, list or fixed
+			reply_to_address TEXT NOT NULL, -- used if reply_to is fixed
+			keep_reply_to    BOOLEAN NOT NULL,
+			prefix           TEXT NOT NULL, -- subject tag, empty means display-name or local-part
+			no_prefix        BOOLEAN NOT NULL,
+			post_numbers     BOOLEAN NOT NULL, -- append a running number to the subject tag
+			post_number      INTEGER NOT NULL, -- last used number
+			footer_plain     TEXT NOT NULL, -- template, empty means default
+			footer_html      TEXT NOT NULL, -- template, empty means default
+			strip_headers    TEXT NOT NULL, -- header keys, empty means default
+			static_headers   TEXT NOT NULL, -- "Key: value" lines
+			rate_limit_hour  INTEGER NOT NULL, -- zero means unlimited
+			rate_limit_day   INTEGER NOT NULL, -- zero means unlimited
+			rate_limit_action TEXT NOT NULL, -- mod or reject
 			UNIQUE(local, domain)
 		);
 
 		CREATE TABLE IF NOT EXISTS member (
-			list     INTEGER,
-			address  TEXT NOT NULL,
-			receive  BOOLEAN NOT NULL, -- receive messages from the list
-			moderate BOOLEAN NOT NULL, -- moderate the list
-			notify   BOOLEAN NOT NULL, -- get moderation notifications
-			admin    BOOLEAN NOT NULL, -- administrate the list
-			bounces  BOOLEAN NOT NULL, -- get admin notifications
+			list        INTEGER,
+			address     TEXT NOT NULL,
+			receive     BOOLEAN NOT NULL, -- receive messages from the list
+			moderate    BOOLEAN NOT NULL, -- moderate the list
+			notify      BOOLEAN NOT NULL, -- get moderation notifications
+			admin       BOOLEAN NOT NULL, -- administrate the list
+			bounces     BOOLEAN NOT NULL, -- get admin notifications
+			notify_mode TEXT NOT NULL,    -- immediate, hourly or daily moderation notifications
+			delivery    TEXT NOT NULL,    -- immediate, daily or weekly digest
 			UNIQUE(list, address)
 		);
 
+		CREATE TABLE IF NOT EXISTS job (
+			name     TEXT PRIMARY KEY,
+			last_run INTEGER NOT NULL -- unix timestamp
+		);
+
 		CREATE TABLE IF NOT EXISTS known (
 			list    INTEGER NOT NULL,
 			address TEXT NOT NULL,
 			UNIQUE(list, address)
 		);
+
+		CREATE TABLE IF NOT EXISTS audit (
+			list       INTEGER NOT NULL,
+			time       INTEGER NOT NULL, -- unix timestamp
+			moderator  TEXT NOT NULL,    -- empty for automatic decisions
+			decision   TEXT NOT NULL,
+			subject    TEXT NOT NULL,
+			sender     TEXT NOT NULL,
+			message_id TEXT NOT NULL
+		);
+
+		CREATE INDEX IF NOT EXISTS audit_list_time ON audit (list, time);
+
+		CREATE TABLE IF NOT EXISTS blocked (
+			list    INTEGER NOT NULL, -- 0 means instance-wide
+			pattern TEXT NOT NULL,    -- address or domain
+			UNIQUE(list, pattern)
+		);
+
+		CREATE TABLE IF NOT EXISTS template (
+			list INTEGER NOT NULL,
+			name TEXT NOT NULL, -- file name in the txt package
+			src  TEXT NOT NULL,
+			UNIQUE(list, name)
+		);
+
+		CREATE TABLE IF NOT EXISTS post (
+			list   INTEGER NOT NULL,
+			sender TEXT NOT NULL,    -- address in "From"
+			time   INTEGER NOT NULL  -- unix time, counters for rate limits
+		);
+
+		CREATE INDEX IF NOT EXISTS post_list_sender_time ON post (list, sender, time);
+
+		CREATE TABLE IF NOT EXISTS post_number (
+			list       INTEGER NOT NULL,
+			message_id TEXT NOT NULL,
+			number     INTEGER NOT NULL,
+			time       INTEGER NOT NULL, -- unix time
+			UNIQUE(list, message_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS list_template (
+			name     TEXT PRIMARY KEY,
+			settings TEXT NOT NULL -- JSON
+		);
+
+		CREATE TABLE IF NOT EXISTS alias (
+			list   INTEGER NOT NULL,
+			local  TEXT NOT NULL, -- local-part of alias address
+			domain TEXT NOT NULL, -- domain of alias address
+			UNIQUE(local, domain)
+		);
+
+		CREATE TABLE IF NOT EXISTS sublist (
+			list    INTEGER NOT NULL,
+			sublist INTEGER NOT NULL, -- its receivers get the messages of list
+			UNIQUE(list, sublist)
+		);
 	`)
 	if err != nil {
 		return nil, err
@@ -87,6 +229,38 @@ func OpenListDB(connStr string) (*ListDB, error) {
 		sqlDB: sqlDB,
 	}
 
+	// audit
+	db.addAuditEntryStmt, err = db.sqlDB.Prepare("insert into audit (list, time, moderator, decision, subject, sender, message_id) values (?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.countAuditEntriesStmt, err = db.sqlDB.Prepare("select count(1) from audit where list = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.getAuditEntriesStmt, err = db.sqlDB.Prepare("select time, moderator, decision, subject, sender, message_id from audit where list = ? order by time desc, rowid desc limit ? offset ?")
+	if err != nil {
+		return nil, err
+	}
+
+	// blocked
+	db.addBlockedStmt, err = db.sqlDB.Prepare("replace into blocked (list, pattern) values (?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.getBlockedStmt, err = db.sqlDB.Prepare("select pattern from blocked where list = ? order by pattern")
+	if err != nil {
+		return nil, err
+	}
+	db.isBlockedStmt, err = db.sqlDB.Prepare("select count(1) from blocked where list in (0, ?) and pattern in (?, ?)") // "select count(1)" never returns sql.ErrNoRows
+	if err != nil {
+		return nil, err
+	}
+	db.removeBlockedStmt, err = db.sqlDB.Prepare("delete from blocked where list = ? and pattern = ?")
+	if err != nil {
+		return nil, err
+	}
+
 	// known
 	db.addKnownStmt, err = db.sqlDB.Prepare("replace into known (list, address) values (?, ?)")
 	if err != nil {
@@ -106,11 +280,11 @@ func OpenListDB(connStr string) (*ListDB, error) {
 	}
 
 	// list
-	db.createListStmt, err = db.sqlDB.Prepare("insert into list (display, local, domain, hmac_key, public_signup, hide_from, action_mod, action_member, action_known, action_unknown) values (?, ?, ?, ?, 0, 0, ?, ?, ?, ?)")
+	db.createListStmt, err = db.sqlDB.Prepare("insert into list (display, local, domain, hmac_key, public_signup, hide_from, action_mod, action_member, action_known, action_unknown, action_blocked, held_notice, mod_expiry, expiry_notify_sender, expiry_notify_mods, archive, reply_to, reply_to_address, keep_reply_to, prefix, no_prefix, post_numbers, post_number, footer_plain, footer_html, strip_headers, static_headers, rate_limit_hour, rate_limit_day, rate_limit_action) values (?, ?, ?, ?, 0, 0, ?, ?, ?, ?, ?, 0, 0, 0, 0, 'off', 'sender', '', 0, '', 0, 0, 0, '', '', '', '', 0, 0, 'mod')")
 	if err != nil {
 		return nil, err
 	}
-	db.getListStmt, err = db.sqlDB.Prepare("select id, display, hmac_key, public_signup, hide_from, action_mod, action_member, action_unknown, action_known from list where local = ? and domain = ?")
+	db.getListStmt, err = db.sqlDB.Prepare("select id, display, hmac_key, public_signup, hide_from, action_mod, action_member, action_unknown, action_known, action_blocked, held_notice, mod_expiry, expiry_notify_sender, expiry_notify_mods, archive, reply_to, reply_to_address, keep_reply_to, prefix, no_prefix, post_numbers, footer_plain, footer_html, strip_headers, static_headers, rate_limit_hour, rate_limit_day, rate_limit_action, local, domain from list where (local = ?1 and domain = ?2) or id = (select list from alias where local = ?1 and domain = ?2)")
 	if err != nil {
 		return nil, err
 	}
@@ -122,7 +296,7 @@ func OpenListDB(connStr string) (*ListDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	db.getMembersStmt, err = db.sqlDB.Prepare("select address, receive, moderate, notify, admin, bounces from member where list = ? order by address")
+	db.getMembersStmt, err = db.sqlDB.Prepare("select address, receive, moderate, notify, admin, bounces, notify_mode, delivery from member where list = ? order by address")
 	if err != nil {
 		return nil, err
 	}
@@ -130,11 +304,35 @@ func OpenListDB(connStr string) (*ListDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	db.getReceiversStmt, err = db.sqlDB.Prepare("select address from member where list = ? and receive = 1 order by address")
+	db.getNotifiedsModeStmt, err = db.sqlDB.Prepare("select address from member where list = ? and notify = 1 and notify_mode = ? order by address")
+	if err != nil {
+		return nil, err
+	}
+	// "union" instead of "union all" stops at cycles
+	db.getReceiversStmt, err = db.sqlDB.Prepare(`
+		with recursive included(id) as (
+			select ?
+			union
+			select sublist.sublist from sublist join included on sublist.list = included.id
+		)
+		select distinct address from member where list in included and receive = 1 and delivery = ? order by address`)
 	if err != nil {
 		return nil, err
 	}
-	db.isListStmt, err = db.sqlDB.Prepare("select count(1) from list where local = ? and domain = ?") // "select count(1)" never returns sql.ErrNoRows
+	// members who receive a message immediately through any included list don't get it in a digest
+	db.getDigestRcptsStmt, err = db.sqlDB.Prepare(`
+		with recursive included(id) as (
+			select ?1
+			union
+			select sublist.sublist from sublist join included on sublist.list = included.id
+		)
+		select distinct address from member where list in included and receive = 1 and delivery = ?2
+		and address not in (select address from member where list in included and receive = 1 and delivery = ?3)
+		order by address`)
+	if err != nil {
+		return nil, err
+	}
+	db.isListStmt, err = db.sqlDB.Prepare("select exists(select 1 from list where local = ?1 and domain = ?2) or exists(select 1 from alias where local = ?1 and domain = ?2)")
 	if err != nil {
 		return nil, err
 	}
@@ -142,6 +340,14 @@ func OpenListDB(connStr string) (*ListDB, error) {
 	if err != nil {
 		return nil, err
 	}
+	db.removeListAuditStmt, err = db.sqlDB.Prepare("delete from audit where list = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.removeListBlockedStmt, err = db.sqlDB.Prepare("delete from blocked where list = ?")
+	if err != nil {
+		return nil, err
+	}
 	db.removeListKnownsStmt, err = db.sqlDB.Prepare("delete from known where list = ?")
 	if err != nil {
 		return nil, err
@@ -150,17 +356,69 @@ func OpenListDB(connStr string) (*ListDB, error) {
 	if err != nil {
 		return nil, err
 	}
-	db.updateListStmt, err = db.sqlDB.Prepare("update list SET display = ?, public_signup = ?, hide_from = ?, action_mod = ?, action_member = ?, action_known = ?, action_unknown = ? where list.id = ?")
+	db.removeTemplatesStmt, err = db.sqlDB.Prepare("delete from template where list = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateListStmt, err = db.sqlDB.Prepare("update list SET display = ?, public_signup = ?, hide_from = ?, action_mod = ?, action_member = ?, action_known = ?, action_unknown = ?, action_blocked = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateArchiveStmt, err = db.sqlDB.Prepare("update list SET archive = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateModerationStmt, err = db.sqlDB.Prepare("update list SET held_notice = ?, mod_expiry = ?, expiry_notify_sender = ?, expiry_notify_mods = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateFooterStmt, err = db.sqlDB.Prepare("update list SET footer_plain = ?, footer_html = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateRateLimitStmt, err = db.sqlDB.Prepare("update list SET rate_limit_hour = ?, rate_limit_day = ?, rate_limit_action = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateHeadersStmt, err = db.sqlDB.Prepare("update list SET strip_headers = ?, static_headers = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updatePrefixStmt, err = db.sqlDB.Prepare("update list SET prefix = ?, no_prefix = ?, post_numbers = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.nextPostNumberStmt, err = db.sqlDB.Prepare("update list SET post_number = post_number + 1 where list.id = ? returning post_number")
+	if err != nil {
+		return nil, err
+	}
+	db.addPostNumberStmt, err = db.sqlDB.Prepare("insert into post_number (list, message_id, number, time) values (?, ?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.getPostNumberStmt, err = db.sqlDB.Prepare("select number from post_number where list = ? and message_id = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.removeOldNumbersStmt, err = db.sqlDB.Prepare("delete from post_number where list = ? and time < ?")
+	if err != nil {
+		return nil, err
+	}
+	db.removeListNumbersStmt, err = db.sqlDB.Prepare("delete from post_number where list = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateReplyToStmt, err = db.sqlDB.Prepare("update list SET reply_to = ?, reply_to_address = ?, keep_reply_to = ? where list.id = ?")
 	if err != nil {
 		return nil, err
 	}
 
 	// member
-	db.addMemberStmt, err = db.sqlDB.Prepare("replace into member (list, address, receive, moderate, notify, admin, bounces) values (?, ?, ?, ?, ?, ?, ?)")
+	db.addMemberStmt, err = db.sqlDB.Prepare("replace into member (list, address, receive, moderate, notify, admin, bounces, notify_mode, delivery) values (?, ?, ?, ?, ?, ?, ?, 'immediate', 'immediate')")
 	if err != nil {
 		return nil, err
 	}
-	db.getMemberStmt, err = db.sqlDB.Prepare("select receive, moderate, notify, admin, bounces from member where list = ? and address = ?")
+	db.getMemberStmt, err = db.sqlDB.Prepare("select receive, moderate, notify, admin, bounces, notify_mode, delivery from member where list = ? and address = ?")
 	if err != nil {
 		return nil, err
 	}
@@ -172,9 +430,143 @@ func OpenListDB(connStr string) (*ListDB, error) {
 	if err != nil {
 		return nil, err
 	}
+	db.updateNotifyModeStmt, err = db.sqlDB.Prepare("update member SET notify_mode = ? where list = ? and address = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.updateDeliveryStmt, err = db.sqlDB.Prepare("update member SET delivery = ? where list = ? and address = ?")
+	if err != nil {
+		return nil, err
+	}
+
+	// job
+	db.getLastRunStmt, err = db.sqlDB.Prepare("select last_run from job where name = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.setLastRunStmt, err = db.sqlDB.Prepare("replace into job (name, last_run) values (?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.removeLastRunStmt, err = db.sqlDB.Prepare("delete from job where name = ?")
+	if err != nil {
+		return nil, err
+	}
+
+	// alias
+	db.addAliasStmt, err = db.sqlDB.Prepare("insert into alias (list, local, domain) values (?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.getAliasesStmt, err = db.sqlDB.Prepare("select local, domain from alias where list = ? order by domain, local")
+	if err != nil {
+		return nil, err
+	}
+	db.getAddressOwnerStmt, err = db.sqlDB.Prepare("select coalesce((select id from list where local = ?1 and domain = ?2), (select list from alias where local = ?1 and domain = ?2), 0)")
+	if err != nil {
+		return nil, err
+	}
+	db.removeAliasStmt, err = db.sqlDB.Prepare("delete from alias where local = ? and domain = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.removeAliasesStmt, err = db.sqlDB.Prepare("delete from alias where list = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.renameListStmt, err = db.sqlDB.Prepare("update list SET local = ?, domain = ? where list.id = ?")
+	if err != nil {
+		return nil, err
+	}
+
+	// sublist
+	db.addSublistStmt, err = db.sqlDB.Prepare("insert or ignore into sublist (list, sublist) values (?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.getSublistsStmt, err = db.sqlDB.Prepare("select l.id, l.display, l.local, l.domain, l.archive from list l, sublist s where l.id = s.sublist and s.list = ? order by l.domain, l.local")
+	if err != nil {
+		return nil, err
+	}
+	db.includesStmt, err = db.sqlDB.Prepare(`
+		with recursive included(id) as (
+			select ?
+			union
+			select sublist.sublist from sublist join included on sublist.list = included.id
+		)
+		select exists(select 1 from included where id = ?)`)
+	if err != nil {
+		return nil, err
+	}
+	db.removeSublistStmt, err = db.sqlDB.Prepare("delete from sublist where list = ? and sublist = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.removeSublistsStmt, err = db.sqlDB.Prepare("delete from sublist where list = ? or sublist = ?")
+	if err != nil {
+		return nil, err
+	}
+
+	// template
+	db.getTemplateStmt, err = db.sqlDB.Prepare("select src from template where list = ? and name = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.getTemplatesStmt, err = db.sqlDB.Prepare("select name from template where list = ? order by name")
+	if err != nil {
+		return nil, err
+	}
+	db.removeTemplateStmt, err = db.sqlDB.Prepare("delete from template where list = ? and name = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.setTemplateStmt, err = db.sqlDB.Prepare("replace into template (list, name, src) values (?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+
+	// post
+	db.addPostStmt, err = db.sqlDB.Prepare("insert into post (list, sender, time) values (?, ?, ?)")
+	if err != nil {
+		return nil, err
+	}
+	db.countPostsStmt, err = db.sqlDB.Prepare("select count(*) from post where list = ? and sender = ? and time >= ?")
+	if err != nil {
+		return nil, err
+	}
+	db.getPostCountsStmt, err = db.sqlDB.Prepare("select sender, sum(time >= ?), count(*) from post where list = ? and time >= ? group by sender order by count(*) desc, sender")
+	if err != nil {
+		return nil, err
+	}
+	db.removeOldPostsStmt, err = db.sqlDB.Prepare("delete from post where list = ? and time < ?")
+	if err != nil {
+		return nil, err
+	}
+	db.removeListPostsStmt, err = db.sqlDB.Prepare("delete from post where list = ?")
+	if err != nil {
+		return nil, err
+	}
+
+	// list template
+	db.getListTmplStmt, err = db.sqlDB.Prepare("select settings from list_template where name = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.getListTmplsStmt, err = db.sqlDB.Prepare("select name from list_template order by name")
+	if err != nil {
+		return nil, err
+	}
+	db.removeListTmplStmt, err = db.sqlDB.Prepare("delete from list_template where name = ?")
+	if err != nil {
+		return nil, err
+	}
+	db.saveListTmplStmt, err = db.sqlDB.Prepare("replace into list_template (name, settings) values (?, ?)")
+	if err != nil {
+		return nil, err
+	}
 
 	// user
-	db.getMembershipsStmt, err = db.sqlDB.Prepare("select l.id, l.display, l.local, l.domain, m.receive, m.moderate, m.notify, m.admin, m.bounces from list l, member m where l.id = m.list and m.address = ? order by l.domain, l.local")
+	db.getMembershipsStmt, err = db.sqlDB.Prepare("select l.id, l.display, l.local, l.domain, l.archive, m.receive, m.moderate, m.notify, m.admin, m.bounces, m.notify_mode, m.delivery from list l, member m where l.id = m.list and m.address = ? order by l.domain, l.local")
 	if err != nil {
 		return nil, err
 	}
@@ -188,7 +580,7 @@ func (db *ListDB) Close() error {
 
 func (db *ListDB) listsWhere(condition string) ([]ulist.ListInfo, error) {
 
-	rows, err := db.sqlDB.Query("SELECT id, display, local, domain FROM list WHERE " + condition + " ORDER BY domain, local")
+	rows, err := db.sqlDB.Query("SELECT id, display, local, domain, archive FROM list WHERE " + condition + " ORDER BY domain, local")
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
@@ -197,7 +589,7 @@ func (db *ListDB) listsWhere(condition string) ([]ulist.ListInfo, error) {
 	lists := []ulist.ListInfo{}
 	for rows.Next() {
 		var l ulist.ListInfo
-		rows.Scan(&l.ID, &l.Display, &l.Local, &l.Domain)
+		rows.Scan(&l.ID, &l.Display, &l.Local, &l.Domain, &l.Archive)
 		lists = append(lists, l)
 	}
 
@@ -238,28 +630,36 @@ func (db *ListDB) Create(address, name string) (*ulist.List, error) {
 		return nil, fmt.Errorf(`list address can't end with "%s"`, ulist.BounceAddressSuffix)
 	}
 
+	if strings.HasSuffix(addr.Local, ulist.OwnerAddressSuffix) {
+		return nil, fmt.Errorf(`list address can't end with "%s"`, ulist.OwnerAddressSuffix)
+	}
+
 	if name != "" {
 		addr.Display = name // override parsed display name
 	}
 
+	if exists, err := db.IsList(*addr); err != nil {
+		return nil, err
+	} else if exists {
+		return nil, fmt.Errorf("%s is a list or alias already", addr)
+	}
+
 	hmacKey, err := randomString32()
 	if err != nil {
 		return nil, err
 	}
 
-	if _, err := db.createListStmt.Exec(addr.Display, addr.Local, addr.Domain, hmacKey, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Mod); err != nil {
+	if _, err := db.createListStmt.Exec(addr.Display, addr.Local, addr.Domain, hmacKey, ulist.Pass, ulist.Pass, ulist.Pass, ulist.Mod, ulist.Reject); err != nil {
 		return nil, err
 	}
 
 	return db.GetList(addr)
 }
 
-// *List can be nil, error is never sql.ErrNoRows
+// GetList returns the list with the given address or alias. The address of the returned list is always the canonical one. *List can be nil, error is never sql.ErrNoRows.
 func (db *ListDB) GetList(listAddress *mailutil.Addr) (*ulist.List, error) {
 	var list = &ulist.List{}
-	list.Local = listAddress.Local
-	list.Domain = listAddress.Domain
-	var err = db.getListStmt.QueryRow(listAddress.Local, listAddress.Domain).Scan(&list.ID, &list.Display, &list.HMACKey, &list.PublicSignup, &list.HideFrom, &list.ActionMod, &list.ActionMember, &list.ActionUnknown, &list.ActionKnown)
+	var err = db.getListStmt.QueryRow(listAddress.Local, listAddress.Domain).Scan(&list.ID, &list.Display, &list.HMACKey, &list.PublicSignup, &list.HideFrom, &list.ActionMod, &list.ActionMember, &list.ActionUnknown, &list.ActionKnown, &list.ActionBlocked, &list.HeldNotice, &list.ModExpiry, &list.ExpiryNotifySender, &list.ExpiryNotifyMods, &list.Archive, &list.ReplyTo, &list.ReplyToAddress, &list.KeepReplyTo, &list.Prefix, &list.NoPrefix, &list.PostNumbers, &list.FooterPlain, &list.FooterHTML, &list.StripHeaders, &list.StaticHeaders, &list.RateLimitHour, &list.RateLimitDay, &list.RateLimitAction, &list.Local, &list.Domain)
 	switch err {
 	case nil:
 		return list, nil
@@ -286,16 +686,20 @@ func (db *ListDB) Memberships(member *ulist.Addr) ([]ulist.Membership, error) {
 	memberships := []ulist.Membership{}
 	for rows.Next() {
 		var m ulist.Membership
-		rows.Scan(&m.ID, &m.Display, &m.Local, &m.Domain, &m.Receive, &m.Moderate, &m.Notify, &m.Admin, &m.Bounces)
+		rows.Scan(&m.ID, &m.Display, &m.Local, &m.Domain, &m.Archive, &m.Receive, &m.Moderate, &m.Notify, &m.Admin, &m.Bounces, &m.NotifyMode, &m.Delivery)
 		memberships = append(memberships, m)
 	}
 
 	return memberships, nil
 }
 
-func (db *ListDB) Update(list *ulist.List, display string, publicSignup, hideFrom bool, actionMod, actionMember, actionKnown, actionUnknown ulist.Action) error {
+func (db *ListDB) Update(list *ulist.List, display string, publicSignup, hideFrom bool, actionMod, actionMember, actionKnown, actionUnknown, actionBlocked ulist.Action) error {
+
+	if actionBlocked != ulist.Reject && actionBlocked != ulist.Discard {
+		return errors.New("blocked senders must be rejected or discarded")
+	}
 
-	_, err := db.updateListStmt.Exec(display, publicSignup, hideFrom, actionMod, actionMember, actionKnown, actionUnknown, list.ID)
+	_, err := db.updateListStmt.Exec(display, publicSignup, hideFrom, actionMod, actionMember, actionKnown, actionUnknown, actionBlocked, list.ID)
 	if err != nil {
 		return err
 	}
@@ -307,78 +711,571 @@ func (db *ListDB) Update(list *ulist.List, display string, publicSignup, hideFro
 	list.ActionMember = actionMember
 	list.ActionKnown = actionKnown
 	list.ActionUnknown = actionUnknown
+	list.ActionBlocked = actionBlocked
 	return nil
 }
 
-func (db *ListDB) Admins(list *ulist.List) ([]string, error) {
-	return db.membersWhere(list, db.getAdminsStmt)
-}
+func (db *ListDB) UpdateModeration(list *ulist.List, heldNotice bool, modExpiry int, expiryNotifySender, expiryNotifyMods bool) error {
 
-// GetMembership returns whether addr is a member of the list and what permissions she has.
-func (db *ListDB) GetMembership(list *ulist.List, addr *mailutil.Addr) (ulist.Membership, error) {
-	m := ulist.Membership{
-		ListInfo: list.ListInfo,
-	}
-	err := db.getMemberStmt.QueryRow(list.ID, addr.RFC5322AddrSpec()).Scan(&m.Receive, &m.Moderate, &m.Notify, &m.Admin, &m.Bounces)
-	switch err {
-	case nil:
-		m.Member = true
-		m.MemberAddress = addr.RFC5322AddrSpec()
-		return m, nil
-	case sql.ErrNoRows:
-		return m, nil
-	default:
-		return m, err
+	if modExpiry < 0 {
+		return errors.New("retention period must not be negative")
 	}
-}
 
-// list and addr can be nil
-func (db *ListDB) IsMember(list *ulist.List, addr *mailutil.Addr) (bool, error) {
-	if list == nil || addr == nil {
-		return false, nil
+	_, err := db.updateModerationStmt.Exec(heldNotice, modExpiry, expiryNotifySender, expiryNotifyMods, list.ID)
+	if err != nil {
+		return err
 	}
-	membership, err := db.GetMembership(list, addr)
-	return membership.Member, err
-}
 
-func (db *ListDB) Members(list *ulist.List) ([]ulist.Membership, error) {
+	list.HeldNotice = heldNotice
+	list.ModExpiry = modExpiry
+	list.ExpiryNotifySender = expiryNotifySender
+	list.ExpiryNotifyMods = expiryNotifyMods
+	return nil
+}
 
-	rows, err := db.getMembersStmt.Query(list.ID)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
-	}
-	defer rows.Close()
+func (db *ListDB) UpdateArchive(list *ulist.List, archive ulist.ArchiveAccess) error {
 
-	members := []ulist.Membership{}
-	for rows.Next() {
-		m := ulist.Membership{}
-		m.ListInfo = list.ListInfo
-		rows.Scan(&m.MemberAddress, &m.Receive, &m.Moderate, &m.Notify, &m.Admin, &m.Bounces)
-		members = append(members, m)
+	_, err := db.updateArchiveStmt.Exec(archive, list.ID)
+	if err != nil {
+		return err
 	}
 
-	return members, nil
+	list.Archive = archive
+	return nil
 }
 
-func (db *ListDB) BounceNotifieds(list *ulist.List) ([]string, error) {
-	return db.membersWhere(list, db.getBouncesStmt)
-}
+// UpdateFooter sets the footer templates. They should have been validated before.
+func (db *ListDB) UpdateFooter(list *ulist.List, plain, html string) error {
 
-func (db *ListDB) Notifieds(list *ulist.List) ([]string, error) {
-	return db.membersWhere(list, db.getNotifiedsStmt)
-}
+	_, err := db.updateFooterStmt.Exec(plain, html, list.ID)
+	if err != nil {
+		return err
+	}
 
-func (db *ListDB) Receivers(list *ulist.List) ([]string, error) {
-	return db.membersWhere(list, db.getReceiversStmt)
+	list.FooterPlain = plain
+	list.FooterHTML = html
+	return nil
 }
 
-func (db *ListDB) Knowns(list *ulist.List) ([]string, error) {
+// UpdateRateLimit sets the maximum number of forwarded messages per sender and hour or day, and what happens to further messages. Zero means unlimited.
+func (db *ListDB) UpdateRateLimit(list *ulist.List, hour, day int, action ulist.Action) error {
 
-	rows, err := db.getKnownsStmt.Query(list.ID)
-	if err != nil && err != sql.ErrNoRows {
-		return nil, err
+	if hour < 0 || day < 0 {
+		return errors.New("rate limits must not be negative")
 	}
-	defer rows.Close()
+
+	if action != ulist.Mod && action != ulist.Reject {
+		return errors.New("messages over the rate limit must be moderated or rejected")
+	}
+
+	_, err := db.updateRateLimitStmt.Exec(hour, day, action, list.ID)
+	if err != nil {
+		return err
+	}
+
+	list.RateLimitHour = hour
+	list.RateLimitDay = day
+	list.RateLimitAction = action
+	return nil
+}
+
+// UpdateHeaders sets the header keys which are removed from forwarded messages and the header fields which are added. If strip is empty or equals ulist.DefaultStripHeaders, the default is used.
+func (db *ListDB) UpdateHeaders(list *ulist.List, strip, static string) error {
+
+	stripKeys, err := ulist.ParseHeaderKeys(strip)
+	if err != nil {
+		return err
+	}
+	slices.Sort(stripKeys)
+	if slices.Equal(stripKeys, ulist.DefaultStripHeaders) {
+		stripKeys = nil
+	}
+	strip = strings.Join(stripKeys, "\n")
+
+	staticHeader, err := ulist.ParseStaticHeaders(static)
+	if err != nil {
+		return err
+	}
+	static = ulist.FormatStaticHeaders(staticHeader)
+
+	_, err = db.updateHeadersStmt.Exec(strip, static, list.ID)
+	if err != nil {
+		return err
+	}
+
+	list.StripHeaders = strip
+	list.StaticHeaders = static
+	return nil
+}
+
+// UpdatePrefix sets the subject tag. Square brackets and line breaks are not allowed in the prefix.
+func (db *ListDB) UpdatePrefix(list *ulist.List, prefix string, noPrefix, postNumbers bool) error {
+
+	prefix = strings.TrimSpace(prefix)
+	if strings.ContainsAny(prefix, "[]\r\n") {
+		return errors.New("subject prefix must not contain square brackets or line breaks")
+	}
+
+	_, err := db.updatePrefixStmt.Exec(prefix, noPrefix, postNumbers, list.ID)
+	if err != nil {
+		return err
+	}
+
+	list.Prefix = prefix
+	list.NoPrefix = noPrefix
+	list.PostNumbers = postNumbers
+	return nil
+}
+
+// PostNumber returns the running post number of the message. If the message has no number yet, the running number of the list is incremented. Numbers of messages which are older than a week are removed, as a retry by the MTA is not expected any more.
+func (db *ListDB) PostNumber(list *ulist.List, messageID string, t time.Time) (int, error) {
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Stmt(db.removeOldNumbersStmt).Exec(list.ID, t.Add(-7*24*time.Hour).Unix()); err != nil {
+		return 0, err
+	}
+
+	var number int
+	switch err := tx.Stmt(db.getPostNumberStmt).QueryRow(list.ID, messageID).Scan(&number); err {
+	case nil:
+		return number, nil
+	case sql.ErrNoRows:
+	default:
+		return 0, err
+	}
+
+	if err := tx.Stmt(db.nextPostNumberStmt).QueryRow(list.ID).Scan(&number); err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Stmt(db.addPostNumberStmt).Exec(list.ID, messageID, number, t.Unix()); err != nil {
+		return 0, err
+	}
+
+	return number, tx.Commit()
+}
+
+// UpdateReplyTo sets the Reply-To policy. The address is required for ReplyToFixed and ignored otherwise.
+func (db *ListDB) UpdateReplyTo(list *ulist.List, replyTo ulist.ReplyTo, rawAddress string, keep bool) error {
+
+	var address string
+	if replyTo == ulist.ReplyToFixed {
+		addr, err := mailutil.ParseAddress(rawAddress)
+		if err != nil {
+			return fmt.Errorf("fixed Reply-To address: %w", err)
+		}
+		address = addr.RFC5322NameAddr()
+	}
+
+	_, err := db.updateReplyToStmt.Exec(replyTo, address, keep, list.ID)
+	if err != nil {
+		return err
+	}
+
+	list.ReplyTo = replyTo
+	list.ReplyToAddress = address
+	list.KeepReplyTo = keep
+	return nil
+}
+
+func (db *ListDB) Admins(list *ulist.List) ([]string, error) {
+	return db.membersWhere(list, db.getAdminsStmt)
+}
+
+// GetMembership returns whether addr is a member of the list and what permissions she has.
+func (db *ListDB) GetMembership(list *ulist.List, addr *mailutil.Addr) (ulist.Membership, error) {
+	m := ulist.Membership{
+		ListInfo: list.ListInfo,
+	}
+	err := db.getMemberStmt.QueryRow(list.ID, addr.RFC5322AddrSpec()).Scan(&m.Receive, &m.Moderate, &m.Notify, &m.Admin, &m.Bounces, &m.NotifyMode, &m.Delivery)
+	switch err {
+	case nil:
+		m.Member = true
+		m.MemberAddress = addr.RFC5322AddrSpec()
+		return m, nil
+	case sql.ErrNoRows:
+		return m, nil
+	default:
+		return m, err
+	}
+}
+
+// list and addr can be nil
+func (db *ListDB) IsMember(list *ulist.List, addr *mailutil.Addr) (bool, error) {
+	if list == nil || addr == nil {
+		return false, nil
+	}
+	membership, err := db.GetMembership(list, addr)
+	return membership.Member, err
+}
+
+func (db *ListDB) Members(list *ulist.List) ([]ulist.Membership, error) {
+
+	rows, err := db.getMembersStmt.Query(list.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
+
+	members := []ulist.Membership{}
+	for rows.Next() {
+		m := ulist.Membership{}
+		m.ListInfo = list.ListInfo
+		rows.Scan(&m.MemberAddress, &m.Receive, &m.Moderate, &m.Notify, &m.Admin, &m.Bounces, &m.NotifyMode, &m.Delivery)
+		members = append(members, m)
+	}
+
+	return members, nil
+}
+
+func (db *ListDB) BounceNotifieds(list *ulist.List) ([]string, error) {
+	return db.membersWhere(list, db.getBouncesStmt)
+}
+
+func (db *ListDB) Notifieds(list *ulist.List) ([]string, error) {
+	return db.membersWhere(list, db.getNotifiedsStmt)
+}
+
+func (db *ListDB) NotifiedsWithMode(list *ulist.List, mode ulist.NotifyMode) ([]string, error) {
+	return db.membersWhere(list, db.getNotifiedsModeStmt, mode)
+}
+
+func (db *ListDB) LastRun(job string) (time.Time, error) {
+	var unix int64
+	switch err := db.getLastRunStmt.QueryRow(job).Scan(&unix); err {
+	case nil:
+		return time.Unix(unix, 0), nil
+	case sql.ErrNoRows:
+		return time.Time{}, nil
+	default:
+		return time.Time{}, err
+	}
+}
+
+func (db *ListDB) SetLastRun(job string, t time.Time) error {
+	_, err := db.setLastRunStmt.Exec(job, t.Unix())
+	return err
+}
+
+func (db *ListDB) RemoveLastRun(job string) error {
+	_, err := db.removeLastRunStmt.Exec(job)
+	return err
+}
+
+func (db *ListDB) GetTemplate(list *ulist.List, name string) (string, error) {
+	var src string
+	switch err := db.getTemplateStmt.QueryRow(list.ID, name).Scan(&src); err {
+	case nil, sql.ErrNoRows:
+		return src, nil
+	default:
+		return "", err
+	}
+}
+
+func (db *ListDB) SetTemplate(list *ulist.List, name, src string) error {
+	var err error
+	if src == "" {
+		_, err = db.removeTemplateStmt.Exec(list.ID, name)
+	} else {
+		_, err = db.setTemplateStmt.Exec(list.ID, name, src)
+	}
+	return err
+}
+
+func (db *ListDB) Templates(list *ulist.List) ([]string, error) {
+	return db.membersWhere(list, db.getTemplatesStmt)
+}
+
+// AddPost records a forwarded message of the sender. Records which are older than a day are removed, as they are not needed for rate limits any more.
+func (db *ListDB) AddPost(list *ulist.List, sender string, t time.Time) error {
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Stmt(db.removeOldPostsStmt).Exec(list.ID, t.Add(-24*time.Hour).Unix()); err != nil {
+		return err
+	}
+
+	if _, err := tx.Stmt(db.addPostStmt).Exec(list.ID, sender, t.Unix()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// CountPosts returns the number of forwarded messages of the sender since the given time.
+func (db *ListDB) CountPosts(list *ulist.List, sender string, since time.Time) (int, error) {
+	var count int
+	return count, db.countPostsStmt.QueryRow(list.ID, sender, since.Unix()).Scan(&count)
+}
+
+// PostCounts returns the number of forwarded messages per sender in the last hour and day, most active senders first.
+func (db *ListDB) PostCounts(list *ulist.List, now time.Time) ([]ulist.PostCount, error) {
+
+	rows, err := db.getPostCountsStmt.Query(now.Add(-time.Hour).Unix(), list.ID, now.Add(-24*time.Hour).Unix())
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []ulist.PostCount{}
+	for rows.Next() {
+		var c ulist.PostCount
+		if err = rows.Scan(&c.Sender, &c.Hour, &c.Day); err != nil {
+			return nil, err
+		}
+		counts = append(counts, c)
+	}
+	return counts, nil
+}
+
+// GetListTemplate returns the list template with the given name, or nil if it doesn't exist.
+func (db *ListDB) GetListTemplate(name string) (*ulist.ListTemplate, error) {
+	var settings string
+	switch err := db.getListTmplStmt.QueryRow(name).Scan(&settings); err {
+	case nil:
+	case sql.ErrNoRows:
+		return nil, nil
+	default:
+		return nil, err
+	}
+	var t = &ulist.ListTemplate{
+		LimitAction: ulist.Mod, // templates which have been saved before rate limits existed
+	}
+	if err := json.Unmarshal([]byte(settings), t); err != nil {
+		return nil, err
+	}
+	t.Name = name
+	return t, nil
+}
+
+// ListTemplates returns the names of all list templates.
+func (db *ListDB) ListTemplates() ([]string, error) {
+
+	rows, err := db.getListTmplsStmt.Query()
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
+
+func (db *ListDB) RemoveListTemplate(name string) error {
+	_, err := db.removeListTmplStmt.Exec(name)
+	return err
+}
+
+// SaveListTemplate stores the template. An existing template with the same name is replaced.
+func (db *ListDB) SaveListTemplate(t *ulist.ListTemplate) error {
+
+	if t.Name == "" {
+		return errors.New("template name is empty")
+	}
+	if t.ActionBlocked != ulist.Reject && t.ActionBlocked != ulist.Discard {
+		return errors.New("blocked senders must be rejected or discarded")
+	}
+
+	settings, err := json.Marshal(t)
+	if err != nil {
+		return err
+	}
+	_, err = db.saveListTmplStmt.Exec(t.Name, string(settings))
+	return err
+}
+
+// Aliases returns the additional addresses of the list.
+func (db *ListDB) Aliases(list *ulist.List) ([]*mailutil.Addr, error) {
+
+	rows, err := db.getAliasesStmt.Query(list.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
+
+	aliases := []*mailutil.Addr{}
+	for rows.Next() {
+		var alias = &mailutil.Addr{}
+		rows.Scan(&alias.Local, &alias.Domain)
+		aliases = append(aliases, alias)
+	}
+
+	return aliases, nil
+}
+
+// UpdateAliases replaces the additional addresses of the list. An alias must not be the address or alias of another list, and it must not end with the bounce suffix.
+func (db *ListDB) UpdateAliases(list *ulist.List, aliases []*mailutil.Addr) error {
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Stmt(db.removeAliasesStmt).Exec(list.ID); err != nil {
+		return err
+	}
+
+	var added []*mailutil.Addr
+	for _, alias := range aliases {
+		if list.Equals(alias) || slices.ContainsFunc(added, alias.Equals) {
+			continue
+		}
+		if strings.HasSuffix(alias.Local, ulist.BounceAddressSuffix) {
+			return fmt.Errorf(`alias can't end with "%s"`, ulist.BounceAddressSuffix)
+		}
+		if strings.HasSuffix(alias.Local, ulist.OwnerAddressSuffix) {
+			return fmt.Errorf(`alias can't end with "%s"`, ulist.OwnerAddressSuffix)
+		}
+		var exists bool
+		if err := tx.Stmt(db.isListStmt).QueryRow(alias.Local, alias.Domain).Scan(&exists); err != nil {
+			return err
+		}
+		if exists {
+			return fmt.Errorf("%s is a list or alias already", alias)
+		}
+		if _, err := tx.Stmt(db.addAliasStmt).Exec(list.ID, alias.Local, alias.Domain); err != nil {
+			return err
+		}
+		added = append(added, alias)
+	}
+
+	return tx.Commit()
+}
+
+// Rename changes the address of the list. The new address can be an alias of the list. If keepAlias is true, the old address becomes an alias.
+func (db *ListDB) Rename(list *ulist.List, addr *mailutil.Addr, keepAlias bool) error {
+
+	if strings.HasSuffix(addr.Local, ulist.BounceAddressSuffix) {
+		return fmt.Errorf(`list address can't end with "%s"`, ulist.BounceAddressSuffix)
+	}
+
+	if strings.HasSuffix(addr.Local, ulist.OwnerAddressSuffix) {
+		return fmt.Errorf(`list address can't end with "%s"`, ulist.OwnerAddressSuffix)
+	}
+
+	if list.Local == addr.Local && list.Domain == addr.Domain {
+		return errors.New("the list has this address already")
+	}
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var owner int
+	if err := tx.Stmt(db.getAddressOwnerStmt).QueryRow(addr.Local, addr.Domain).Scan(&owner); err != nil {
+		return err
+	}
+	if owner != 0 && owner != list.ID {
+		return fmt.Errorf("%s is a list or alias already", addr)
+	}
+
+	if _, err := tx.Stmt(db.removeAliasStmt).Exec(addr.Local, addr.Domain); err != nil {
+		return err
+	}
+
+	if _, err := tx.Stmt(db.renameListStmt).Exec(addr.Local, addr.Domain, list.ID); err != nil {
+		return err
+	}
+
+	if keepAlias {
+		if _, err := tx.Stmt(db.addAliasStmt).Exec(list.ID, list.Local, list.Domain); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+
+	list.Local = addr.Local
+	list.Domain = addr.Domain
+	return nil
+}
+
+// AddSublist includes the receivers of sublist in the receivers of list. It returns ulist.ErrSublistCycle if the sublist includes the list already, directly or indirectly.
+func (db *ListDB) AddSublist(list, sublist *ulist.List) error {
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var cycle bool
+	if err := tx.Stmt(db.includesStmt).QueryRow(sublist.ID, list.ID).Scan(&cycle); err != nil {
+		return err
+	}
+	if cycle {
+		return ulist.ErrSublistCycle
+	}
+
+	if _, err := tx.Stmt(db.addSublistStmt).Exec(list.ID, sublist.ID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (db *ListDB) RemoveSublist(list, sublist *ulist.List) error {
+	_, err := db.removeSublistStmt.Exec(list.ID, sublist.ID)
+	return err
+}
+
+// Sublists returns the lists which are included directly.
+func (db *ListDB) Sublists(list *ulist.List) ([]ulist.ListInfo, error) {
+
+	rows, err := db.getSublistsStmt.Query(list.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lists := []ulist.ListInfo{}
+	for rows.Next() {
+		var l ulist.ListInfo
+		rows.Scan(&l.ID, &l.Display, &l.Local, &l.Domain, &l.Archive)
+		lists = append(lists, l)
+	}
+
+	return lists, nil
+}
+
+// Receivers returns the members who receive each message immediately, including the members of sublists.
+func (db *ListDB) Receivers(list *ulist.List) ([]string, error) {
+	return db.membersWhere(list, db.getReceiversStmt, ulist.DeliveryImmediate)
+}
+
+// DigestReceivers returns the members who receive digests with the given delivery mode, including the members of sublists. Members who receive each message immediately through the list or a sublist are left out.
+func (db *ListDB) DigestReceivers(list *ulist.List, delivery ulist.Delivery) ([]string, error) {
+	return db.membersWhere(list, db.getDigestRcptsStmt, delivery, ulist.DeliveryImmediate)
+}
+
+func (db *ListDB) Knowns(list *ulist.List) ([]string, error) {
+
+	rows, err := db.getKnownsStmt.Query(list.ID)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
 
 	knowns := []string{}
 	for rows.Next() {
@@ -421,6 +1318,28 @@ func (db *ListDB) AddMembers(list *ulist.List, addrs []*mailutil.Addr, receive,
 	return added, nil
 }
 
+func (db *ListDB) UpdateNotifyMode(list *ulist.List, rawAddress string, mode ulist.NotifyMode) error {
+
+	addr, err := mailutil.ParseAddress(rawAddress)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.updateNotifyModeStmt.Exec(mode, list.ID, addr.RFC5322AddrSpec())
+	return err
+}
+
+func (db *ListDB) UpdateDelivery(list *ulist.List, rawAddress string, delivery ulist.Delivery) error {
+
+	addr, err := mailutil.ParseAddress(rawAddress)
+	if err != nil {
+		return err
+	}
+
+	_, err = db.updateDeliveryStmt.Exec(delivery, list.ID, addr.RFC5322AddrSpec())
+	return err
+}
+
 func (db *ListDB) UpdateMember(list *ulist.List, rawAddress string, receive, moderate, notify, admin, bounces bool) error {
 
 	addr, err := mailutil.ParseAddress(rawAddress)
@@ -521,6 +1440,122 @@ func (db *ListDB) RemoveKnowns(list *ulist.List, addrs []*mailutil.Addr) ([]*mai
 	return removed, nil
 }
 
+func (db *ListDB) AddAuditEntry(list *ulist.List, entry ulist.AuditEntry) error {
+	_, err := db.addAuditEntryStmt.Exec(list.ID, entry.Time.Unix(), entry.Moderator, string(entry.Decision), entry.Subject, entry.Sender, entry.MessageID)
+	return err
+}
+
+// AuditEntries returns the audit entries of the list, newest first.
+func (db *ListDB) AuditEntries(list *ulist.List, offset, limit int) ([]ulist.AuditEntry, error) {
+
+	rows, err := db.getAuditEntriesStmt.Query(list.ID, limit, offset)
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []ulist.AuditEntry{}
+	for rows.Next() {
+		var entry ulist.AuditEntry
+		var unix int64
+		if err := rows.Scan(&unix, &entry.Moderator, &entry.Decision, &entry.Subject, &entry.Sender, &entry.MessageID); err != nil {
+			return nil, err
+		}
+		entry.Time = time.Unix(unix, 0)
+		entries = append(entries, entry)
+	}
+
+	return entries, rows.Err()
+}
+
+func (db *ListDB) CountAuditEntries(list *ulist.List) (int, error) {
+	var count int
+	return count, db.countAuditEntriesStmt.QueryRow(list.ID).Scan(&count)
+}
+
+// blockedListID returns the list ID which is used in the blocked table. Zero means instance-wide.
+func blockedListID(list *ulist.List) int {
+	if list == nil {
+		return 0
+	}
+	return list.ID
+}
+
+// returns patterns which have been added successfully
+func (db *ListDB) AddBlocked(list *ulist.List, patterns []string) ([]string, error) {
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(db.addBlockedStmt)
+
+	var added = make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if _, err := stmt.Exec(blockedListID(list), pattern); err != nil {
+			return nil, err // not committed, return empty slice
+		}
+		added = append(added, pattern)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err // not committed, return empty slice
+	}
+
+	return added, nil
+}
+
+func (db *ListDB) Blocked(list *ulist.List) ([]string, error) {
+
+	rows, err := db.getBlockedStmt.Query(blockedListID(list))
+	if err != nil && err != sql.ErrNoRows {
+		return nil, err
+	}
+	defer rows.Close()
+
+	patterns := []string{}
+	for rows.Next() {
+		var pattern string
+		rows.Scan(&pattern)
+		patterns = append(patterns, pattern)
+	}
+
+	return patterns, nil
+}
+
+func (db *ListDB) IsBlocked(list *ulist.List, addr *mailutil.Addr) (bool, error) {
+	var blocked bool
+	return blocked, db.isBlockedStmt.QueryRow(blockedListID(list), addr.RFC5322AddrSpec(), addr.Domain).Scan(&blocked)
+}
+
+// returns patterns which have been removed successfully
+func (db *ListDB) RemoveBlocked(list *ulist.List, patterns []string) ([]string, error) {
+
+	tx, err := db.sqlDB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	stmt := tx.Stmt(db.removeBlockedStmt)
+
+	var removed = make([]string, 0, len(patterns))
+	for _, pattern := range patterns {
+		if _, err := stmt.Exec(blockedListID(list), pattern); err != nil {
+			return nil, err // not committed, return empty slice
+		}
+		removed = append(removed, pattern)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err // not committed, return empty slice
+	}
+
+	return removed, nil
+}
+
 func (db *ListDB) Delete(list *ulist.List) error {
 
 	tx, err := db.sqlDB.Begin()
@@ -534,6 +1569,16 @@ func (db *ListDB) Delete(list *ulist.List) error {
 		return err
 	}
 
+	_, err = tx.Stmt(db.removeListAuditStmt).Exec(list.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(db.removeListBlockedStmt).Exec(list.ID)
+	if err != nil {
+		return err
+	}
+
 	_, err = tx.Stmt(db.removeListKnownsStmt).Exec(list.ID)
 	if err != nil {
 		return err
@@ -544,12 +1589,38 @@ func (db *ListDB) Delete(list *ulist.List) error {
 		return err
 	}
 
+	_, err = tx.Stmt(db.removeTemplatesStmt).Exec(list.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(db.removeListPostsStmt).Exec(list.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(db.removeListNumbersStmt).Exec(list.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(db.removeSublistsStmt).Exec(list.ID, list.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Stmt(db.removeAliasesStmt).Exec(list.ID)
+	if err != nil {
+		return err
+	}
+
 	return tx.Commit()
 }
 
-func (db *ListDB) membersWhere(list *ulist.List, stmt *sql.Stmt) ([]string, error) {
+// membersWhere runs a statement whose first parameter is the list ID. Further parameters are taken from args.
+func (db *ListDB) membersWhere(list *ulist.List, stmt *sql.Stmt, args ...interface{}) ([]string, error) {
 
-	rows, err := stmt.Query(list.ID)
+	rows, err := stmt.Query(append([]interface{}{list.ID}, args...)...)
 	if err != nil && err != sql.ErrNoRows {
 		return nil, err
 	}
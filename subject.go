@@ -0,0 +1,64 @@
+package ulist
+
+import (
+	"mime"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/wansing/ulist/mailutil"
+)
+
+// replyMarkerPattern matches a reply marker at the beginning of a subject, like "Re:", "AW:" (German), "SV:" (Scandinavian), "VS:" (Finnish), "Antw:" (Dutch), "Rif:" or "R:" (Italian), "Res:" (Portuguese), "Odp:" (Polish) or "YNT:" (Turkish). Some clients add a counter like "Re[2]:" or "Re(2):".
+var replyMarkerPattern = regexp.MustCompile(`(?i)^\s*(re|aw|sv|vs|antw|rif|r|res|odp|ynt)\s*(\[\d+\]|\(\d+\))?\s*:\s*`)
+
+// tagPattern matches a subject tag at the beginning of a subject, like "[List]" or "[List 12]". The submatch is the text inside the brackets.
+var tagPattern = regexp.MustCompile(`^\s*\[([^\]]*)\]\s*`)
+
+// numberPattern matches the number which is appended to a subject tag.
+var numberPattern = regexp.MustCompile(`^ \d+$`)
+
+// SubjectTag returns the text inside the square brackets of the subject prefix.
+func (list *List) SubjectTag() string {
+	if list.Prefix != "" {
+		return list.Prefix
+	}
+	return list.DisplayOrLocal()
+}
+
+// PrefixSubject prepends the subject tag to the subject. A number greater than zero is appended to the tag. Tags of the list and reply markers at the beginning of the subject are removed, and if the subject had a reply marker, the result starts with a single "Re: ".
+func (list *List) PrefixSubject(subject string, number int) string {
+
+	subject = mailutil.RobustWordDecode(subject)
+
+	if list.NoPrefix {
+		return mime.QEncoding.Encode("utf-8", subject)
+	}
+
+	var tag = list.SubjectTag()
+
+	var isReply bool
+	for {
+		if loc := replyMarkerPattern.FindStringIndex(subject); loc != nil {
+			isReply = true
+			subject = subject[loc[1]:]
+			continue
+		}
+		if match := tagPattern.FindStringSubmatch(subject); match != nil && (match[1] == tag || numberPattern.MatchString(strings.TrimPrefix(match[1], tag))) {
+			subject = subject[len(match[0]):]
+			continue
+		}
+		break
+	}
+	subject = strings.TrimSpace(subject)
+
+	if number > 0 {
+		tag += " " + strconv.Itoa(number)
+	}
+
+	subject = "[" + tag + "] " + subject
+	if isReply {
+		subject = "Re: " + subject
+	}
+	return mime.QEncoding.Encode("utf-8", subject)
+}
@@ -0,0 +1,71 @@
+package ulist
+
+import "testing"
+
+func TestPrefixSubject(t *testing.T) {
+
+	list := &List{}
+	list.Display = "List"
+
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"", "[List] "},
+		{"Foo", "[List] Foo"},
+		{"Re: Foo", "Re: [List] Foo"},
+		{"[List] Foo", "[List] Foo"},
+		{"Re: FW: [List] Foo", "Re: [List] FW: [List] Foo"},
+		{"[", "[List] ["},
+		{"Re: [", "Re: [List] ["},
+		{"[ <- Bracket", "[List] [ <- Bracket"},
+		{"Re: [ <- Bracket", "Re: [List] [ <- Bracket"},
+		{"[Bar] [List]", "[List] [Bar] [List]"},
+		{"Re: [Bar] [List]", "Re: [List] [Bar] [List]"},
+		{"Re: [List] Why is [List] in the subject?", "Re: [List] Why is [List] in the subject?"},
+		{"=?UTF-8?Q?=5BList=5D_Hello?=", "[List] Hello"},
+		{"Re: [List] Re: Foo", "Re: [List] Foo"},
+		{"AW: Re: [List 12] SV: Foo", "Re: [List] Foo"},
+		{"Rif: Foo", "Re: [List] Foo"},
+		{"RE[2]: Foo", "Re: [List] Foo"},
+		{"Rex: Foo", "[List] Rex: Foo"},
+		{"Reply: Foo", "[List] Reply: Foo"},
+	}
+
+	for _, test := range tests {
+		if result := list.PrefixSubject(test.input, 0); result != test.expected {
+			t.Errorf("%q: got %q, want %q", test.input, result, test.expected)
+		}
+	}
+
+	// custom prefix with post numbers
+
+	list.Prefix = "team"
+
+	numbered := []struct {
+		input    string
+		number   int
+		expected string
+	}{
+		{"Foo", 1, "[team 1] Foo"},
+		{"Re: [team 12] Re: Foo", 13, "Re: [team 13] Foo"},
+		{"Aw: [team] Foo", 14, "Re: [team 14] Foo"},
+		{"[List] Foo", 15, "[team 15] [List] Foo"},
+		{"[teammates] Foo", 16, "[team 16] [teammates] Foo"},
+		{"[team 1x] Foo", 17, "[team 17] [team 1x] Foo"},
+	}
+
+	for _, test := range numbered {
+		if result := list.PrefixSubject(test.input, test.number); result != test.expected {
+			t.Errorf("%q: got %q, want %q", test.input, result, test.expected)
+		}
+	}
+
+	// no prefix
+
+	list.NoPrefix = true
+
+	if result := list.PrefixSubject("Re: [team 12] Foo", 0); result != "Re: [team 12] Foo" {
+		t.Errorf("got %q, want the subject unchanged", result)
+	}
+}
@@ -0,0 +1,6 @@
+package ulist
+
+import "errors"
+
+// ErrSublistCycle is returned if a list would include itself through its sublists.
+var ErrSublistCycle = errors.New("the sublist includes the list already")
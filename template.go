@@ -0,0 +1,32 @@
+package ulist
+
+import (
+	"bytes"
+	"log"
+	"text/template"
+
+	"github.com/wansing/ulist/txt"
+)
+
+// executeTemplate executes the template which the list uses instead of def, or def if the list has no override. Broken overrides are logged and def is used instead.
+func (u *Ulist) executeTemplate(list *List, def *template.Template, buf *bytes.Buffer, data interface{}) error {
+
+	src, err := u.Lists.GetTemplate(list, def.Name())
+	if err != nil {
+		return err
+	}
+
+	if src != "" {
+		t, err := txt.Parse(def.Name(), src)
+		if err == nil {
+			var result bytes.Buffer
+			if err = t.Execute(&result, data); err == nil {
+				_, err = buf.Write(result.Bytes())
+				return err
+			}
+		}
+		log.Printf("error executing template %s of %s, using default: %v", def.Name(), list, err)
+	}
+
+	return def.Execute(buf, data)
+}
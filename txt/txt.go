@@ -1,7 +1,10 @@
 package txt
 
 import (
+	"bytes"
 	"embed"
+	"reflect"
+	"strings"
 	"text/template"
 )
 
@@ -14,11 +17,19 @@ func parse(fn string) *template.Template {
 
 // all these txt files should have CRLF line endings
 var (
-	CheckbackJoin  = parse("checkback-join.txt")
-	CheckbackLeave = parse("checkback-leave.txt")
-	NotifyMods     = parse("notify-mods.txt")
-	SignoffJoin    = parse("signoff-join.txt")
-	SignoffLeave   = parse("signoff-leave.txt")
+	CheckbackJoin     = parse("checkback-join.txt")
+	CheckbackLeave    = parse("checkback-leave.txt")
+	DigestTOC         = parse("digest-toc.txt")
+	ExpiredNotice     = parse("expired-notice.txt")
+	HeldNotice        = parse("held-notice.txt")
+	NotifyMods        = parse("notify-mods.txt")
+	NotifyModsDigest  = parse("notify-mods-digest.txt")
+	NotifyModsExpired = parse("notify-mods-expired.txt")
+	NotifyModsLimit   = parse("notify-mods-rate-limit.txt")
+	RenamedNotice     = parse("renamed-notice.txt")
+	ScheduledFailed   = parse("scheduled-failed.txt")
+	SignoffJoin       = parse("signoff-join.txt")
+	SignoffLeave      = parse("signoff-leave.txt")
 )
 
 type CheckbackJoinData struct {
@@ -33,14 +44,154 @@ type CheckbackLeaveData struct {
 	Url         string
 }
 
+type DigestTOCData struct {
+	Delivery     string
+	Entries      []DigestEntry
+	Footer       string
+	ListNameAddr string
+}
+
+type DigestEntry struct {
+	Number  int
+	From    string
+	Subject string
+}
+
+type ExpiredNoticeData struct {
+	Days        int
+	ListAddress string
+	Subject     string
+}
+
+type HeldNoticeData struct {
+	ListAddress string
+	Subject     string
+}
+
 type NotifyModsData struct {
 	Footer       string
 	ListNameAddr string
 	ModHref      string
 }
 
+type NotifyModsDigestData struct {
+	Footer       string
+	ListNameAddr string
+	Messages     []DigestMessage
+	ModHref      string
+}
+
+type DigestMessage struct {
+	From    string
+	Subject string
+	Spam    string // empty if not spam
+}
+
+type NotifyModsExpiredData struct {
+	Count        int
+	Days         int
+	Footer       string
+	ListNameAddr string
+	SettingsHref string
+}
+
+type NotifyModsLimitData struct {
+	Footer       string
+	Limit        string // like "10 messages per hour"
+	ListNameAddr string
+	ModHref      string
+	Rejected     bool
+	Sender       string
+}
+
+type RenamedNoticeData struct {
+	KeepAlias  bool
+	NewAddress string
+	OldAddress string
+}
+
+type ScheduledFailedData struct {
+	ListAddress string
+	Reason      string
+	Subject     string
+	Time        string
+}
+
 type SignoffJoinData struct {
 	Footer      string
 	ListAddress string
 	MailAddress string
 }
+
+type SignoffLeaveData struct {
+	ListAddress string
+}
+
+// Overridable is a template which list admins can override. The sample data is used for validation and previews.
+type Overridable struct {
+	Template *template.Template
+	Sample   interface{}
+}
+
+// Overridables are the templates which list admins can override.
+var Overridables = []Overridable{
+	{CheckbackJoin, CheckbackJoinData{ListAddress: "list@example.com", MailAddress: "alice@example.com", Url: "https://lists.example.com/join/list@example.com/1234567890/hmac/alice@example.com"}},
+	{CheckbackLeave, CheckbackLeaveData{ListAddress: "list@example.com", MailAddress: "alice@example.com", Url: "https://lists.example.com/leave/list@example.com/1234567890/hmac/alice@example.com"}},
+	{NotifyMods, NotifyModsData{Footer: "You can leave the mailing list here: https://lists.example.com/leave/list@example.com", ListNameAddr: `"List" <list@example.com>`, ModHref: "https://lists.example.com/mod/list@example.com"}},
+	{SignoffJoin, SignoffJoinData{Footer: "You can leave the mailing list here: https://lists.example.com/leave/list@example.com", ListAddress: "list@example.com", MailAddress: "alice@example.com"}},
+	{SignoffLeave, SignoffLeaveData{ListAddress: "list@example.com"}},
+}
+
+// GetOverridable returns the overridable template with the given name, like "signoff-join.txt".
+func GetOverridable(name string) (Overridable, bool) {
+	for _, o := range Overridables {
+		if o.Name() == name {
+			return o, true
+		}
+	}
+	return Overridable{}, false
+}
+
+func (o Overridable) Name() string {
+	return o.Template.Name()
+}
+
+// Default returns the source of the built-in template.
+func (o Overridable) Default() string {
+	src, _ := files.ReadFile(o.Name())
+	return string(src)
+}
+
+// Variables returns the names of the fields of the sample data, like ".ListAddress".
+func (o Overridable) Variables() []string {
+	var vars []string
+	t := reflect.TypeOf(o.Sample)
+	for i := 0; i < t.NumField(); i++ {
+		vars = append(vars, "."+t.Field(i).Name)
+	}
+	return vars
+}
+
+// Check parses the source of an override and executes it with the sample data. It returns the result, which can be used as a preview.
+func (o Overridable) Check(src string) (string, error) {
+	t, err := Parse(o.Name(), src)
+	if err != nil {
+		return "", err
+	}
+	var buf bytes.Buffer
+	if err := t.Execute(&buf, o.Sample); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// Parse parses the source of an override. Line endings are converted to CRLF.
+func Parse(name, src string) (*template.Template, error) {
+	return template.New(name).Option("missingkey=error").Parse(CRLF(src))
+}
+
+// CRLF converts all line endings to CRLF.
+func CRLF(s string) string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.ReplaceAll(s, "\n", "\r\n")
+}
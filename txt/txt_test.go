@@ -0,0 +1,39 @@
+package txt
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOverridables(t *testing.T) {
+
+	for _, o := range Overridables {
+		if _, err := o.Check(o.Default()); err != nil {
+			t.Errorf("%s: default does not pass the check: %v", o.Name(), err)
+		}
+	}
+
+	o, _ := GetOverridable("signoff-leave.txt")
+
+	got, err := o.Check("Bye from {{ .ListAddress }}\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Bye from list@example.com\r\n"; got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+
+	for _, broken := range []string{"{{ .MailAddress }}", "{{ .ListAddress", "{{ template \"other\" }}"} {
+		if _, err := o.Check(broken); err == nil {
+			t.Errorf("%q passes the check", broken)
+		}
+	}
+
+	if _, ok := GetOverridable("digest-toc.txt"); ok {
+		t.Errorf("digest-toc.txt is overridable")
+	}
+
+	if got := CRLF("a\nb\r\nc"); got != "a\r\nb\r\nc" {
+		t.Errorf("got %q", strings.ReplaceAll(got, "\r", `\r`))
+	}
+}
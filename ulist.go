@@ -16,6 +16,7 @@ import (
 	"strings"
 	"sync"
 	"syscall"
+	"time"
 
 	"github.com/wansing/ulist/mailutil"
 	"github.com/wansing/ulist/sockmap"
@@ -24,31 +25,70 @@ import (
 )
 
 const BounceAddressSuffix = "+bounces"
+const OwnerAddressSuffix = "+owner"
 const WebBatchLimit = 1000
 
 type ListRepo interface {
+	AddAuditEntry(list *List, entry AuditEntry) error
+	AddBlocked(list *List, patterns []string) ([]string, error) // list nil means the instance-wide blocklist
 	AddKnowns(list *List, addrs []*Addr) ([]*Addr, error)
 	AddMembers(list *List, addrs []*Addr, receive, moderate, notify, admin, bounces bool) ([]*Addr, error)
+	AddPost(list *List, sender string, t time.Time) error // removes counters which are older than a day
+	AddSublist(list, sublist *List) error
 	Admins(list *List) ([]string, error)
+	Aliases(list *List) ([]*Addr, error)
 	AllLists() ([]ListInfo, error)
+	AuditEntries(list *List, offset, limit int) ([]AuditEntry, error)
+	Blocked(list *List) ([]string, error) // list nil means the instance-wide blocklist
 	BounceNotifieds(list *List) ([]string, error)
+	CountAuditEntries(list *List) (int, error)
+	CountPosts(list *List, sender string, since time.Time) (int, error)
 	Create(address, name string) (*List, error)
 	Delete(list *List) error
-	GetList(list *Addr) (*List, error)
+	DigestReceivers(list *List, delivery Delivery) ([]string, error)
+	GetList(list *Addr) (*List, error)                   // list address or alias
+	GetListTemplate(name string) (*ListTemplate, error)  // nil if the template doesn't exist
+	GetTemplate(list *List, name string) (string, error) // empty if the list doesn't override the template
 	Members(list *List) ([]Membership, error)
 	GetMembership(list *List, user *Addr) (Membership, error)
 	IsList(addr Addr) (bool, error)
 	IsMember(list *List, addr *Addr) (bool, error)
+	IsBlocked(list *List, addr *Addr) (bool, error) // checks the blocklist of the list and the instance-wide blocklist
 	IsKnown(list *List, rawAddress string) (bool, error)
+	LastRun(job string) (time.Time, error) // zero time if the job has never run
 	Knowns(list *List) ([]string, error)
+	ListTemplates() ([]string, error) // names
 	Memberships(member *Addr) ([]Membership, error)
+	PostNumber(list *List, messageID string, t time.Time) (int, error) // the same number for the same Message-Id
 	Notifieds(list *List) ([]string, error)
+	NotifiedsWithMode(list *List, mode NotifyMode) ([]string, error)
+	PostCounts(list *List, now time.Time) ([]PostCount, error)
 	PublicLists() ([]ListInfo, error)
 	Receivers(list *List) ([]string, error)
+	RemoveBlocked(list *List, patterns []string) ([]string, error) // list nil means the instance-wide blocklist
+	RemoveLastRun(job string) error
+	RemoveListTemplate(name string) error
 	RemoveKnowns(list *List, addrs []*Addr) ([]*mailutil.Addr, error)
 	RemoveMembers(list *List, addrs []*Addr) ([]*Addr, error)
-	Update(list *List, display string, publicSignup, hideFrom bool, actionMod, actionMember, actionKnown, actionUnknown Action) error
+	RemoveSublist(list, sublist *List) error
+	Rename(list *List, addr *Addr, keepAlias bool) error
+	SaveListTemplate(t *ListTemplate) error // replaces a template with the same name
+	SetLastRun(job string, t time.Time) error
+	SetTemplate(list *List, name, src string) error // empty src removes the override
+	Sublists(list *List) ([]ListInfo, error)        // directly included lists
+	Templates(list *List) ([]string, error)         // names of the overridden templates
+	Update(list *List, display string, publicSignup, hideFrom bool, actionMod, actionMember, actionKnown, actionUnknown, actionBlocked Action) error
+	UpdateFooter(list *List, plain, html string) error
+	UpdateHeaders(list *List, strip, static string) error
+	UpdateModeration(list *List, heldNotice bool, modExpiry int, expiryNotifySender, expiryNotifyMods bool) error
+	UpdatePrefix(list *List, prefix string, noPrefix, postNumbers bool) error
+	UpdateRateLimit(list *List, hour, day int, action Action) error
+	UpdateReplyTo(list *List, replyTo ReplyTo, rawAddress string, keep bool) error
+	UpdateAliases(list *List, aliases []*Addr) error
+	UpdateArchive(list *List, archive ArchiveAccess) error
+	UpdateDelivery(list *List, rawAddress string, delivery Delivery) error
 	UpdateMember(list *List, rawAddress string, receive, moderate, notify, admin, bounces bool) error
+	UpdateNotifyMode(list *List, rawAddress string, mode NotifyMode) error
 }
 
 type Logger interface {
@@ -56,6 +96,9 @@ type Logger interface {
 }
 
 type WebInterface interface {
+	ArchiveUrl(list *List) string
+	ArchivedMessageUrl(list *List, id int) string
+	AskJoinUrl(list *List) string
 	AskLeaveUrl(list *List) string
 	AuthenticationAvailable() bool
 	CheckbackJoinUrl(list *List, timestamp int64, hmac string, recipient *Addr) string
@@ -63,10 +106,13 @@ type WebInterface interface {
 	FooterHTML(list *List) string
 	FooterPlain(list *List) string
 	ListenAndServe() error
+	ListUrl(list *List) string
 	ModUrl(list *List) string
+	SettingsUrl(list *List) string
 }
 
 type Ulist struct {
+	Archive       ArchiveRepo // if nil, no messages are archived
 	DummyMode     bool
 	GDPRLogger    Logger
 	Lists         ListRepo
@@ -81,11 +127,25 @@ type Ulist struct {
 	Waiting   sync.WaitGroup
 }
 
-func (u *Ulist) isListOrBounce(addr mailutil.Addr) (bool, error) {
+// isListAddress returns whether addr is the address, an alias, the bounce address or the owner address of a list.
+func (u *Ulist) isListAddress(addr mailutil.Addr) (bool, error) {
 	addr.Local = strings.TrimSuffix(addr.Local, BounceAddressSuffix)
+	addr.Local = strings.TrimSuffix(addr.Local, OwnerAddressSuffix)
 	return u.Lists.IsList(addr)
 }
 
+// owners returns the addresses which receive messages to the owner address of the list: the admins of the list or, if there are none, the superadmin.
+func (u *Ulist) owners(list *List) ([]string, error) {
+	admins, err := u.Lists.Admins(list)
+	if err != nil {
+		return nil, err
+	}
+	if len(admins) == 0 && u.Superadmin != "" {
+		admins = []string{u.Superadmin}
+	}
+	return admins, nil
+}
+
 func (u *Ulist) ListenAndServe() error {
 
 	if u.MTA == nil {
@@ -112,7 +172,7 @@ func (u *Ulist) ListenAndServe() error {
 	// socketmap server
 
 	if u.SocketmapSock != "" {
-		sockmapSrv := sockmap.NewServer(u.isListOrBounce, u.LMTPSock)
+		sockmapSrv := sockmap.NewServer(u.isListAddress, u.LMTPSock)
 		defer sockmapSrv.Close()
 
 		sockmapListener, err := net.Listen("unix", u.SocketmapSock)
@@ -149,6 +209,16 @@ func (u *Ulist) ListenAndServe() error {
 		}
 	}
 
+	// background jobs
+
+	jobsDone := make(chan struct{})
+	defer close(jobsDone) // stops the jobs when the servers shut down
+
+	u.runPeriodically(jobsDone, time.Hour, u.expireAllModeratedMails)
+	u.runPeriodically(jobsDone, 5*time.Minute, u.sendAllModDigests)
+	u.runPeriodically(jobsDone, 5*time.Minute, u.sendAllDigests)
+	u.runPeriodically(jobsDone, time.Minute, u.sendAllScheduled)
+
 	// LMTP server
 
 	lmtpSrv := NewLMTPServer(u)
@@ -212,21 +282,36 @@ func (u *Ulist) Forward(list *List, m *mailutil.Message) error {
 	// don't modify the original header, create a copy instead
 
 	var header = make(mail.Header) // mail.Header has no Set method
+	var strip = list.StripHeaderKeys()
 	for key, vals := range m.Header {
 		if mailutil.IsSpamKey(key) {
 			continue // An email with a spam header is always moderated. Now that it is forwarded, we can be sure that it is not spam.
 		}
+		if !list.keepHeader(strip, key) {
+			continue // could reveal the sender
+		}
 		header[key] = vals
 	}
 
+	if list.HideFrom {
+		list.hideMessageIds(header)
+	}
+
 	// rewrite message
 	// Header keys use this notation: https://golang.org/pkg/net/textproto/#CanonicalMIMEHeaderKey
 
-	header["List-Id"] = []string{list.RFC5322NameAddr()}
-	header["List-Post"] = []string{list.RFC6068URI("")}                     // required for "Reply to list" button in Thunderbird
-	header["List-Unsubscribe"] = []string{list.RFC6068URI("subject=leave")} // GMail and Outlook show the unsubscribe button for senders with high reputation only
-	header["Message-Id"] = []string{list.NewMessageId()}                    // old Message-Id is not unique any more if the email is sent over more than one list
-	header["Subject"] = []string{list.PrefixSubject(header.Get("Subject"))}
+	u.setListHeaders(list, header)
+	header["Message-Id"] = []string{list.forwardedMessageId(m.Header.Get("Message-Id"))} // old Message-Id is not unique any more if the email is sent over more than one list
+
+	var postNumber int
+	if list.PostNumbers && !list.NoPrefix {
+		var err error
+		postNumber, err = u.Lists.PostNumber(list, header.Get("Message-Id"), time.Now()) // a message which the MTA delivers again keeps its number
+		if err != nil {
+			return err
+		}
+	}
+	header["Subject"] = []string{list.PrefixSubject(header.Get("Subject"), postNumber)}
 
 	// DKIM signatures usually sign at least "h=from:to:subject:date", so the signature becomes invalid when we change the "From" field and we should drop it. See RFC 6376 B.2.3.
 
@@ -234,18 +319,18 @@ func (u *Ulist) Forward(list *List, m *mailutil.Message) error {
 
 	// rewrite "From" because the original value would not pass the DKIM check
 
+	var oldFroms []*Addr
 	if list.HideFrom {
 		header["From"] = []string{list.RFC5322NameAddr()}
-		header["Reply-To"] = []string{} // defaults to From
+		header["To"] = []string{list.RFC5322NameAddr()} // the original "To" and "Cc" have been removed, as they could contain the sender
 	} else {
 
-		oldFroms, err := mailutil.ParseAddressesFromHeader(header, "From", 10)
+		var err error
+		oldFroms, err = mailutil.ParseAddressesFromHeader(header, "From", 10)
 		if err != nil {
 			return err
 		}
 
-		// From
-
 		froms := []string{}
 		for _, oldFrom := range oldFroms {
 			a := &Addr{}
@@ -255,22 +340,46 @@ func (u *Ulist) Forward(list *List, m *mailutil.Message) error {
 			froms = append(froms, a.RFC5322NameAddr())
 		}
 		header["From"] = []string{strings.Join(froms, ",")}
+	}
 
-		// Reply-To
-		// Without rewriting "From", "Reply-To" would default to the from addresses, so let's mimic that.
-		// If you use rspamd to filter outgoing mail, you should disable the Symbol "SPOOF_REPLYTO" in the "Symbols" menu, see https://github.com/rspamd/rspamd/issues/1891
+	// Reply-To
 
-		replyTo := []string{}
-		for _, oldFrom := range oldFroms {
-			replyTo = append(replyTo, oldFrom.RFC5322NameAddr())
-		}
+	if replyTo := list.replyTo(m.Header, oldFroms); len(replyTo) > 0 {
 		header["Reply-To"] = []string{mailutil.AddressList(replyTo)}
+	} else {
+		header["Reply-To"] = []string{} // defaults to From
 	}
 
 	// No "Sender" field required because there is exactly one "From" address. https://tools.ietf.org/html/rfc5322#section-3.6.2 "If the from field contains more than one mailbox specification in the mailbox-list, then the sender field, containing the field name "Sender" and a single mailbox specification, MUST appear in the message."
 
 	header["Sender"] = []string{}
 
+	for key, vals := range list.staticHeaders() {
+		header[key] = vals
+	}
+
+	// keep a copy for the archive and digest members, before InsertFooter modifies the header
+
+	var digestHeader = make(mail.Header, len(header))
+	for key, vals := range header {
+		digestHeader[key] = vals
+	}
+
+	if list.Archive != ArchiveOff && u.Archive != nil {
+		// a message which the MTA delivers again has the same Message-Id and has been archived before
+		if archived, err := u.Archive.IsArchived(list, header.Get("Message-Id")); err != nil {
+			log.Printf("error checking archive: %v", err)
+		} else if !archived {
+			if id, err := u.archive(list, header, m.Body, time.Now()); err == nil {
+				if u.Web != nil {
+					header["Archived-At"] = []string{"<" + u.Web.ArchivedMessageUrl(list, id) + ">"} // RFC 5064
+				}
+			} else {
+				log.Printf("error archiving message: %v", err)
+			}
+		}
+	}
+
 	// add footer
 
 	var bodyWithFooter = m.BodyReader()
@@ -286,11 +395,63 @@ func (u *Ulist) Forward(list *List, m *mailutil.Message) error {
 	// send emails
 
 	if recipients, err := u.Lists.Receivers(list); err == nil {
-		// Envelope-From is the list's bounce address. That's technically correct, plus else SPF would fail.
-		return u.MTA.Send(list.BounceAddress(), recipients, header, bodyWithFooter)
+		// skip if all members receive digests, because sendmail fails without recipients
+		if len(recipients) > 0 {
+			// Envelope-From is the list's bounce address. That's technically correct, plus else SPF would fail.
+			if err := u.MTA.Send(list.BounceAddress(), recipients, header, bodyWithFooter); err != nil {
+				return err
+			}
+		}
 	} else {
 		return err
 	}
+
+	// store for digest members after sending, so a retry of a failed message doesn't store it twice
+
+	if err := u.storeForDigest(list, digestHeader, m.Body); err != nil {
+		log.Printf("error storing message for digest: %v", err)
+	}
+
+	// count the message for the rate limits of the list, now that it has been sent
+
+	if froms, err := mailutil.ParseAddressesFromHeader(m.Header, "From", 10); err == nil {
+		if err := u.countPost(list, froms, time.Now()); err != nil {
+			log.Printf("error counting message for the rate limits: %v", err)
+		}
+	}
+
+	return nil
+}
+
+// setListHeaders sets the list header fields of RFC 2369 and RFC 2919.
+func (u *Ulist) setListHeaders(list *List, header mail.Header) {
+
+	owner := list.Addr
+	owner.Display = ""
+	owner.Local += OwnerAddressSuffix // reaches the admins
+
+	help := owner.RFC6068URI("subject=help")
+	subscribe := []string{list.RFC6068URI("subject=join")}
+	unsubscribe := []string{list.RFC6068URI("subject=leave")} // GMail and Outlook show the unsubscribe button for senders with high reputation only
+
+	if u.Web != nil {
+		help = "<" + u.Web.ListUrl(list) + ">"
+		subscribe = append(subscribe, "<"+u.Web.AskJoinUrl(list)+">")
+		unsubscribe = append(unsubscribe, "<"+u.Web.AskLeaveUrl(list)+">")
+		if list.Archive != ArchiveOff {
+			header["List-Archive"] = []string{"<" + u.Web.ArchiveUrl(list) + ">"}
+		}
+	}
+
+	header["List-Help"] = []string{help}
+	header["List-Id"] = []string{list.RFC2919ListIdField()}
+	header["List-Owner"] = []string{owner.RFC6068URI("")}
+	header["List-Post"] = []string{list.RFC6068URI("")} // required for "Reply to list" button in Thunderbird
+	if list.PublicSignup {
+		header["List-Subscribe"] = []string{strings.Join(subscribe, ", ")}
+	}
+	header["List-Unsubscribe"] = []string{strings.Join(unsubscribe, ", ")}
+	header["Precedence"] = []string{"list"}
 }
 
 func (u *Ulist) StorageFolder(li ListInfo) string {
@@ -349,7 +510,7 @@ func (u *Ulist) NotifyMods(list *List, mods []string) error {
 		ModHref:      modUrl,
 	}
 
-	if err := txt.NotifyMods.Execute(body, data); err != nil {
+	if err := u.executeTemplate(list, txt.NotifyMods, body, data); err != nil {
 		return err
 	}
 
@@ -364,6 +525,102 @@ func (u *Ulist) NotifyMods(list *List, mods []string) error {
 	return lastErr
 }
 
+// NotifyHeldSender tells the sender of a message that it is waiting for moderation, so they don't send it again. Each sender gets at most one notice per list and day.
+func (u *Ulist) NotifyHeldSender(list *List, header mail.Header) error {
+
+	// check this before rate limiting, so spam or an automatic message doesn't use up the notice of the sender
+	from, ok, err := u.autoReplyRecipient(header)
+	if !ok || err != nil {
+		return err
+	}
+
+	// rate limiting
+
+	var key = rateLimitKey{from.RFC5322AddrSpec(), list.RFC5322AddrSpec()}
+
+	sentHeldNoticesLock.Lock()
+	if lastSentTimestamp, ok := sentHeldNotices[key]; ok && lastSentTimestamp > time.Now().AddDate(0, 0, -1).Unix() {
+		sentHeldNoticesLock.Unlock()
+		return nil
+	}
+	sentHeldNotices[key] = time.Now().Unix() // set before sending, so concurrent sessions don't send it twice
+	sentHeldNoticesLock.Unlock()
+
+	// render template
+
+	body := &bytes.Buffer{}
+	data := txt.HeldNoticeData{
+		ListAddress: list.RFC5322AddrSpec(),
+		Subject:     mailutil.RobustWordDecode(header.Get("Subject")),
+	}
+
+	err = txt.HeldNotice.Execute(body, data)
+	if err == nil {
+		ok, err = u.autoReply(list, header, "Your message is waiting for moderation", body)
+	}
+	if !ok || err != nil {
+		// no notice has been sent, so the next held message of the sender may get one
+		sentHeldNoticesLock.Lock()
+		delete(sentHeldNotices, key)
+		sentHeldNoticesLock.Unlock()
+	}
+	return err
+}
+
+// autoReply sends an automatic reply (RFC 3834) to the single "From" address of a message.
+//
+// In order to prevent backscatter, nothing is sent if the message has a positive spam header, or if it looks like an automatic message or a bounce. The returned bool value indicates whether the email was sent.
+func (u *Ulist) autoReply(list *List, header mail.Header, subject string, body io.Reader) (bool, error) {
+
+	from, ok, err := u.autoReplyRecipient(header)
+	if !ok || err != nil {
+		return false, err
+	}
+
+	replyHeader := make(mail.Header)
+	replyHeader["Auto-Submitted"] = []string{"auto-replied"}
+	replyHeader["Content-Type"] = []string{"text/plain; charset=utf-8"}
+	replyHeader["From"] = []string{list.RFC5322NameAddr()}
+	replyHeader["Message-Id"] = []string{list.NewMessageId()}
+	replyHeader["Subject"] = []string{"[" + list.DisplayOrLocal() + "] " + subject}
+	replyHeader["To"] = []string{from.RFC5322AddrSpec()}
+	if messageId := header.Get("Message-Id"); messageId != "" {
+		replyHeader["In-Reply-To"] = []string{messageId}
+		replyHeader["References"] = []string{messageId}
+	}
+
+	// RFC 3834 3.3: "the MAIL FROM address in the SMTP envelope SHOULD be set to the null address", so the reply can't cause a bounce loop
+	return true, u.MTA.Send("", []string{from.RFC5322AddrSpec()}, replyHeader, body)
+}
+
+// autoReplyRecipient returns the single "From" address of a message, and whether autoReply would send a reply to it.
+func (u *Ulist) autoReplyRecipient(header mail.Header) (*Addr, bool, error) {
+
+	if isSpam, _ := mailutil.IsSpam(header); isSpam {
+		return nil, false, nil
+	}
+
+	if isAuto, _ := mailutil.IsAutoSubmitted(header); isAuto {
+		return nil, false, nil
+	}
+
+	from, ok := mailutil.SingleFrom(header)
+	if !ok {
+		return nil, false, nil
+	}
+
+	switch strings.ToLower(from.Local) {
+	case "mailer-daemon", "postmaster":
+		return nil, false, nil
+	}
+
+	if isList, err := u.isListAddress(*from); isList || err != nil {
+		return nil, false, err // don't reply to a mailing list
+	}
+
+	return from, true, nil
+}
+
 func (u *Ulist) SignoffJoinMessage(list *List, member *Addr) (*bytes.Buffer, error) {
 
 	var footer string
@@ -372,7 +629,7 @@ func (u *Ulist) SignoffJoinMessage(list *List, member *Addr) (*bytes.Buffer, err
 	}
 
 	var buf = &bytes.Buffer{}
-	var err = txt.SignoffJoin.Execute(buf, txt.SignoffJoinData{
+	var err = u.executeTemplate(list, txt.SignoffJoin, buf, txt.SignoffJoinData{
 		Footer:      footer,
 		ListAddress: list.RFC5322AddrSpec(),
 		MailAddress: member.RFC5322AddrSpec(),
@@ -431,18 +688,7 @@ func (u *Ulist) AddMembers(list *List, sendWelcome bool, addrs []*Addr, receive,
 }
 
 func (u *Ulist) CreateList(address, name, rawAdminMods string, reason string) (*List, int, []error) {
-	adminMods, errs := mailutil.ParseAddresses(rawAdminMods, WebBatchLimit)
-	if len(errs) > 0 {
-		return nil, 0, []error{fmt.Errorf("parsing %d email addresses", len(errs))}
-	}
-
-	list, err := u.Lists.Create(address, name)
-	if err != nil {
-		return nil, 0, []error{err}
-	}
-
-	added, errs := u.AddMembers(list, true, adminMods, true, true, true, true, true, reason)
-	return list, added, errs
+	return u.CreateListFromTemplate(address, name, rawAdminMods, nil, reason)
 }
 
 func (u *Ulist) RemoveMembers(list *List, sendGoodbye bool, addrs []*Addr, reason string) (int, []error) {
@@ -451,7 +697,7 @@ func (u *Ulist) RemoveMembers(list *List, sendGoodbye bool, addrs []*Addr, reaso
 	var goodbyeBody []byte
 	var err error
 	if sendGoodbye {
-		goodbyeBody, err = list.SignoffLeaveMessage()
+		goodbyeBody, err = u.SignoffLeaveMessage(list)
 		if err != nil {
 			return 0, []error{fmt.Errorf("executing email template: %w", err)}
 		}
@@ -0,0 +1,108 @@
+package web
+
+import (
+	"errors"
+	htmltemplate "html/template"
+	"log"
+	"strings"
+	texttemplate "text/template"
+
+	"github.com/wansing/ulist"
+)
+
+// maxFooterLength limits the size of footer templates, footers are appended to every message.
+const maxFooterLength = 4000
+
+const (
+	DefaultFooterPlain = `You can leave the mailing list "{{ .ListName }}" here: {{ .LeaveURL }}`
+	DefaultFooterHTML  = `<span style="font-size: 9pt;">You can leave the mailing list "{{ .ListName }}" <a href="{{ .LeaveURL }}">here</a>.</span>`
+)
+
+// FooterData contains the variables which can be used in footer templates.
+type FooterData struct {
+	ListName     string // display-name or local-part
+	ListAddress  string
+	LeaveURL     string
+	ArchiveURL   string // empty if the list has no archive
+	AdminContact string // owner address, reaches the admins
+}
+
+func (web Web) footerData(list *ulist.List) FooterData {
+	data := FooterData{
+		ListName:     list.DisplayOrLocal(),
+		ListAddress:  list.RFC5322AddrSpec(),
+		LeaveURL:     web.AskLeaveUrl(list),
+		AdminContact: list.OwnerAddress(),
+	}
+	if list.Archive != ulist.ArchiveOff {
+		data.ArchiveURL = web.ArchiveUrl(list)
+	}
+	return data
+}
+
+func (web Web) FooterHTML(list *ulist.List) string {
+	footer, err := renderFooterHTML(list.FooterHTML, web.footerData(list))
+	if err != nil {
+		log.Printf("error rendering html footer of %s, using default: %v", list, err)
+		footer, _ = renderFooterHTML("", web.footerData(list))
+	}
+	return footer
+}
+
+func (web Web) FooterPlain(list *ulist.List) string {
+	footer, err := renderFooterPlain(list.FooterPlain, web.footerData(list))
+	if err != nil {
+		log.Printf("error rendering plain footer of %s, using default: %v", list, err)
+		footer, _ = renderFooterPlain("", web.footerData(list))
+	}
+	return footer
+}
+
+// renderFooterHTML executes the template with html/template, so variables are escaped. An empty template means the default.
+func renderFooterHTML(tmpl string, data FooterData) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultFooterHTML
+	}
+	t, err := htmltemplate.New("footer").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// renderFooterPlain executes the template with text/template. An empty template means the default.
+func renderFooterPlain(tmpl string, data FooterData) (string, error) {
+	if tmpl == "" {
+		tmpl = DefaultFooterPlain
+	}
+	t, err := texttemplate.New("footer").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", err
+	}
+	var b strings.Builder
+	if err := t.Execute(&b, data); err != nil {
+		return "", err
+	}
+	return b.String(), nil
+}
+
+// checkFooters validates the footer templates by rendering them for the list.
+func (web Web) checkFooters(list *ulist.List, plain, html string) (renderedPlain, renderedHTML string, err error) {
+	if len(plain) > maxFooterLength || len(html) > maxFooterLength {
+		return "", "", errors.New("footer is too long")
+	}
+	data := web.footerData(list)
+	renderedPlain, err = renderFooterPlain(plain, data)
+	if err != nil {
+		return "", "", err
+	}
+	renderedHTML, err = renderFooterHTML(html, data)
+	if err != nil {
+		return "", "", err
+	}
+	return renderedPlain, renderedHTML, nil
+}
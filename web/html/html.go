@@ -2,6 +2,7 @@ package html
 
 import (
 	"embed"
+	"fmt"
 	"html/template"
 	"net/mail"
 	"net/url"
@@ -10,6 +11,7 @@ import (
 
 	"github.com/wansing/ulist"
 	"github.com/wansing/ulist/mailutil"
+	"github.com/wansing/ulist/txt"
 	"github.com/wansing/ulist/web/captcha"
 )
 
@@ -21,6 +23,22 @@ func parse(fn string) *template.Template {
 		template.FuncMap{
 			"ActiveTab": func(tab string, data interface{}) bool {
 				switch data.(type) {
+				case ArchiveData:
+					return tab == "archive"
+				case ArchiveMessageData:
+					return tab == "archive"
+				case ArchiveMonthData:
+					return tab == "archive"
+				case ArchiveThreadData:
+					return tab == "archive"
+				case AuditData:
+					return tab == "audit"
+				case BlocklistData:
+					return tab == "blocklist"
+				case ComposeData:
+					return tab == "compose"
+				case EditData:
+					return tab == "mod"
 				case KnownsData:
 					return tab == "knowns"
 				case LeaveData:
@@ -31,10 +49,16 @@ func parse(fn string) *template.Template {
 					return tab == "members"
 				case *MembersAddRemoveStagingData:
 					return tab == "members"
+				case MembersListsData:
+					return tab == "members"
 				case ModData:
 					return tab == "mod"
+				case PreviewData:
+					return tab == "mod"
 				case SettingsData:
 					return tab == "settings"
+				case TemplatesData:
+					return tab == "templates"
 				default:
 					return false
 				}
@@ -47,7 +71,12 @@ func parse(fn string) *template.Template {
 				}
 				return len(entries)
 			},
+			"ArchiveAccesses":  func() []ulist.ArchiveAccess { return ulist.ArchiveAccesses },
+			"ReplyTos":         func() []ulist.ReplyTo { return ulist.ReplyTos },
+			"StripDefaults":    func() string { return strings.Join(ulist.DefaultStripHeaders, "\n") },
 			"CreateCaptcha":    captcha.Create,
+			"NotifyModes":      func() []ulist.NotifyMode { return ulist.NotifyModes },
+			"Deliveries":       func() []ulist.Delivery { return ulist.Deliveries },
 			"PathEscape":       url.PathEscape,
 			"RobustWordDecode": mailutil.RobustWordDecode,
 		},
@@ -56,8 +85,16 @@ func parse(fn string) *template.Template {
 
 var (
 	All                  = parse("all.html")
+	Archive              = parse("archive.html")
+	ArchiveMessage       = parse("archive-message.html")
+	ArchiveMonth         = parse("archive-month.html")
+	ArchiveThread        = parse("archive-thread.html")
+	Audit                = parse("audit.html")
+	Blocklist            = parse("blocklist.html")
+	Compose              = parse("compose.html")
 	Create               = parse("create.html")
 	Delete               = parse("delete.html")
+	Edit                 = parse("edit.html")
 	Error                = parse("error.html")
 	JoinAsk              = parse("join-ask.html")
 	JoinConfirm          = parse("join-confirm.html")
@@ -66,16 +103,22 @@ var (
 	Leave                = parse("leave.html")
 	LeaveAsk             = parse("leave-ask.html")
 	LeaveConfirm         = parse("leave-confirm.html")
+	ListTemplates        = parse("list-templates.html")
 	Member               = parse("member.html")
 	Members              = parse("members.html")
 	MembersAdd           = parse("members-add.html")
 	MembersAddStaging    = parse("members-add-staging.html")
+	MembersLists         = parse("members-lists.html")
 	MembersRemove        = parse("members-remove.html")
 	MembersRemoveStaging = parse("members-remove-staging.html")
 	Mod                  = parse("mod.html")
 	My                   = parse("my.html")
+	Preview              = parse("preview.html")
 	Public               = parse("public.html")
+	Rename               = parse("rename.html")
+	Search               = parse("search.html")
 	Settings             = parse("settings.html")
+	Templates            = parse("templates.html")
 )
 
 type AllData struct {
@@ -83,10 +126,86 @@ type AllData struct {
 	StorageFolderer interface{ StorageFolder(ulist.ListInfo) string }
 }
 
+type ArchiveData struct {
+	Auth   ulist.Membership
+	List   *ulist.List
+	Months []ulist.ArchiveMonth
+}
+
+type ArchiveMessageData struct {
+	Auth        ulist.Membership
+	List        *ulist.List
+	Message     *ulist.ArchivedMessage
+	Text        string
+	HTML        string // sanitized
+	Attachments []PreviewAttachment
+}
+
+type ArchiveMonthData struct {
+	Auth     ulist.Membership
+	List     *ulist.List
+	Month    ulist.ArchiveMonth
+	Messages []ulist.ArchivedMessage
+}
+
+type ArchiveThreadData struct {
+	Auth     ulist.Membership
+	List     *ulist.List
+	Messages []ArchivedText
+}
+
+type ArchivedText struct {
+	ulist.ArchivedMessage
+	Text string // empty if the message has no text/plain part
+}
+
+type AuditData struct {
+	Auth      ulist.Membership
+	List      *ulist.List
+	Entries   []ulist.AuditEntry
+	Page      int
+	PageLinks []PageLink
+}
+
+type BlocklistData struct {
+	Auth    ulist.Membership
+	List    *ulist.List // nil means the instance-wide blocklist
+	Blocked []string
+}
+
+type ComposeData struct {
+	Auth      ulist.Membership
+	List      *ulist.List
+	User      *ulist.Addr
+	Subject   string
+	Text      string
+	SendAt    string // value of a datetime-local input
+	Scheduled []ulist.ScheduledPost
+}
+
 type CreateData struct {
-	Address   string
-	Name      string
-	AdminMods string
+	Address     string
+	Name        string
+	AdminMods   string
+	Template    string // name of a list template
+	Clone       string // address of a list
+	CopyKnowns  bool
+	CopyMembers bool
+	Templates   []string
+}
+
+type ListTemplatesData struct {
+	Templates []string
+}
+
+type EditData struct {
+	Auth     ulist.Membership
+	List     *ulist.List
+	Filename string
+	Subject  string
+	HasText  bool
+	Text     string
+	Parts    []PreviewAttachment // removable parts
 }
 
 type JoinAskData struct {
@@ -137,6 +256,12 @@ type MembersData struct {
 	Members []ulist.Membership
 }
 
+type MembersListsData struct {
+	Auth     ulist.Membership
+	List     *ulist.List
+	Sublists []ulist.ListInfo
+}
+
 type MembersAddRemoveData struct {
 	Auth  ulist.Membership
 	List  *ulist.List
@@ -159,6 +284,11 @@ type ModData struct {
 	Page      int
 	PageLinks []PageLink
 	Messages  []StoredMessage
+	Query     string     // query string including "?", or empty
+	Filter    url.Values // raw filter input
+	Filtered  bool
+	Matching  int // number of messages which match the filter
+	Counters  []ulist.PostCount
 }
 
 type MyData struct {
@@ -171,14 +301,82 @@ type PageLink struct {
 	Url  string
 }
 
+type PreviewData struct {
+	Auth        ulist.Membership
+	List        *ulist.List
+	Filename    string
+	Header      mail.Header
+	Text        string
+	HTML        string // sanitized
+	Attachments []PreviewAttachment
+}
+
+type PreviewAttachment struct {
+	Index     int // index in the leaves of the MIME tree
+	Filename  string
+	MediaType string
+	Size      int
+}
+
+func (a PreviewAttachment) SizeString() string {
+	switch {
+	case a.Size >= 1024*1024:
+		return fmt.Sprintf("%.1f MB", float64(a.Size)/1024/1024)
+	case a.Size >= 1024:
+		return fmt.Sprintf("%.1f kB", float64(a.Size)/1024)
+	default:
+		return fmt.Sprintf("%d bytes", a.Size)
+	}
+}
+
 type PublicData struct {
 	PublicLists []ulist.ListInfo
 	MyLists     map[string]interface{}
 }
 
+type SearchData struct {
+	Lists    []ulist.ListInfo // lists whose archive can be searched
+	Names    map[int]string   // list id -> address, for results
+	Input    url.Values       // raw form input
+	Limit    int
+	Searched bool
+	Results  []ulist.ArchiveSearchResult
+}
+
+type RenameData struct {
+	List      *ulist.List
+	Address   string
+	KeepAlias bool
+}
+
 type SettingsData struct {
-	Auth ulist.Membership
-	List *ulist.List
+	Auth       ulist.Membership
+	List       *ulist.List
+	Aliases    []*ulist.Addr
+	Footer     FooterForm
+	Superadmin bool // can rename the list
+}
+
+// TemplatesData lists the notification templates which can be overridden. If Current is not nil, it is edited.
+type TemplatesData struct {
+	Auth         ulist.Membership
+	List         *ulist.List
+	Overridables []txt.Overridable
+	Overridden   map[string]bool // key: template name
+	Current      *txt.Overridable
+	Src          string
+	Preview      string // empty if there is no preview
+}
+
+// FooterForm contains the footer templates, either stored or from user input, and optionally their preview.
+type FooterForm struct {
+	Plain        string
+	HTML         string
+	DefaultPlain string
+	DefaultHTML  string
+	Preview      bool
+	PreviewPlain string
+	PreviewHTML  string // sanitized
 }
 
 type StoredMessage struct {
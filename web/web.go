@@ -4,6 +4,7 @@ package web
 // Else just return an error, and the middleware will show an error template.
 
 import (
+	"bytes"
 	"encoding/base64"
 	"encoding/gob"
 	"errors"
@@ -12,8 +13,10 @@ import (
 	"io"
 	"log"
 	"math"
+	"mime"
 	"net"
 	"net/http"
+	"net/mail"
 	"net/url"
 	"os"
 	"sort"
@@ -25,6 +28,7 @@ import (
 	"github.com/julienschmidt/httprouter"
 	"github.com/wansing/ulist"
 	"github.com/wansing/ulist/mailutil"
+	"github.com/wansing/ulist/txt"
 	"github.com/wansing/ulist/web/captcha"
 	"github.com/wansing/ulist/web/html"
 	"github.com/wansing/ulist/web/static"
@@ -35,6 +39,13 @@ var ErrNoList = errors.New("no list or list error") // generic error so we don't
 var ErrNoMember = errors.New("you are not a member of this list")
 var ErrUnauthorized = errors.New("unauthorized")
 
+const auditPerPage = 50
+const searchLimit = 50
+
+const maxTemplateLength = 10000
+
+// maxComposeSize limits the size of messages which are composed in the web interface, including attachments.
+const maxComposeSize = 25 * 1024 * 1024
 const modPerPage = 10
 
 var sessionManager *scs.SessionManager
@@ -130,6 +141,18 @@ type Web struct {
 	UserRepos []UserRepo // repos are queried in the given order
 }
 
+func (web Web) ArchiveUrl(list *ulist.List) string {
+	return fmt.Sprintf("%s/archive/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()))
+}
+
+func (web Web) ArchivedMessageUrl(list *ulist.List, id int) string {
+	return fmt.Sprintf("%s/message/%s/%d", web.URL, url.PathEscape(list.RFC5322AddrSpec()), id)
+}
+
+func (web Web) AskJoinUrl(list *ulist.List) string {
+	return fmt.Sprintf("%s/join/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()))
+}
+
 func (web Web) AskLeaveUrl(list *ulist.List) string {
 	return fmt.Sprintf("%s/leave/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()))
 }
@@ -142,16 +165,16 @@ func (web Web) CheckbackLeaveUrl(list *ulist.List, timestamp int64, hmac string,
 	return fmt.Sprintf("%s/leave/%s/%d/%s/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()), timestamp, hmac, url.PathEscape(recipient.RFC5322AddrSpec()))
 }
 
-func (web Web) ModUrl(list *ulist.List) string {
-	return fmt.Sprintf("%s/mod/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()))
+func (web Web) ListUrl(list *ulist.List) string {
+	return fmt.Sprintf("%s/list/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()))
 }
 
-func (web Web) FooterHTML(list *ulist.List) string {
-	return fmt.Sprintf(`<span style="font-size: 9pt;">You can leave the mailing list "%s" <a href="%s">here</a>.</span>`, list.DisplayOrLocal(), web.AskLeaveUrl(list))
+func (web Web) ModUrl(list *ulist.List) string {
+	return fmt.Sprintf("%s/mod/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()))
 }
 
-func (web Web) FooterPlain(list *ulist.List) string {
-	return fmt.Sprintf(`You can leave the mailing list "%s" here: %s`, list.DisplayOrLocal(), web.AskLeaveUrl(list))
+func (web Web) SettingsUrl(list *ulist.List) string {
+	return fmt.Sprintf("%s/settings/%s", web.URL, url.PathEscape(list.RFC5322AddrSpec()))
 }
 
 // if f returns err, it must not execute a template or redirect
@@ -285,23 +308,45 @@ func (w Web) newServer() *http.Server {
 
 	// superadmin
 	router.GET("/all", w.middleware(true, w.all))
+	getAndPost("/blocklist", w.middleware(true, w.blocklist))
 	getAndPost("/create", w.middleware(true, w.create))
+	getAndPost("/list-templates", w.middleware(true, w.listTemplates))
 
 	// admins
 	getAndPost("/delete/:list", w.middleware(true, w.loadList(w.requireAdminPermission(w.delete))))
+	getAndPost("/rename/:list", w.middleware(true, w.loadList(w.rename)))
 	router.GET("/members/:list", w.middleware(true, w.loadList(w.requireAdminPermission(w.members))))
 	getAndPost("/members/:list/add", w.middleware(true, w.loadList(w.requireAdminPermission(w.membersAdd))))
 	router.POST("/members/:list/add/staging", w.middleware(true, w.loadList(w.requireAdminPermission(w.membersAddStagingPost))))
 	getAndPost("/members/:list/remove", w.middleware(true, w.loadList(w.requireAdminPermission(w.membersRemove))))
+	getAndPost("/members/:list/lists", w.middleware(true, w.loadList(w.requireAdminPermission(w.membersLists))))
 	router.POST("/members/:list/remove/staging", w.middleware(true, w.loadList(w.requireAdminPermission(w.membersRemoveStagingPost))))
 	getAndPost("/member/:list/:email", w.middleware(true, w.loadList(w.requireAdminPermission(w.member))))
 	getAndPost("/settings/:list", w.middleware(true, w.loadList(w.requireAdminPermission(w.settings))))
+	router.GET("/templates/:list", w.middleware(true, w.loadList(w.requireAdminPermission(w.templates))))
+	getAndPost("/templates/:list/:name", w.middleware(true, w.loadList(w.requireAdminPermission(w.templates))))
+	router.GET("/audit/:list", w.middleware(true, w.loadList(w.requireAdminPermission(w.audit))))
+	router.GET("/audit/:list/:page", w.middleware(true, w.loadList(w.requireAdminPermission(w.audit))))
+	router.GET("/export/:list", w.middleware(true, w.loadList(w.requireAdminPermission(w.exportArchive))))
 
 	// moderators
-	getAndPost("/knowns/:list", w.middleware(true, w.loadList(w.requireModPermission(w.knowns))))
-	getAndPost("/mod/:list", w.middleware(true, w.loadList(w.requireModPermission(w.mod))))
-	getAndPost("/mod/:list/:page", w.middleware(true, w.loadList(w.requireModPermission(w.mod))))
-	router.GET("/view/:list/:emlfilename", w.middleware(true, w.loadList(w.requireModPermission(w.view))))
+	getAndPost("/blocklist/:list", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.listBlocklist))))
+	getAndPost("/compose/:list", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.compose))))
+	getAndPost("/knowns/:list", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.knowns))))
+	getAndPost("/mod/:list", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.mod))))
+	getAndPost("/mod/:list/:page", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.mod))))
+	router.GET("/view/:list/:emlfilename", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.view))))
+	getAndPost("/edit/:list/:emlfilename", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.edit))))
+	router.GET("/preview/:list/:emlfilename", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.preview))))
+	router.GET("/preview/:list/:emlfilename/:part", w.middleware(true, w.loadList(w.requireModOrAdminPermission(w.previewPart))))
+
+	// archive, access depends on the list settings
+	router.GET("/search", w.middleware(false, w.search))
+	router.GET("/archive/:list", w.middleware(false, w.loadList(w.requireArchiveAccess(w.archive))))
+	router.GET("/archive/:list/:month", w.middleware(false, w.loadList(w.requireArchiveAccess(w.archiveMonth))))
+	router.GET("/thread/:list/:id", w.middleware(false, w.loadList(w.requireArchiveAccess(w.archiveThread))))
+	router.GET("/message/:list/:id", w.middleware(false, w.loadList(w.requireArchiveAccess(w.archiveMessage))))
+	router.GET("/message/:list/:id/:part", w.middleware(false, w.loadList(w.requireArchiveAccess(w.archivePart))))
 
 	return &http.Server{
 		Handler:      sessionManager.LoadAndSave(router),
@@ -330,6 +375,24 @@ func (w Web) loadList(f func(*Context, *ulist.List) error) func(*Context) error
 	}
 }
 
+// getList parses the address and returns the list. Unlike loadList, the error reveals whether the list exists, so it should be shown to superadmins only.
+func (w Web) getList(rawAddress string) (*ulist.List, error) {
+
+	listAddr, err := mailutil.ParseAddress(rawAddress)
+	if err != nil {
+		return nil, err
+	}
+
+	list, err := w.Ulist.Lists.GetList(listAddr)
+	if err != nil {
+		return nil, err
+	}
+	if list == nil {
+		return nil, fmt.Errorf("list not found: %s", listAddr)
+	}
+	return list, nil
+}
+
 func (w Web) requireAdminPermission(f func(*Context, *ulist.List) error) func(*Context, *ulist.List) error {
 	return func(ctx *Context, list *ulist.List) error {
 		if m, _ := w.getMembershipOfAuthUser(list, ctx.User); m.Admin {
@@ -340,7 +403,7 @@ func (w Web) requireAdminPermission(f func(*Context, *ulist.List) error) func(*C
 	}
 }
 
-func (w Web) requireModPermission(f func(*Context, *ulist.List) error) func(*Context, *ulist.List) error {
+func (w Web) requireModOrAdminPermission(f func(*Context, *ulist.List) error) func(*Context, *ulist.List) error {
 	return func(ctx *Context, list *ulist.List) error {
 		if m, _ := w.getMembershipOfAuthUser(list, ctx.User); m.Admin || m.Moderate {
 			return f(ctx, list)
@@ -434,6 +497,19 @@ func (w Web) logout(ctx *Context) error {
 
 func (w Web) settings(ctx *Context, list *ulist.List) error {
 
+	if ctx.r.Method == http.MethodPost && ctx.r.PostFormValue("footer") != "" {
+		return w.settingsFooter(ctx, list)
+	}
+
+	if ctx.r.Method == http.MethodPost && ctx.r.PostFormValue("announce") != "" {
+		if err := w.Ulist.SetAnnounceOnly(list, strings.TrimSpace(ctx.r.PostFormValue("announce_reply_to"))); err != nil {
+			return err
+		}
+		ctx.Successf("%s is an announce-only list now.", list)
+		ctx.Redirect("/settings/%s", url.PathEscape(list.RFC5322AddrSpec()))
+		return nil
+	}
+
 	if ctx.r.Method == http.MethodPost {
 
 		actionMod, err := ulist.ParseAction(ctx.r.PostFormValue("action_mod"))
@@ -456,6 +532,11 @@ func (w Web) settings(ctx *Context, list *ulist.List) error {
 			return err
 		}
 
+		actionBlocked, err := ulist.ParseAction(ctx.r.PostFormValue("action_blocked"))
+		if err != nil {
+			return err
+		}
+
 		if err := w.Ulist.Lists.Update(
 			list,
 			ctx.r.PostFormValue("name"),
@@ -465,6 +546,90 @@ func (w Web) settings(ctx *Context, list *ulist.List) error {
 			actionMember,
 			actionKnown,
 			actionUnknown,
+			actionBlocked,
+		); err != nil {
+			return err
+		}
+
+		modExpiry, err := strconv.Atoi(ctx.r.PostFormValue("mod_expiry"))
+		if err != nil {
+			return err
+		}
+
+		archive, err := ulist.ParseArchiveAccess(ctx.r.PostFormValue("archive"))
+		if err != nil {
+			return err
+		}
+
+		if err := w.Ulist.Lists.UpdateArchive(list, archive); err != nil {
+			return err
+		}
+
+		aliases, errs := mailutil.ParseAddresses(ctx.r.PostFormValue("aliases"), ulist.WebBatchLimit)
+		if len(errs) > 0 {
+			return errs[0]
+		}
+
+		if err := w.Ulist.Lists.UpdateAliases(list, aliases); err != nil {
+			return err
+		}
+
+		if err := w.Ulist.Lists.UpdatePrefix(
+			list,
+			ctx.r.PostFormValue("prefix"),
+			ctx.r.PostFormValue("no_prefix") != "",
+			ctx.r.PostFormValue("post_numbers") != "",
+		); err != nil {
+			return err
+		}
+
+		replyTo, err := ulist.ParseReplyTo(ctx.r.PostFormValue("reply_to"))
+		if err != nil {
+			return err
+		}
+
+		if err := w.Ulist.Lists.UpdateReplyTo(
+			list,
+			replyTo,
+			strings.TrimSpace(ctx.r.PostFormValue("reply_to_address")),
+			ctx.r.PostFormValue("keep_reply_to") != "",
+		); err != nil {
+			return err
+		}
+
+		if err := w.Ulist.Lists.UpdateHeaders(
+			list,
+			ctx.r.PostFormValue("strip_headers"),
+			ctx.r.PostFormValue("static_headers"),
+		); err != nil {
+			return err
+		}
+
+		rateLimitHour, err := strconv.Atoi(ctx.r.PostFormValue("rate_limit_hour"))
+		if err != nil {
+			return err
+		}
+
+		rateLimitDay, err := strconv.Atoi(ctx.r.PostFormValue("rate_limit_day"))
+		if err != nil {
+			return err
+		}
+
+		rateLimitAction, err := ulist.ParseAction(ctx.r.PostFormValue("rate_limit_action"))
+		if err != nil {
+			return err
+		}
+
+		if err := w.Ulist.Lists.UpdateRateLimit(list, rateLimitHour, rateLimitDay, rateLimitAction); err != nil {
+			return err
+		}
+
+		if err := w.Ulist.Lists.UpdateModeration(
+			list,
+			ctx.r.PostFormValue("held_notice") != "",
+			modExpiry,
+			ctx.r.PostFormValue("expiry_notify_sender") != "",
+			ctx.r.PostFormValue("expiry_notify_mods") != "",
 		); err != nil {
 			return err
 		}
@@ -474,17 +639,149 @@ func (w Web) settings(ctx *Context, list *ulist.List) error {
 		return nil
 	}
 
+	return w.executeSettings(ctx, list, html.FooterForm{
+		Plain:        list.FooterPlain,
+		HTML:         list.FooterHTML,
+		DefaultPlain: DefaultFooterPlain,
+		DefaultHTML:  DefaultFooterHTML,
+	})
+}
+
+func (w Web) executeSettings(ctx *Context, list *ulist.List, footer html.FooterForm) error {
+
 	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
 	if err != nil {
 		return err
 	}
 
+	aliases, err := w.Ulist.Lists.Aliases(list)
+	if err != nil {
+		return err
+	}
+
 	return ctx.Execute(html.Settings, html.SettingsData{
-		Auth: auth,
-		List: list,
+		Auth:       auth,
+		List:       list,
+		Aliases:    aliases,
+		Footer:     footer,
+		Superadmin: w.isSuperadmin(ctx.User),
 	})
 }
 
+// settingsFooter validates the footer templates and saves them or shows a preview
+func (w Web) settingsFooter(ctx *Context, list *ulist.List) error {
+
+	form := html.FooterForm{
+		Plain:        strings.TrimSpace(ctx.r.PostFormValue("footer_plain")),
+		HTML:         strings.TrimSpace(ctx.r.PostFormValue("footer_html")),
+		DefaultPlain: DefaultFooterPlain,
+		DefaultHTML:  DefaultFooterHTML,
+	}
+
+	renderedPlain, renderedHTML, err := w.checkFooters(list, form.Plain, form.HTML)
+	if err != nil {
+		ctx.Alertf("The footer has not been saved: %v", err)
+	} else if ctx.r.PostFormValue("footer") == "save" {
+		if err := w.Ulist.Lists.UpdateFooter(list, form.Plain, form.HTML); err != nil {
+			return err
+		}
+		ctx.Successf("The footer of %s has been saved.", list)
+		ctx.Redirect("/settings/%s", url.PathEscape(list.RFC5322AddrSpec()))
+		return nil
+	} else {
+		form.Preview = true
+		form.PreviewPlain = renderedPlain
+		form.PreviewHTML = mailutil.SanitizeHTML(renderedHTML, func(string) (string, bool) { return "", false })
+	}
+
+	return w.executeSettings(ctx, list, form)
+}
+
+// templates lists the notification templates which can be overridden, or edits one of them
+func (w Web) templates(ctx *Context, list *ulist.List) error {
+
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	overridden, err := w.Ulist.Lists.Templates(list)
+	if err != nil {
+		return err
+	}
+
+	data := html.TemplatesData{
+		Auth:         auth,
+		List:         list,
+		Overridables: txt.Overridables,
+		Overridden:   make(map[string]bool),
+	}
+	for _, name := range overridden {
+		data.Overridden[name] = true
+	}
+
+	name := ctx.ps.ByName("name")
+	if name == "" {
+		return ctx.Execute(html.Templates, data)
+	}
+
+	current, ok := txt.GetOverridable(name)
+	if !ok {
+		return errors.New("unknown template")
+	}
+	data.Current = &current
+
+	if ctx.r.Method == http.MethodPost {
+
+		src := txt.CRLF(ctx.r.PostFormValue("src"))
+		if src == current.Default() {
+			src = "" // no override
+		}
+
+		switch ctx.r.PostFormValue("action") {
+		case "reset":
+			if err := w.Ulist.Lists.SetTemplate(list, name, ""); err != nil {
+				return err
+			}
+			ctx.Successf("The template %s of %s has been reset.", name, list)
+			ctx.Redirect("/templates/%s", url.PathEscape(list.RFC5322AddrSpec()))
+			return nil
+		case "save":
+			if len(src) > maxTemplateLength {
+				ctx.Alertf("The template has not been saved because it is too long.")
+			} else if _, err := current.Check(src); err != nil {
+				ctx.Alertf("The template has not been saved: %v", err)
+			} else {
+				if err := w.Ulist.Lists.SetTemplate(list, name, src); err != nil {
+					return err
+				}
+				ctx.Successf("The template %s of %s has been saved.", name, list)
+				ctx.Redirect("/templates/%s", url.PathEscape(list.RFC5322AddrSpec()))
+				return nil
+			}
+		default: // preview
+			if src == "" {
+				src = current.Default()
+			}
+			if data.Preview, err = current.Check(src); err != nil {
+				ctx.Alertf("Error in template: %v", err)
+			}
+		}
+
+		data.Src = ctx.r.PostFormValue("src")
+	} else {
+		data.Src, err = w.Ulist.Lists.GetTemplate(list, name)
+		if err != nil {
+			return err
+		}
+		if data.Src == "" {
+			data.Src = current.Default()
+		}
+	}
+
+	return ctx.Execute(html.Templates, data)
+}
+
 func (w Web) all(ctx *Context) error {
 
 	if !w.isSuperadmin(ctx.User) {
@@ -502,20 +799,84 @@ func (w Web) all(ctx *Context) error {
 	})
 }
 
+// blocklist shows and modifies the instance-wide blocklist
+func (w Web) blocklist(ctx *Context) error {
+
+	if !w.isSuperadmin(ctx.User) {
+		return errors.New("Unauthorized")
+	}
+
+	if ctx.r.Method == http.MethodPost {
+		w.updateBlocklist(ctx, nil)
+		ctx.Redirect("/blocklist")
+		return nil
+	}
+
+	blocked, err := w.Ulist.Lists.Blocked(nil)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Execute(html.Blocklist, html.BlocklistData{
+		Blocked: blocked,
+	})
+}
+
 func (w Web) create(ctx *Context) error {
 
 	if !w.isSuperadmin(ctx.User) {
 		return errors.New("Unauthorized")
 	}
 
-	data := html.CreateData{}
+	templates, err := w.Ulist.Lists.ListTemplates()
+	if err != nil {
+		return err
+	}
+
+	data := html.CreateData{
+		Templates: templates,
+	}
 
 	data.Address = ctx.r.PostFormValue("address")
 	data.Name = ctx.r.PostFormValue("name")
 	data.AdminMods = ctx.r.PostFormValue("admin_mods")
+	data.Template = ctx.r.PostFormValue("template")
+	data.Clone = ctx.r.PostFormValue("clone")
+	data.CopyKnowns = ctx.r.PostFormValue("copy_knowns") != ""
+	data.CopyMembers = ctx.r.PostFormValue("copy_members") != ""
 
 	if ctx.r.Method == http.MethodPost {
-		list, added, errs := w.Ulist.CreateList(data.Address, data.Name, data.AdminMods, fmt.Sprintf("specified during list creation by %s", ctx.User))
+
+		var reason = fmt.Sprintf("specified during list creation by %s", ctx.User)
+		var list *ulist.List
+		var added int
+		var errs []error
+
+		switch {
+		case data.Clone != "" && data.Template != "":
+			ctx.Alertf("Please choose either a template or a list to clone.")
+			return ctx.Execute(html.Create, data)
+		case data.Clone != "":
+			source, err := w.getList(data.Clone)
+			if err != nil {
+				ctx.Alertf("Error: %v", err)
+				return ctx.Execute(html.Create, data)
+			}
+			list, added, errs = w.Ulist.CloneList(source, data.Address, data.Name, data.AdminMods, data.CopyKnowns, data.CopyMembers, reason)
+		default:
+			var t *ulist.ListTemplate
+			if data.Template != "" {
+				if t, err = w.Ulist.Lists.GetListTemplate(data.Template); err != nil {
+					return err
+				}
+				if t == nil {
+					ctx.Alertf("The template %s does not exist.", data.Template)
+					return ctx.Execute(html.Create, data)
+				}
+			}
+			list, added, errs = w.Ulist.CreateListFromTemplate(data.Address, data.Name, data.AdminMods, t, reason)
+		}
+
 		if added > 0 {
 			ctx.Successf("%d members have been added and notified.", added)
 		}
@@ -523,9 +884,12 @@ func (w Web) create(ctx *Context) error {
 			for _, err := range errs {
 				ctx.Alertf("Error: %v", err)
 			}
-			return nil
+			if list == nil {
+				return ctx.Execute(html.Create, data)
+			}
+		} else {
+			ctx.Successf("The mailing list %s has been created.", list)
 		}
-		ctx.Successf("The mailing list %s has been created.", list)
 		ctx.Redirect("/members/%s", url.PathEscape(list.RFC5322AddrSpec()))
 		return nil
 	}
@@ -533,12 +897,66 @@ func (w Web) create(ctx *Context) error {
 	return ctx.Execute(html.Create, data)
 }
 
+// listTemplates shows, saves and removes list templates
+func (w Web) listTemplates(ctx *Context) error {
+
+	if !w.isSuperadmin(ctx.User) {
+		return errors.New("Unauthorized")
+	}
+
+	if ctx.r.Method == http.MethodPost {
+		if name := ctx.r.PostFormValue("remove"); name != "" {
+			if err := w.Ulist.Lists.RemoveListTemplate(name); err != nil {
+				return err
+			}
+			log.Printf("    web: %s removed the list template %s", ctx.User, name)
+			ctx.Successf("The template %s has been removed.", name)
+		} else {
+			if err := w.saveListTemplate(ctx); err != nil {
+				ctx.Alertf("Error saving template: %v", err)
+			}
+		}
+		ctx.Redirect("/list-templates")
+		return nil
+	}
+
+	templates, err := w.Ulist.Lists.ListTemplates()
+	if err != nil {
+		return err
+	}
+
+	return ctx.Execute(html.ListTemplates, html.ListTemplatesData{
+		Templates: templates,
+	})
+}
+
+func (w Web) saveListTemplate(ctx *Context) error {
+
+	list, err := w.getList(ctx.r.PostFormValue("list"))
+	if err != nil {
+		return err
+	}
+
+	t, err := w.Ulist.NewListTemplate(list, ctx.r.PostFormValue("name"))
+	if err != nil {
+		return err
+	}
+
+	if err := w.Ulist.Lists.SaveListTemplate(t); err != nil {
+		return err
+	}
+
+	log.Printf("    web: %s saved the settings of %s as list template %s", ctx.User, list, t.Name)
+	ctx.Successf("The settings of %s have been saved as template %s.", list, t.Name)
+	return nil
+}
+
 func (w Web) delete(ctx *Context, list *ulist.List) error {
 
 	if ctx.r.Method == http.MethodPost && ctx.r.PostFormValue("delete") == "delete" {
 
 		if ctx.r.PostFormValue("confirm_delete") == "yes" {
-			if err := w.Ulist.Lists.Delete(list); err != nil {
+			if err := w.Ulist.DeleteList(list); err != nil {
 				return err
 			}
 			log.Printf("    web: %s deleted the mailing list %s", ctx.User, list)
@@ -553,6 +971,36 @@ func (w Web) delete(ctx *Context, list *ulist.List) error {
 	return ctx.Execute(html.Delete, list)
 }
 
+// rename changes the address of a list. It is restricted to the superadmin because the new address could be on any domain.
+func (w Web) rename(ctx *Context, list *ulist.List) error {
+
+	if !w.isSuperadmin(ctx.User) {
+		return errors.New("Unauthorized")
+	}
+
+	data := html.RenameData{
+		List:      list,
+		Address:   list.RFC5322AddrSpec(),
+		KeepAlias: true,
+	}
+
+	if ctx.r.Method == http.MethodPost {
+		data.Address = strings.TrimSpace(ctx.r.PostFormValue("address"))
+		data.KeepAlias = ctx.r.PostFormValue("keep_alias") != ""
+		oldAddress := list.RFC5322AddrSpec()
+		if err := w.Ulist.RenameList(list, data.Address, data.KeepAlias, fmt.Sprintf("renamed by %s", ctx.User)); err != nil {
+			ctx.Alertf("Error renaming the list: %v", err)
+		} else {
+			log.Printf("    web: %s renamed the mailing list %s to %s", ctx.User, oldAddress, list)
+			ctx.Successf("The mailing list %s has been renamed to %s.", oldAddress, list)
+			ctx.Redirect("/settings/%s", url.PathEscape(list.RFC5322AddrSpec()))
+			return nil
+		}
+	}
+
+	return ctx.Execute(html.Rename, data)
+}
+
 func (w Web) members(ctx *Context, list *ulist.List) error {
 
 	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
@@ -572,29 +1020,88 @@ func (w Web) members(ctx *Context, list *ulist.List) error {
 	})
 }
 
-func (w Web) membersAdd(ctx *Context, list *ulist.List) error {
+// membersLists shows and modifies the sublists of a list. Including a list requires admin permission for it too, because its members get the messages then.
+func (w Web) membersLists(ctx *Context, list *ulist.List) error {
 
-	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
-	if err != nil {
-		return err
-	}
+	if ctx.r.Method == http.MethodPost {
 
-	var data = &html.MembersAddRemoveData{
-		Auth: auth,
-		List: list,
-	}
+		sublistAddr, err := mailutil.ParseAddress(ctx.r.PostFormValue("sublist"))
+		if err != nil {
+			ctx.Alertf("Error parsing list address: %v", err)
+			ctx.Redirect("/members/%s/lists", url.PathEscape(list.RFC5322AddrSpec()))
+			return nil
+		}
 
-	if ctx.r.Method == http.MethodPost {
-		addrs, errs := mailutil.ParseAddresses(ctx.r.PostFormValue("addrs"), ulist.WebBatchLimit)
-		if len(addrs) > 0 && len(errs) == 0 {
-			return ctx.Execute(html.MembersAddStaging, &html.MembersAddRemoveStagingData{
-				Auth:  auth,
-				List:  list,
-				Addrs: mailutil.RFC5322AddrSpecs(addrs),
-			})
-		} else {
-			for _, err := range errs {
-				ctx.Alertf("Error parsing email addresses: %v", err)
+		sublist, err := w.Ulist.Lists.GetList(sublistAddr)
+		if err != nil {
+			return err
+		}
+		if sublist == nil {
+			ctx.Alertf("List not found: %s", sublistAddr)
+			ctx.Redirect("/members/%s/lists", url.PathEscape(list.RFC5322AddrSpec()))
+			return nil
+		}
+
+		if ctx.r.PostFormValue("add") != "" {
+			if m, _ := w.getMembershipOfAuthUser(sublist, ctx.User); !m.Admin {
+				return ErrUnauthorized
+			}
+			if err := w.Ulist.Lists.AddSublist(list, sublist); err != nil {
+				ctx.Alertf("Error including %s: %v", sublist, err)
+			} else {
+				ctx.Successf("%s includes %s now.", list, sublist)
+			}
+		} else if ctx.r.PostFormValue("remove") != "" {
+			if err := w.Ulist.Lists.RemoveSublist(list, sublist); err != nil {
+				return err
+			}
+			ctx.Successf("%s doesn't include %s any more.", list, sublist)
+		}
+
+		ctx.Redirect("/members/%s/lists", url.PathEscape(list.RFC5322AddrSpec()))
+		return nil
+	}
+
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	sublists, err := w.Ulist.Lists.Sublists(list)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Execute(html.MembersLists, html.MembersListsData{
+		Auth:     auth,
+		List:     list,
+		Sublists: sublists,
+	})
+}
+
+func (w Web) membersAdd(ctx *Context, list *ulist.List) error {
+
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	var data = &html.MembersAddRemoveData{
+		Auth: auth,
+		List: list,
+	}
+
+	if ctx.r.Method == http.MethodPost {
+		addrs, errs := mailutil.ParseAddresses(ctx.r.PostFormValue("addrs"), ulist.WebBatchLimit)
+		if len(addrs) > 0 && len(errs) == 0 {
+			return ctx.Execute(html.MembersAddStaging, &html.MembersAddRemoveStagingData{
+				Auth:  auth,
+				List:  list,
+				Addrs: mailutil.RFC5322AddrSpecs(addrs),
+			})
+		} else {
+			for _, err := range errs {
+				ctx.Alertf("Error parsing email addresses: %v", err)
 			}
 			data.Addrs = ctx.r.PostFormValue("addrs") // keep POST data
 		}
@@ -767,6 +1274,18 @@ func (w Web) member(ctx *Context, list *ulist.List) error {
 			log.Printf("    web: error updating member: %v", err)
 		}
 
+		if notifyMode, err := ulist.ParseNotifyMode(ctx.r.PostFormValue("notify-mode")); err == nil {
+			if err := w.Ulist.Lists.UpdateNotifyMode(list, m.MemberAddress, notifyMode); err != nil {
+				log.Printf("    web: error updating notify mode: %v", err)
+			}
+		}
+
+		if delivery, err := ulist.ParseDelivery(ctx.r.PostFormValue("delivery")); err == nil {
+			if err := w.Ulist.Lists.UpdateDelivery(list, m.MemberAddress, delivery); err != nil {
+				log.Printf("    web: error updating delivery: %v", err)
+			}
+		}
+
 		ctx.Successf("The membership settings of %s in %s have been saved.", m.MemberAddress, list)
 		ctx.Redirect("/member/%s/%s", url.PathEscape(list.RFC5322AddrSpec()), url.PathEscape(m.MemberAddress))
 		return nil
@@ -780,6 +1299,146 @@ func (w Web) member(ctx *Context, list *ulist.List) error {
 	return ctx.Execute(html.Member, data)
 }
 
+// compose posts a message from the web interface. The logged-in user is the sender, and the posting rules of the list apply.
+func (w Web) compose(ctx *Context, list *ulist.List) error {
+
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	data := html.ComposeData{
+		Auth: auth,
+		List: list,
+		User: ctx.User,
+	}
+
+	if ctx.r.Method == http.MethodPost {
+
+		ctx.r.Body = http.MaxBytesReader(ctx.w, ctx.r.Body, maxComposeSize)
+		if err := ctx.r.ParseMultipartForm(maxComposeSize); err != nil {
+			ctx.Alertf("Error reading the form, maybe the attachments are too large: %v", err)
+			ctx.Redirect("/compose/%s", url.PathEscape(list.RFC5322AddrSpec()))
+			return nil
+		}
+
+		if filename := ctx.r.PostFormValue("cancel"); filename != "" {
+			if err := w.cancelScheduled(ctx, list, auth, filename); err != nil {
+				ctx.Alertf("Error canceling the message: %v", err)
+			} else {
+				ctx.Successf("The scheduled message has been canceled.")
+			}
+			ctx.Redirect("/compose/%s", url.PathEscape(list.RFC5322AddrSpec()))
+			return nil
+		}
+
+		data.Subject = ctx.r.PostFormValue("subject")
+		data.Text = ctx.r.PostFormValue("text")
+		data.SendAt = ctx.r.PostFormValue("send_at")
+
+		if err := w.composeSubmit(ctx, list, data); err != nil {
+			ctx.Alertf("Error: %v", err)
+		} else {
+			ctx.Redirect("/compose/%s", url.PathEscape(list.RFC5322AddrSpec()))
+			return nil
+		}
+	}
+
+	data.Scheduled, err = w.Ulist.ScheduledPosts(list)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Execute(html.Compose, data)
+}
+
+func (w Web) composeSubmit(ctx *Context, list *ulist.List, data html.ComposeData) error {
+
+	var sendAt time.Time
+	if data.SendAt != "" {
+		var err error
+		sendAt, err = time.ParseInLocation("2006-01-02T15:04", data.SendAt, time.Local)
+		if err != nil {
+			return fmt.Errorf("parsing send time: %w", err)
+		}
+		if sendAt.Before(time.Now()) {
+			return errors.New("the send time is in the past")
+		}
+	}
+
+	var attachments []ulist.Attachment
+	for _, fh := range ctx.r.MultipartForm.File["attachments"] {
+		file, err := fh.Open()
+		if err != nil {
+			return err
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			return err
+		}
+		attachments = append(attachments, ulist.Attachment{
+			Filename:    fh.Filename,
+			ContentType: fh.Header.Get("Content-Type"),
+			Data:        content,
+		})
+	}
+
+	m, err := list.Compose(ctx.User, data.Subject, data.Text, attachments)
+	if err != nil {
+		return err
+	}
+
+	if !sendAt.IsZero() {
+		if err := w.Ulist.Schedule(list, m, sendAt); err != nil {
+			return err
+		}
+		log.Printf("    web: %s scheduled a message to %s for %s", ctx.User, list, sendAt.Format(time.RFC3339))
+		ctx.Successf("Your message will be sent on %s. The posting rules are checked again then.", sendAt.Format("2006-01-02 15:04"))
+		return nil
+	}
+
+	action, err := w.Ulist.Post(list, m)
+	if err != nil {
+		return err
+	}
+	log.Printf("    web: %s composed a message to %s, action: %s", ctx.User, list, action)
+	if action == ulist.Mod {
+		ctx.Successf("Your message is waiting for moderation.")
+	} else {
+		ctx.Successf("Your message has been sent.")
+	}
+	return nil
+}
+
+// cancelScheduled removes a scheduled message. Admins can cancel any message, moderators only their own ones.
+func (w Web) cancelScheduled(ctx *Context, list *ulist.List, auth ulist.Membership, filename string) error {
+
+	if !auth.Admin {
+		posts, err := w.Ulist.ScheduledPosts(list)
+		if err != nil {
+			return err
+		}
+		var own bool
+		for _, post := range posts {
+			if post.Filename == filename {
+				if from, err := mailutil.ParseAddress(post.From); err == nil && from.Equals(ctx.User) {
+					own = true
+				}
+			}
+		}
+		if !own {
+			return ErrUnauthorized
+		}
+	}
+
+	if err := w.Ulist.CancelScheduled(list, filename); err != nil {
+		return err
+	}
+	log.Printf("    web: %s canceled the scheduled message %s to %s", ctx.User, filename, list)
+	return nil
+}
+
 func (w Web) knowns(ctx *Context, list *ulist.List) error {
 
 	if ctx.r.Method == http.MethodPost {
@@ -827,129 +1486,258 @@ func (w Web) knowns(ctx *Context, list *ulist.List) error {
 	})
 }
 
-func (w Web) mod(ctx *Context, list *ulist.List) error {
-
-	var err error
+// listBlocklist shows and modifies the blocklist of a list
+func (w Web) listBlocklist(ctx *Context, list *ulist.List) error {
 
 	if ctx.r.Method == http.MethodPost {
+		w.updateBlocklist(ctx, list)
+		ctx.Redirect("/blocklist/%s", url.PathEscape(list.RFC5322AddrSpec()))
+		return nil
+	}
 
-		ctx.r.ParseForm()
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	blocked, err := w.Ulist.Lists.Blocked(list)
+	if err != nil {
+		return err
+	}
 
-		notifyDeleted := 0
-		notifyPassed := 0
-		notifyAddedKnown := 0
+	return ctx.Execute(html.Blocklist, html.BlocklistData{
+		Auth:    auth,
+		List:    list,
+		Blocked: blocked,
+	})
+}
 
-		for emlFilename, action := range ctx.r.PostForm {
+// list nil means the instance-wide blocklist
+func (w Web) updateBlocklist(ctx *Context, list *ulist.List) {
 
-			if !strings.HasPrefix(emlFilename, "action-") {
-				continue
-			}
+	patterns, errs := ulist.ParseBlockPatterns(ctx.r.PostFormValue("patterns"), ulist.WebBatchLimit)
+	for _, err := range errs {
+		ctx.Alertf("Error parsing blocklist entry: %v", err)
+	}
+
+	if ctx.r.PostFormValue("add") != "" {
+		added, err := w.Ulist.Lists.AddBlocked(list, patterns)
+		if len(added) > 0 {
+			ctx.Successf("Blocked %d addresses or domains", len(added))
+		}
+		if err != nil {
+			ctx.Alertf("Error: %v", err)
+		}
+	} else if ctx.r.PostFormValue("remove") != "" {
+		removed, err := w.Ulist.Lists.RemoveBlocked(list, patterns)
+		if len(removed) > 0 {
+			ctx.Successf("Unblocked %d addresses or domains", len(removed))
+		}
+		if err != nil {
+			ctx.Alertf("Error: %v", err)
+		}
+	}
+}
 
-			emlFilename = strings.TrimPrefix(emlFilename, "action-")
+// modCounts counts the results of moderation actions for the success notification
+type modCounts struct {
+	deleted int
+	passed  int
+	blocked int
+}
+
+func (c modCounts) String() string {
+	var result []string
+	if c.passed > 0 {
+		result = append(result, fmt.Sprintf("Let pass %d messages.", c.passed))
+	}
+	if c.deleted > 0 {
+		result = append(result, fmt.Sprintf("Deleted %d messages.", c.deleted))
+	}
+	if c.blocked > 0 {
+		result = append(result, fmt.Sprintf("Blocked %d senders.", c.blocked))
+	}
+	return strings.Join(result, " ")
+}
 
-			m, err := w.Ulist.ReadMessage(list, emlFilename) // err is evaluated in the switch
+// parseModFilter reads the moderation queue filter from the query string
+func parseModFilter(query url.Values) ulist.ModFilter {
+	filter := ulist.ModFilter{
+		Sender:  strings.TrimSpace(query.Get("sender")),
+		Subject: strings.TrimSpace(query.Get("subject")),
+	}
+	if spam := query.Get("spam"); spam == "yes" || spam == "no" {
+		filter.Spam = spam
+	}
+	filter.After, filter.Before = parseDates(query)
+	return filter
+}
 
-			switch action[0] {
+// parseDates reads the "after" and "before" dates from the query string. Both are inclusive, so before is moved to the next day. Missing or invalid dates are returned as zero times.
+func parseDates(query url.Values) (after, before time.Time) {
+	if t, err := time.ParseInLocation("2006-01-02", query.Get("after"), time.Local); err == nil {
+		after = t
+	}
+	if t, err := time.ParseInLocation("2006-01-02", query.Get("before"), time.Local); err == nil {
+		before = t.AddDate(0, 0, 1)
+	}
+	return
+}
 
-			case "delete":
+// moderate applies a moderation action to a stored message. addKnown is evaluated for "delete" and "pass" only.
+func (w Web) moderate(ctx *Context, list *ulist.List, emlFilename, action string, addKnown bool, counts *modCounts) {
 
-				if err = w.Ulist.DeleteModeratedMail(list, emlFilename); err != nil {
-					ctx.Alertf("Error deleting email: %v", err)
-				} else {
-					notifyDeleted++
-				}
+	m, err := w.Ulist.ReadMessage(list, emlFilename) // err is evaluated in the switch
 
-				if ctx.r.PostFormValue("addknown-delete-"+emlFilename) != "" {
-					if from, ok := m.SingleFrom(); ok && list.ActionKnown == ulist.Reject { // same condition as in template
-						if _, err := w.Ulist.Lists.AddKnowns(list, []*ulist.Addr{from}); err != nil {
-							ctx.Alertf("Error adding known sender: %v", err)
-						} else {
-							notifyAddedKnown++
-						}
-					}
-				}
+	switch action {
 
-			case "pass":
+	case "delete":
 
-				if err != nil {
-					break // don't forward emails with (probably header parsing) error
-				}
+		var header mail.Header // nil if the message could not be read
+		if err == nil {
+			header = m.Header
+		}
 
-				if err = w.Ulist.Forward(list, m); err != nil {
-					log.Printf("    web: error sending email through list %s: %v", list, err)
-					ctx.Alertf("Error sending email through list: %v", err)
-				} else {
-					log.Printf("    web: email sent through list %s", list)
-					notifyPassed++
-					_ = w.Ulist.DeleteModeratedMail(list, emlFilename)
-				}
+		if err = w.Ulist.DeleteModeratedMail(list, emlFilename); err != nil {
+			ctx.Alertf("Error deleting email: %v", err)
+		} else {
+			counts.deleted++
+			w.Ulist.Audit(list, ctx.User, ulist.DecisionDelete, header)
+		}
 
-				if ctx.r.PostFormValue("addknown-pass-"+emlFilename) != "" {
-					if from, ok := m.SingleFrom(); ok && list.ActionKnown == ulist.Pass { // same condition as in template
-						if _, err := w.Ulist.Lists.AddKnowns(list, []*ulist.Addr{from}); err != nil {
-							ctx.Alertf("Error adding known sender: %v", err)
-						} else {
-							notifyAddedKnown++
-						}
-					}
+		if addKnown && header != nil {
+			if from, ok := m.SingleFrom(); ok && list.ActionKnown == ulist.Reject { // same condition as in template
+				if _, err := w.Ulist.Lists.AddKnowns(list, []*ulist.Addr{from}); err != nil {
+					ctx.Alertf("Error adding known sender: %v", err)
+				} else {
+					w.Ulist.Audit(list, ctx.User, ulist.DecisionAddKnown, header)
 				}
 			}
 		}
 
-		// notification
+	case "block":
 
-		successNotification := ""
+		if err != nil {
+			break // we need the From address
+		}
 
-		if notifyPassed > 0 {
-			successNotification += fmt.Sprintf("Let pass %d messages. ", notifyPassed)
+		from, ok := m.SingleFrom()
+		if !ok {
+			break // same condition as in template
 		}
 
-		if notifyDeleted > 0 {
-			successNotification += fmt.Sprintf("Deleted %d messages.", notifyDeleted)
+		if _, err := w.Ulist.Lists.AddBlocked(list, []string{from.RFC5322AddrSpec()}); err != nil {
+			ctx.Alertf("Error blocking sender: %v", err)
+			break // keep the message, so the moderator can try again
 		}
+		counts.blocked++
+		w.Ulist.Audit(list, ctx.User, ulist.DecisionBlock, m.Header) // includes the deletion of the message
 
-		if successNotification != "" {
-			ctx.Successf("%s", successNotification)
+		if err = w.Ulist.DeleteModeratedMail(list, emlFilename); err != nil {
+			ctx.Alertf("Error deleting email: %v", err)
+		} else {
+			counts.deleted++
 		}
 
-		ctx.Redirect("/mod/%s", url.PathEscape(list.RFC5322AddrSpec()))
-		return nil
-	}
+	case "pass":
 
-	// get up to 1000 *.eml filenames from list folder
+		if err != nil {
+			break // don't forward emails with (probably header parsing) error
+		}
 
-	var emlFilenames []string
+		if err = w.Ulist.Forward(list, m); err != nil {
+			log.Printf("    web: error sending email through list %s: %v", list, err)
+			ctx.Alertf("Error sending email through list: %v", err)
+		} else {
+			log.Printf("    web: email sent through list %s", list)
+			counts.passed++
+			w.Ulist.Audit(list, ctx.User, ulist.DecisionPass, m.Header)
+			_ = w.Ulist.DeleteModeratedMail(list, emlFilename)
+		}
 
-	if listStorageFolder, err := os.Open(w.Ulist.StorageFolder(list.ListInfo)); err == nil { // the folder is created when the first message is moderated, so we ignore errors here
-		emlFilenames, err = listStorageFolder.Readdirnames(1000)
-		if err != nil && err != io.EOF {
-			return err
+		if addKnown {
+			if from, ok := m.SingleFrom(); ok && list.ActionKnown == ulist.Pass { // same condition as in template
+				if _, err := w.Ulist.Lists.AddKnowns(list, []*ulist.Addr{from}); err != nil {
+					ctx.Alertf("Error adding known sender: %v", err)
+				} else {
+					w.Ulist.Audit(list, ctx.User, ulist.DecisionAddKnown, m.Header)
+				}
+			}
 		}
 	}
+}
 
-	// maxPage
+func (w Web) mod(ctx *Context, list *ulist.List) error {
 
-	maxPage := int(math.Ceil(float64(len(emlFilenames)) / float64(modPerPage)))
+	filter := parseModFilter(ctx.r.URL.Query())
 
-	if maxPage < 1 {
-		maxPage = 1
+	modUrl := "/mod/" + url.PathEscape(list.RFC5322AddrSpec())
+	var query string
+	if ctx.r.URL.RawQuery != "" {
+		query = "?" + ctx.r.URL.RawQuery
 	}
 
-	// page
+	if ctx.r.Method == http.MethodPost {
 
-	page, err := strconv.Atoi(ctx.ps.ByName("page"))
-	if err != nil {
-		page = 1
-	}
+		ctx.r.ParseForm()
 
-	if page < 1 {
-		page = 1
+		var counts modCounts
+
+		if bulk := ctx.r.PostFormValue("bulk"); bulk != "" {
+
+			// apply to all messages which match the filter, not only the visible ones
+
+			if ctx.r.PostFormValue("confirm-bulk") == "" {
+				ctx.Alertf("Please confirm that the action should be applied to all matching messages.")
+				ctx.Redirect("%s%s", modUrl, query)
+				return nil
+			}
+
+			if bulk != "delete" && bulk != "pass" && bulk != "block" {
+				return errors.New("unknown bulk action")
+			}
+
+			emlFilenames, err := w.Ulist.FilterModerated(list, filter)
+			if err != nil {
+				return err
+			}
+
+			for _, emlFilename := range emlFilenames {
+				w.moderate(ctx, list, emlFilename, bulk, false, &counts)
+			}
+
+		} else {
+
+			for emlFilename, action := range ctx.r.PostForm {
+
+				if !strings.HasPrefix(emlFilename, "action-") {
+					continue
+				}
+
+				emlFilename = strings.TrimPrefix(emlFilename, "action-")
+
+				var addKnown = ctx.r.PostFormValue("addknown-"+action[0]+"-"+emlFilename) != ""
+				w.moderate(ctx, list, emlFilename, action[0], addKnown, &counts)
+			}
+		}
+
+		if notification := counts.String(); notification != "" {
+			ctx.Successf("%s", notification)
+		}
+
+		ctx.Redirect("%s%s", modUrl, query)
+		return nil
 	}
 
-	if page > maxPage {
-		page = maxPage
+	// get all matching *.eml filenames from list folder, newest first
+
+	emlFilenames, err := w.Ulist.FilterModerated(list, filter)
+	if err != nil {
+		return err
 	}
 
+	page, pageLinks := paginate(ctx, len(emlFilenames), modPerPage, modUrl)
+
 	// template data
 
 	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
@@ -958,12 +1746,189 @@ func (w Web) mod(ctx *Context, list *ulist.List) error {
 	}
 
 	data := html.ModData{
-		Auth: auth,
-		List: list,
-		Page: page,
+		Auth:      auth,
+		List:      list,
+		Page:      page,
+		PageLinks: pageLinks,
+		Query:     query,
+		Filter:    ctx.r.URL.Query(),
+		Filtered:  !filter.IsEmpty(),
+		Matching:  len(emlFilenames),
+	}
+
+	if list.HasRateLimit() {
+		data.Counters, err = w.Ulist.Lists.PostCounts(list, time.Now())
+		if err != nil {
+			return err
+		}
+	}
+
+	// slice the eml filenames
+
+	from := (page - 1) * modPerPage // 0-based index
+
+	if from < len(emlFilenames) && len(emlFilenames) > 0 {
+		emlFilenames = emlFilenames[from:]
+	}
+
+	if len(emlFilenames) > modPerPage {
+		emlFilenames = emlFilenames[:modPerPage]
+	}
+
+	// load messages from eml files
+
+	for _, emlFilename := range emlFilenames {
+		header, err := w.Ulist.ReadHeader(list, emlFilename)
+		data.Messages = append(data.Messages, html.StoredMessage{
+			Header:   header,
+			Err:      err,
+			Filename: emlFilename,
+		})
+	}
+
+	return ctx.Execute(html.Mod, data)
+}
+
+func (w Web) view(ctx *Context, list *ulist.List) error {
+
+	emlFilename := ctx.ps.ByName("emlfilename")
+	if strings.Contains(emlFilename, "..") || strings.Contains(emlFilename, "/") {
+		return errors.New("filename contains forbidden characters")
+	}
+
+	ctx.ServeFile(w.Ulist.StorageFolder(list.ListInfo) + "/" + emlFilename)
+	return nil
+}
+
+// edit lets a moderator change the subject and the text of a moderated message, and remove parts of it
+func (w Web) edit(ctx *Context, list *ulist.List) error {
+
+	emlFilename := ctx.ps.ByName("emlfilename")
+
+	msg, err := w.Ulist.ReadMessage(list, emlFilename)
+	if err != nil {
+		return err
+	}
+
+	root, err := msg.ParseParts()
+	if err != nil {
+		return err
+	}
+
+	// the editable text is the first text/plain part which is not an attachment, like in the preview
+
+	var leaves = root.Leaves()
+	var textPart *mailutil.Part
+	var textIndex = -1
+
+	for i, leaf := range leaves {
+		if leaf.MediaType == "text/plain" && !leaf.IsAttachment() {
+			textPart = leaf
+			textIndex = i
+			break
+		}
+	}
+
+	if ctx.r.Method == http.MethodPost {
+
+		msg.Header["Subject"] = []string{mime.QEncoding.Encode("utf-8", strings.TrimSpace(ctx.r.PostFormValue("subject")))}
+
+		if len(leaves) > 1 {
+			var remove = make(map[int]bool)
+			for i := range leaves {
+				if ctx.r.PostFormValue("remove-"+strconv.Itoa(i)) != "" {
+					remove[i] = true
+				}
+			}
+			root.RemoveLeaves(remove)
+		}
+
+		if textPart != nil {
+			var text = ctx.r.PostFormValue("text")
+			if strings.ReplaceAll(text, "\r\n", "\n") != strings.ReplaceAll(textPart.Text(), "\r\n", "\n") {
+				textPart.SetText(text)
+				root = root.KeepAlternative(textPart) // else most clients would show the unchanged HTML version
+			}
+		}
+
+		if err := msg.SetParts(root); err != nil {
+			return err
+		}
+
+		msg.Header["X-Ulist-Edited"] = []string{"edited by a moderator on " + time.Now().Format(time.RFC1123Z)}
+
+		if err := w.Ulist.Overwrite(list, emlFilename, msg); err != nil {
+			return err
+		}
+
+		w.Ulist.Audit(list, ctx.User, ulist.DecisionEdit, msg.Header)
+
+		ctx.Successf("The message has been edited. You can pass it now.")
+		ctx.Redirect("/mod/%s", url.PathEscape(list.RFC5322AddrSpec()))
+		return nil
+	}
+
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	data := html.EditData{
+		Auth:     auth,
+		List:     list,
+		Filename: emlFilename,
+		Subject:  mailutil.RobustWordDecode(msg.Header.Get("Subject")),
+		HasText:  textPart != nil,
+	}
+
+	if textPart != nil {
+		data.Text = textPart.Text()
+	}
+
+	if len(leaves) > 1 {
+		for i, leaf := range leaves {
+			if i == textIndex {
+				continue
+			}
+			data.Parts = append(data.Parts, html.PreviewAttachment{
+				Index:     i,
+				Filename:  leaf.Filename(),
+				MediaType: leaf.MediaType,
+				Size:      len(leaf.Body),
+			})
+		}
 	}
 
-	// populate PageLinks
+	return ctx.Execute(html.Edit, data)
+}
+
+// paginate reads the current page from the "page" router parameter and clamps it. It returns links to the first, the last and some pages in between. The link to a page is baseUrl + "/" + page, plus the query string of the current request.
+func paginate(ctx *Context, count, perPage int, baseUrl string) (int, []html.PageLink) {
+
+	// maxPage
+
+	maxPage := int(math.Ceil(float64(count) / float64(perPage)))
+
+	if maxPage < 1 {
+		maxPage = 1
+	}
+
+	// page
+
+	page, err := strconv.Atoi(ctx.ps.ByName("page"))
+	if err != nil {
+		page = 1
+	}
+
+	if page < 1 {
+		page = 1
+	}
+
+	if page > maxPage {
+		page = maxPage
+	}
+
+	// links
 
 	pages := []int{1, page, maxPage}
 
@@ -977,53 +1942,440 @@ func (w Web) mod(ctx *Context, list *ulist.List) error {
 
 	sort.Ints(pages)
 
+	var links []html.PageLink
 	for i, p := range pages {
 		if i > 0 && pages[i-1] == pages[i] {
 			continue // skip duplicates
 		}
-		data.PageLinks = append(data.PageLinks, html.PageLink{
+		link := fmt.Sprintf("%s/%d", baseUrl, p)
+		if ctx.r.URL.RawQuery != "" {
+			link += "?" + ctx.r.URL.RawQuery // keep filters
+		}
+		links = append(links, html.PageLink{
 			Page: p,
-			Url:  fmt.Sprintf("/mod/%s/%d", url.PathEscape(list.RFC5322AddrSpec()), p),
+			Url:  link,
 		})
 	}
 
-	// sort and slice the eml filenames
+	return page, links
+}
 
-	sort.Sort(sort.Reverse(sort.StringSlice(emlFilenames)))
+// audit shows the moderation decisions of a list, newest first
+func (w Web) audit(ctx *Context, list *ulist.List) error {
 
-	from := (page - 1) * modPerPage // 0-based index
+	count, err := w.Ulist.Lists.CountAuditEntries(list)
+	if err != nil {
+		return err
+	}
 
-	if from < len(emlFilenames) && len(emlFilenames) > 0 {
-		emlFilenames = emlFilenames[from:]
+	page, pageLinks := paginate(ctx, count, auditPerPage, "/audit/"+url.PathEscape(list.RFC5322AddrSpec()))
+
+	entries, err := w.Ulist.Lists.AuditEntries(list, (page-1)*auditPerPage, auditPerPage)
+	if err != nil {
+		return err
 	}
 
-	if len(emlFilenames) > modPerPage {
-		emlFilenames = emlFilenames[:modPerPage]
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
 	}
 
-	// load messages from eml files
+	return ctx.Execute(html.Audit, html.AuditData{
+		Auth:      auth,
+		List:      list,
+		Entries:   entries,
+		Page:      page,
+		PageLinks: pageLinks,
+	})
+}
 
-	for _, emlFilename := range emlFilenames {
-		header, err := w.Ulist.ReadHeader(list, emlFilename)
-		data.Messages = append(data.Messages, html.StoredMessage{
-			Header:   header,
-			Err:      err,
-			Filename: emlFilename,
+// preview shows the headers, the text and the sanitized html of a moderated message, and lists its attachments
+func (w Web) preview(ctx *Context, list *ulist.List) error {
+
+	emlFilename := ctx.ps.ByName("emlfilename")
+
+	msg, err := w.Ulist.ReadMessage(list, emlFilename)
+	if err != nil {
+		return err
+	}
+
+	root, err := msg.ParseParts()
+	if err != nil {
+		return err
+	}
+
+	auth, err := w.getMembershipOfAuthUser(list, ctx.User)
+	if err != nil {
+		return err
+	}
+
+	data := html.PreviewData{
+		Auth:     auth,
+		List:     list,
+		Filename: emlFilename,
+		Header:   msg.Header,
+	}
+	data.Text, data.HTML, data.Attachments = renderParts(root)
+
+	setPreviewCSP(ctx)
+
+	return ctx.Execute(html.Preview, data)
+}
+
+// renderParts returns the first text/plain part, the first text/html part (sanitized, with inline images) and the remaining leaves of the MIME tree as attachments.
+func renderParts(root *mailutil.Part) (text string, sanitizedHTML string, attachments []html.PreviewAttachment) {
+
+	var htmlBody string
+	var inlineImages = make(map[string]*mailutil.Part) // key: Content-ID
+
+	for i, leaf := range root.Leaves() {
+		switch {
+		case leaf.MediaType == "text/plain" && !leaf.IsAttachment() && text == "":
+			text = leaf.Text()
+		case leaf.MediaType == "text/html" && !leaf.IsAttachment() && htmlBody == "":
+			htmlBody = leaf.Text()
+		default:
+			if strings.HasPrefix(leaf.MediaType, "image/") && leaf.ContentID() != "" {
+				inlineImages[leaf.ContentID()] = leaf
+			}
+			attachments = append(attachments, html.PreviewAttachment{
+				Index:     i,
+				Filename:  leaf.Filename(),
+				MediaType: leaf.MediaType,
+				Size:      len(leaf.Body),
+			})
+		}
+	}
+
+	if htmlBody != "" {
+		sanitizedHTML = mailutil.SanitizeHTML(htmlBody, func(contentID string) (string, bool) {
+			if img, ok := inlineImages[contentID]; ok {
+				return "data:" + img.MediaType + ";base64," + base64.StdEncoding.EncodeToString(img.Body), true
+			}
+			return "", false
 		})
 	}
 
-	return ctx.Execute(html.Mod, data)
+	return
 }
 
-func (w Web) view(ctx *Context, list *ulist.List) error {
+// setPreviewCSP is defense in depth, in case the sanitizer misses something: no scripts, no remote content
+func setPreviewCSP(ctx *Context) {
+	ctx.w.Header().Set("Content-Security-Policy", "default-src 'none'; img-src data:; style-src 'self' 'unsafe-inline'; form-action 'none'; base-uri 'none'")
+}
 
-	emlFilename := ctx.ps.ByName("emlfilename")
-	if strings.Contains(emlFilename, "..") || strings.Contains(emlFilename, "/") {
-		return errors.New("filename contains forbidden characters")
+// previewPart serves a leaf of the MIME tree of a moderated message as a download
+func (w Web) previewPart(ctx *Context, list *ulist.List) error {
+
+	msg, err := w.Ulist.ReadMessage(list, ctx.ps.ByName("emlfilename"))
+	if err != nil {
+		return err
 	}
 
-	ctx.ServeFile(w.Ulist.StorageFolder(list.ListInfo) + "/" + emlFilename)
-	return nil
+	root, err := msg.ParseParts()
+	if err != nil {
+		return err
+	}
+
+	return servePart(ctx, root)
+}
+
+// servePart serves the leaf of the MIME tree which is given in the "part" parameter as a download
+func servePart(ctx *Context, root *mailutil.Part) error {
+
+	leaves := root.Leaves()
+
+	index, err := strconv.Atoi(ctx.ps.ByName("part"))
+	if err != nil || index < 0 || index >= len(leaves) {
+		return errors.New("part not found")
+	}
+
+	part := leaves[index]
+
+	filename := part.Filename()
+	if filename == "" {
+		filename = fmt.Sprintf("part-%d", index)
+	}
+
+	// never let the browser render the attachment in our origin
+	ctx.w.Header().Set("Content-Type", "application/octet-stream")
+	ctx.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	ctx.w.Header().Set("X-Content-Type-Options", "nosniff")
+	_, err = ctx.w.Write(part.Body)
+	return err
+}
+
+// archive
+
+// requireArchiveAccess checks whether the user, who might not be logged in, can read the archive of the list
+func (w Web) requireArchiveAccess(f func(*Context, *ulist.List, ulist.Membership) error) func(*Context, *ulist.List) error {
+	return func(ctx *Context, list *ulist.List) error {
+
+		if w.Ulist.Archive == nil {
+			return ErrNoList
+		}
+
+		var auth = ulist.Membership{
+			ListInfo: list.ListInfo,
+		}
+		if ctx.LoggedIn() {
+			var err error
+			auth, err = w.getMembershipOfAuthUser(list, ctx.User)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !auth.CanReadArchive() {
+			return ErrNoList // don't reveal whether the list or its archive exists
+		}
+
+		return f(ctx, list, auth)
+	}
+}
+
+// archive shows the months which have archived messages
+func (w Web) archive(ctx *Context, list *ulist.List, auth ulist.Membership) error {
+
+	months, err := w.Ulist.Archive.ArchivedMonths(list)
+	if err != nil {
+		return err
+	}
+
+	return ctx.Execute(html.Archive, html.ArchiveData{
+		Auth:   auth,
+		List:   list,
+		Months: months,
+	})
+}
+
+// archiveMonth shows the archived messages of a month, oldest first
+func (w Web) archiveMonth(ctx *Context, list *ulist.List, auth ulist.Membership) error {
+
+	month, err := ulist.ParseArchiveMonth(ctx.ps.ByName("month"))
+	if err != nil {
+		return err
+	}
+
+	messages, err := w.Ulist.Archive.ArchivedBetween(list, month.Start(), month.Start().AddDate(0, 1, 0))
+	if err != nil {
+		return err
+	}
+
+	return ctx.Execute(html.ArchiveMonth, html.ArchiveMonthData{
+		Auth:     auth,
+		List:     list,
+		Month:    month,
+		Messages: messages,
+	})
+}
+
+// archiveThread shows the text of all archived messages of a thread
+func (w Web) archiveThread(ctx *Context, list *ulist.List, auth ulist.Membership) error {
+
+	thread, err := strconv.Atoi(ctx.ps.ByName("id"))
+	if err != nil {
+		return err
+	}
+
+	messages, err := w.Ulist.Archive.ArchivedThread(list, thread)
+	if err != nil {
+		return err
+	}
+	if len(messages) == 0 {
+		return errors.New("thread not found")
+	}
+
+	data := html.ArchiveThreadData{
+		Auth: auth,
+		List: list,
+	}
+
+	for _, message := range messages {
+		var text string
+		if msg, err := mailutil.ReadMessage(bytes.NewReader(message.Raw)); err == nil {
+			if root, err := msg.ParseParts(); err == nil {
+				text, _, _ = renderParts(root)
+			}
+		}
+		data.Messages = append(data.Messages, html.ArchivedText{
+			ArchivedMessage: message,
+			Text:            text,
+		})
+	}
+
+	return ctx.Execute(html.ArchiveThread, data)
+}
+
+// archiveMessage is the permalink of an archived message
+func (w Web) archiveMessage(ctx *Context, list *ulist.List, auth ulist.Membership) error {
+
+	root, message, err := w.readArchived(ctx, list)
+	if err != nil {
+		return err
+	}
+
+	data := html.ArchiveMessageData{
+		Auth:    auth,
+		List:    list,
+		Message: message,
+	}
+	data.Text, data.HTML, data.Attachments = renderParts(root)
+
+	setPreviewCSP(ctx)
+
+	return ctx.Execute(html.ArchiveMessage, data)
+}
+
+// archivePart serves a leaf of the MIME tree of an archived message as a download
+func (w Web) archivePart(ctx *Context, list *ulist.List, auth ulist.Membership) error {
+
+	root, _, err := w.readArchived(ctx, list)
+	if err != nil {
+		return err
+	}
+
+	return servePart(ctx, root)
+}
+
+func (w Web) readArchived(ctx *Context, list *ulist.List) (*mailutil.Part, *ulist.ArchivedMessage, error) {
+
+	id, err := strconv.Atoi(ctx.ps.ByName("id"))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	message, err := w.Ulist.Archive.Archived(list, id)
+	if err != nil {
+		return nil, nil, err
+	}
+	if message == nil {
+		return nil, nil, errors.New("message not found")
+	}
+
+	msg, err := mailutil.ReadMessage(bytes.NewReader(message.Raw))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	root, err := msg.ParseParts()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return root, message, nil
+}
+
+// exportArchive serves the archived messages of the list as an mbox file, optionally limited to a date range
+func (w Web) exportArchive(ctx *Context, list *ulist.List) error {
+
+	if w.Ulist.Archive == nil {
+		return ErrNoList
+	}
+
+	after, before := parseDates(ctx.r.URL.Query())
+
+	filename := list.RFC5322AddrSpec()
+	if !after.IsZero() {
+		filename += "-from-" + after.Format("2006-01-02")
+	}
+	if !before.IsZero() {
+		filename += "-to-" + before.AddDate(0, 0, -1).Format("2006-01-02")
+	}
+	filename += ".mbox"
+
+	ctx.w.Header().Set("Content-Type", "application/mbox")
+	ctx.w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	return w.Ulist.ExportArchive(ctx.w, list, after, before)
+}
+
+// readableArchives returns the lists whose archive the user, who might not be logged in, can read
+func (w Web) readableArchives(ctx *Context) ([]ulist.ListInfo, error) {
+
+	if w.Ulist.Archive == nil {
+		return nil, nil
+	}
+
+	all, err := w.Ulist.Lists.AllLists()
+	if err != nil {
+		return nil, err
+	}
+
+	var memberships = make(map[int]ulist.Membership) // key: list id
+	if ctx.LoggedIn() {
+		ms, err := w.Ulist.Lists.Memberships(ctx.User)
+		if err != nil {
+			return nil, err
+		}
+		for _, m := range ms {
+			memberships[m.ID] = m
+		}
+	}
+
+	var readable []ulist.ListInfo
+	for _, li := range all {
+		m, ok := memberships[li.ID]
+		if !ok {
+			m = ulist.Membership{ListInfo: li}
+		}
+		if ctx.IsSuperadmin {
+			m.Moderate = true
+			m.Admin = true
+		}
+		if m.CanReadArchive() {
+			readable = append(readable, li)
+		}
+	}
+	return readable, nil
+}
+
+// search searches the archives which the user can read, or one of them
+func (w Web) search(ctx *Context) error {
+
+	readable, err := w.readableArchives(ctx)
+	if err != nil {
+		return err
+	}
+
+	query := ctx.r.URL.Query()
+
+	data := html.SearchData{
+		Lists: readable,
+		Input: query,
+		Limit: searchLimit,
+		Names: make(map[int]string),
+	}
+
+	for _, li := range readable {
+		data.Names[li.ID] = li.RFC5322AddrSpec()
+	}
+
+	// scope
+
+	var scope = readable
+	if rawList := query.Get("list"); rawList != "" {
+		scope = nil
+		for _, li := range readable {
+			if li.RFC5322AddrSpec() == rawList {
+				scope = []ulist.ListInfo{li}
+			}
+		}
+		if scope == nil {
+			return ErrNoList // don't reveal whether the list or its archive exists
+		}
+	}
+
+	after, before := parseDates(query)
+
+	if q := strings.TrimSpace(query.Get("q")); q != "" {
+		data.Searched = true
+		data.Results, err = w.Ulist.Archive.Search(scope, q, after, before, searchLimit)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ctx.Execute(html.Search, data)
 }
 
 // join and leave
@@ -1132,6 +2484,32 @@ func (w Web) leave(ctx *Context) error {
 
 	if ctx.r.Method == http.MethodPost {
 
+		if rawNotifyMode := ctx.r.PostFormValue("notify-mode"); rawNotifyMode != "" {
+			notifyMode, err := ulist.ParseNotifyMode(rawNotifyMode)
+			if err != nil {
+				return err
+			}
+			if err := w.Ulist.Lists.UpdateNotifyMode(list, ctx.User.RFC5322AddrSpec(), notifyMode); err != nil {
+				return err
+			}
+			ctx.Successf("Your moderation notifications are %s now.", notifyMode)
+			ctx.Redirect("/my/%s", list.RFC5322AddrSpec())
+			return nil
+		}
+
+		if rawDelivery := ctx.r.PostFormValue("delivery"); rawDelivery != "" {
+			delivery, err := ulist.ParseDelivery(rawDelivery)
+			if err != nil {
+				return err
+			}
+			if err := w.Ulist.Lists.UpdateDelivery(list, ctx.User.RFC5322AddrSpec(), delivery); err != nil {
+				return err
+			}
+			ctx.Successf("Your delivery mode is %s now.", delivery)
+			ctx.Redirect("/my/%s", list.RFC5322AddrSpec())
+			return nil
+		}
+
 		if ctx.r.PostFormValue("confirm-leave") == "" {
 			ctx.Alertf("Please confirm if you want to leave the list.")
 			ctx.Redirect("/my/%s", list.RFC5322AddrSpec())